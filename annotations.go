@@ -146,17 +146,14 @@ func GetAnnotations(ctx *Ctx, orgRepo, annoRegexp string) (annotations Annotatio
 	return
 }
 
-// ProcessAnnotations Creates IfluxDB annotations and quick_series
+// ProcessAnnotations Creates annotations and quick_series in the series store
 func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time) {
-	// Connect to InfluxDB
-	ic := IDBConn(ctx)
-	defer func() { FatalOnError(ic.Close()) }()
+	// Connect to series store
+	store := NewSeriesStore(ctx)
+	defer func() { FatalOnError(store.Close()) }()
 
-	// Get BatchPoints
-	var pts IDBBatchPointsN
-	bp := IDBBatchPoints(ctx, &ic)
-	pts.NPoints = 0
-	pts.Points = &bp
+	// Points to write
+	var pts []SeriesPoint
 
 	// Annotations must be sorted to create quick ranges
 	sort.Sort(AnnotationsByDate(annotations.Annotations))
@@ -177,8 +174,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time)
 				annotation.Description,
 			)
 		}
-		pt := IDBNewPointWithErr(ctx, "annotations", nil, fields, annotation.Date)
-		IDBAddPointN(ctx, &ic, &pts, pt)
+		pts = append(pts, NewSeriesPoint(ctx, "annotations", nil, fields, annotation.Date))
 	}
 
 	// Join CNCF (additional annotation not used in quick ranges)
@@ -196,8 +192,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time)
 				fields["description"],
 			)
 		}
-		pt := IDBNewPointWithErr(ctx, "annotations", nil, fields, *joinDate)
-		IDBAddPointN(ctx, &ic, &pts, pt)
+		pts = append(pts, NewSeriesPoint(ctx, "annotations", nil, fields, *joinDate))
 	}
 
 	// Special ranges
@@ -239,8 +234,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time)
 			)
 		}
 		// Add batch point
-		pt := IDBNewPointWithErr(ctx, tagName, tags, fields, tm)
-		IDBAddPointN(ctx, &ic, &pts, pt)
+		pts = append(pts, NewSeriesPoint(ctx, tagName, tags, fields, tm))
 		tm = tm.Add(time.Hour)
 	}
 
@@ -260,8 +254,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time)
 				)
 			}
 			// Add batch point
-			pt := IDBNewPointWithErr(ctx, tagName, tags, fields, tm)
-			IDBAddPointN(ctx, &ic, &pts, pt)
+			pts = append(pts, NewSeriesPoint(ctx, tagName, tags, fields, tm))
 			tm = tm.Add(time.Hour)
 			break
 		}
@@ -278,17 +271,16 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, joinDate *time.Time)
 			)
 		}
 		// Add batch point
-		pt := IDBNewPointWithErr(ctx, tagName, tags, fields, tm)
-		IDBAddPointN(ctx, &ic, &pts, pt)
+		pts = append(pts, NewSeriesPoint(ctx, tagName, tags, fields, tm))
 		tm = tm.Add(time.Hour)
 	}
 
 	// Write the batch
 	if !ctx.SkipIDB {
 		if ctx.IDBDrop {
-			QueryIDB(ic, ctx, "delete from \"quick_ranges\"")
+			FatalOnError(store.DropSeries("quick_ranges"))
 		}
-		FatalOnError(IDBWritePointsN(ctx, &ic, &pts))
+		FatalOnError(store.WritePoints(pts))
 	} else if ctx.Debug > 0 {
 		Printf("Skipping annotations series write\n")
 	}
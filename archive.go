@@ -0,0 +1,109 @@
+package devstats
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GHAArchiveFile - return GH Archive file name for a given hour: YYYY-MM-DD-H.json.gz
+func GHAArchiveFile(dt time.Time) string {
+	return ToGHADate(dt) + ".json.gz"
+}
+
+// GHAArchiveRemoteURL - return URL of a given hour in the remote GH Archive (ctx.ArchiveURL)
+func GHAArchiveRemoteURL(ctx *Ctx, dt time.Time) string {
+	url := ctx.ArchiveURL
+	if !strings.HasSuffix(url, "/") {
+		url += "/"
+	}
+	return url + GHAArchiveFile(dt)
+}
+
+// GHAArchiveLocalPath - return path of a given hour in the local GH Archive mirror (ctx.ArchiveDir)
+// ArchiveDir can be a directory or a file:// URL, returns "" when no local mirror is configured
+func GHAArchiveLocalPath(ctx *Ctx, dt time.Time) string {
+	dir := ctx.ArchiveDir
+	if dir == "" {
+		return ""
+	}
+	dir = strings.TrimPrefix(dir, "file://")
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir + GHAArchiveFile(dt)
+}
+
+// OpenGHAArchive - return reader of gzipped JSONs for a given hour and its location (path or URL)
+// It reads from local mirror (if configured and file present), otherwise from remote GH Archive
+// In offline mode (ctx.ArchiveOffline) missing local files return an error that satisfies os.IsNotExist
+func OpenGHAArchive(ctx *Ctx, dt time.Time) (io.ReadCloser, string, error) {
+	path := GHAArchiveLocalPath(ctx, dt)
+	if path != "" {
+		file, err := os.Open(path)
+		if err == nil || !os.IsNotExist(err) || ctx.ArchiveOffline {
+			return file, path, err
+		}
+		if ctx.Debug > 0 {
+			Printf("%s not found in local mirror, falling back to %s\n", path, ctx.ArchiveURL)
+		}
+	}
+	url := GHAArchiveRemoteURL(ctx, dt)
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, url, err
+	}
+	return response.Body, url, nil
+}
+
+// ProcessGHAJSONs - read newline separated JSONs (decompressed GH Archive hour) one by one
+// and call process on each non-empty JSON, memory usage is bounded by the size of a single JSON
+// Returns number of JSONs processed
+func ProcessGHAJSONs(reader io.Reader, process func([]byte) error) (int, error) {
+	buffered := bufio.NewReaderSize(reader, 1<<20)
+	n := 0
+	for {
+		jsonBytes, err := buffered.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		jsonBytes = bytes.TrimSpace(jsonBytes)
+		if len(jsonBytes) > 0 {
+			if perr := process(jsonBytes); perr != nil {
+				return n, perr
+			}
+			n++
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+	}
+}
+
+// VerifyGHAArchive - decompress gzipped JSONs and check that every line is a valid JSON
+// Returns number of JSONs found
+func VerifyGHAArchive(reader io.Reader) (int, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = gz.Close() }()
+	i := 0
+	return ProcessGHAJSONs(
+		gz,
+		func(jsonBytes []byte) error {
+			i++
+			if !json.Valid(jsonBytes) {
+				return fmt.Errorf("invalid JSON number %d", i)
+			}
+			return nil
+		},
+	)
+}
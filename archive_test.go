@@ -0,0 +1,174 @@
+package devstats
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestGHAArchivePaths(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		archiveURL  string
+		archiveDir  string
+		dt          []int
+		expectedURL string
+		expectedDir string
+	}{
+		{
+			archiveURL:  "http://data.gharchive.org/",
+			archiveDir:  "",
+			dt:          []int{2018, 3, 7, 5},
+			expectedURL: "http://data.gharchive.org/2018-03-07-5.json.gz",
+			expectedDir: "",
+		},
+		{
+			archiveURL:  "http://mirror.example.com",
+			archiveDir:  "/data/gha",
+			dt:          []int{2017, 12, 31, 23},
+			expectedURL: "http://mirror.example.com/2017-12-31-23.json.gz",
+			expectedDir: "/data/gha/2017-12-31-23.json.gz",
+		},
+		{
+			archiveURL:  "http://data.gharchive.org/",
+			archiveDir:  "file:///data/gha/",
+			dt:          []int{2015, 1, 1, 0},
+			expectedURL: "http://data.gharchive.org/2015-01-01-0.json.gz",
+			expectedDir: "/data/gha/2015-01-01-0.json.gz",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx := lib.Ctx{ArchiveURL: test.archiveURL, ArchiveDir: test.archiveDir}
+		dt := testlib.YMDHMS(test.dt...)
+		gotURL := lib.GHAArchiveRemoteURL(&ctx, dt)
+		if gotURL != test.expectedURL {
+			t.Errorf("test number %d, expected URL %v, got %v", index+1, test.expectedURL, gotURL)
+		}
+		gotDir := lib.GHAArchiveLocalPath(&ctx, dt)
+		if gotDir != test.expectedDir {
+			t.Errorf("test number %d, expected path %v, got %v", index+1, test.expectedDir, gotDir)
+		}
+	}
+}
+
+func TestVerifyGHAArchive(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		data          string
+		gzipped       bool
+		expectedN     int
+		expectedError bool
+	}{
+		{data: "", gzipped: true, expectedN: 0, expectedError: false},
+		{data: "{\"id\":\"1\"}\n{\"id\":\"2\"}\n", gzipped: true, expectedN: 2, expectedError: false},
+		{data: "{\"id\":\"1\"}\n\n{\"id\":\"2\"}", gzipped: true, expectedN: 2, expectedError: false},
+		{data: "{\"id\":\"1\"}\n{\"id\":", gzipped: true, expectedN: 1, expectedError: true},
+		{data: "{\"id\":\"1\"}\n", gzipped: false, expectedN: 0, expectedError: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var buf bytes.Buffer
+		if test.gzipped {
+			gz := gzip.NewWriter(&buf)
+			_, err := gz.Write([]byte(test.data))
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			err = gz.Close()
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+		} else {
+			buf.WriteString(test.data)
+		}
+		gotN, err := lib.VerifyGHAArchive(&buf)
+		if (err != nil) != test.expectedError {
+			t.Errorf("test number %d, expected error %v, got %v", index+1, test.expectedError, err)
+		}
+		if gotN != test.expectedN {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expectedN, gotN)
+		}
+	}
+}
+
+func TestOpenGHAArchiveOffline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gha_archive")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	dt := testlib.YMDHMS(2018, 1, 2, 3)
+	ctx := lib.Ctx{ArchiveURL: "http://localhost:1/", ArchiveDir: "file://" + dir, ArchiveOffline: true}
+
+	// Missing file in offline mode must be reported as not existing
+	_, _, err = lib.OpenGHAArchive(&ctx, dt)
+	if err == nil || !os.IsNotExist(err) {
+		t.Errorf("expected not exists error, got %v", err)
+	}
+
+	// Existing file must be read from local mirror
+	path := lib.GHAArchiveLocalPath(&ctx, dt)
+	err = ioutil.WriteFile(path, []byte("data"), 0644)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	reader, got, err := lib.OpenGHAArchive(&ctx, dt)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = reader.Close() }()
+	if got != path {
+		t.Errorf("expected %v, got %v", path, got)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+	if string(data) != "data" {
+		t.Errorf("expected data, got %v", string(data))
+	}
+}
+
+func TestProcessGHAJSONs(t *testing.T) {
+	// Single JSON bigger than default bufio.Scanner's buffer
+	big := "{\"a\":\"" + strings.Repeat("x", 200000) + "\"}"
+
+	// Test cases
+	var testCases = []struct {
+		data     string
+		expected []int
+	}{
+		{data: "", expected: []int{}},
+		{data: "\n\n", expected: []int{}},
+		{data: "{}\n{\"a\":1}\n", expected: []int{2, 7}},
+		{data: "{}\r\n \n{\"a\":1}", expected: []int{2, 7}},
+		{data: "{}\n" + big + "\n{}", expected: []int{2, len(big), 2}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := []int{}
+		n, err := lib.ProcessGHAJSONs(
+			strings.NewReader(test.data),
+			func(jsonBytes []byte) error {
+				got = append(got, len(jsonBytes))
+				return nil
+			},
+		)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error %v", index+1, err)
+		}
+		if n != len(test.expected) {
+			t.Errorf("test number %d, expected %v JSONs, got %v", index+1, len(test.expected), n)
+		}
+		if !testlib.CompareIntSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,961 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CalcMetricData - single metric calculation parameters (db2influx call)
+// SeriesNameOrFunc - series name (for single value metrics) or function generating series names from rows
+// SQLFile - metric SQL file, From, To - date range, Period - period abbreviation (h, d, w, m, q, y, h24, d7, ...)
+// Tagged - row keys and period are written as tags (RowTag, "period") of a single measurement instead of series name parts
+type CalcMetricData struct {
+	SeriesNameOrFunc  string
+	SQLFile           string
+	From              string
+	To                string
+	Period            string
+	Desc              string
+	Hist              bool
+	MultiValue        bool
+	EscapeValueName   bool
+	AnnotationsRanges bool
+	SkipPast          bool
+	Tagged            bool
+	RowTag            string
+}
+
+// SetOptions - set metric options from db2influx options string
+// Format: "hist,multivalue,escape_value_name,annotations_ranges,skip_past,desc:time_diff_as_string,tagged:repo_group"
+func (m *CalcMetricData) SetOptions(opts string) {
+	if opts == "" {
+		return
+	}
+	for _, opt := range strings.Split(opts, ",") {
+		optArr := strings.Split(opt, ":")
+		switch optArr[0] {
+		case "hist":
+			m.Hist = true
+		case "multivalue":
+			m.MultiValue = true
+		case "escape_value_name":
+			m.EscapeValueName = true
+		case "annotations_ranges":
+			m.AnnotationsRanges = true
+		case "skip_past":
+			m.SkipPast = true
+		case "desc":
+			if len(optArr) > 1 {
+				m.Desc = optArr[1]
+			}
+		case "tagged":
+			m.Tagged = true
+			if len(optArr) > 1 {
+				m.RowTag = optArr[1]
+			}
+		}
+	}
+}
+
+// Options - return metric options as db2influx options string (see SetOptions)
+func (m *CalcMetricData) Options() string {
+	opts := []string{}
+	if m.Hist {
+		opts = append(opts, "hist")
+	}
+	if m.MultiValue {
+		opts = append(opts, "multivalue")
+	}
+	if m.EscapeValueName {
+		opts = append(opts, "escape_value_name")
+	}
+	if m.AnnotationsRanges {
+		opts = append(opts, "annotations_ranges")
+	}
+	if m.SkipPast {
+		opts = append(opts, "skip_past")
+	}
+	if m.Desc != "" {
+		opts = append(opts, "desc:"+m.Desc)
+	}
+	if m.Tagged {
+		if m.RowTag != "" {
+			opts = append(opts, "tagged:"+m.RowTag)
+		} else {
+			opts = append(opts, "tagged")
+		}
+	}
+	return strings.Join(opts, ",")
+}
+
+// Args - return db2influx command line arguments that calculate the same metric
+func (m *CalcMetricData) Args() []string {
+	args := []string{m.SeriesNameOrFunc, m.SQLFile, m.From, m.To, m.Period}
+	opts := m.Options()
+	if opts != "" {
+		args = append(args, opts)
+	}
+	return args
+}
+
+// MetricsCalc - metrics calculation engine (used by db2influx and gha2db_sync)
+// Postgres and InfluxDB connections are shared by all metrics calculated by a given MetricsCalc
+// Number of concurrently running queries is limited by a global workers budget
+// Metric SQLs and bots exclusion SQL are read only once
+type MetricsCalc struct {
+	ctx         *Ctx
+	con         *sql.DB
+	store       SeriesStore
+	workers     chan struct{}
+	excludeBots string
+	sqls        map[string]string
+	sqlsMtx     sync.Mutex
+	points      int64
+}
+
+// NewMetricsCalc - create metrics calculation engine with a given workers budget
+func NewMetricsCalc(ctx *Ctx, workers int) *MetricsCalc {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Local or cron mode?
+	dataPrefix := DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read bots exclusion partial SQL
+	bytes, err := ReadFile(ctx, dataPrefix+"util_sql/exclude_bots.sql")
+	FatalOnError(err)
+
+	mc := &MetricsCalc{
+		ctx:         ctx,
+		con:         PgConn(ctx),
+		store:       NewSeriesStore(ctx),
+		workers:     make(chan struct{}, workers),
+		excludeBots: string(bytes),
+		sqls:        make(map[string]string),
+	}
+	mc.con.SetMaxOpenConns(workers)
+	return mc
+}
+
+// Close - close shared connections
+func (mc *MetricsCalc) Close() {
+	FatalOnError(mc.con.Close())
+	FatalOnError(mc.store.Close())
+}
+
+// Points - number of points written by all metrics calculated so far
+func (mc *MetricsCalc) Points() int64 {
+	return atomic.LoadInt64(&mc.points)
+}
+
+// metricSQL - return (cached) contents of metric SQL file
+func (mc *MetricsCalc) metricSQL(sqlFile string) (string, error) {
+	mc.sqlsMtx.Lock()
+	defer mc.sqlsMtx.Unlock()
+	sqlQuery, ok := mc.sqls[sqlFile]
+	if ok {
+		return sqlQuery, nil
+	}
+	bytes, err := ReadFile(mc.ctx, sqlFile)
+	if err != nil {
+		return "", err
+	}
+	sqlQuery = string(bytes)
+	mc.sqls[sqlFile] = sqlQuery
+	return sqlQuery, nil
+}
+
+// Calc - calculate a single metric, it can be called from multiple go routines
+// Histograms use a single worker, other metrics use one worker per interval (from the global workers budget)
+// Errors (also fatal errors from library functions) are returned, so other metrics can still be calculated
+func (mc *MetricsCalc) Calc(m *CalcMetricData) (err error) {
+	sqlQuery, err := mc.metricSQL(m.SQLFile)
+	if err != nil {
+		return err
+	}
+
+	// Process interval, day and longer intervals start at local midnight of GHA2DB_TMZONE (if set)
+	interval, nIntervals, intervalStart, nextIntervalStart, prevIntervalStart := GetIntervalFunctionsInZone(m.Period, m.AnnotationsRanges, mc.ctx.TmZone)
+
+	if m.Hist {
+		if m.Tagged {
+			return fmt.Errorf("%s %s: tagged mode is not supported for histograms", m.SeriesNameOrFunc, m.SQLFile)
+		}
+		mc.workers <- struct{}{}
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s %s: %v", m.SeriesNameOrFunc, m.SQLFile, r)
+			}
+			<-mc.workers
+		}()
+		mc.calcHistogram(m, sqlQuery, interval, nIntervals)
+		return
+	}
+
+	// Parse input dates
+	dFrom := TimeParseAny(m.From)
+	dTo := TimeParseAny(m.To)
+
+	// Round dates to the given interval
+	dFrom = intervalStart(dFrom)
+	dTo = nextIntervalStart(dTo)
+
+	// Run
+	Printf(
+		"Calculate %s: %v - %v with interval %s, descriptions '%s', multivalue: %v, escape_value_name: %v, tagged: %v\n",
+		m.SeriesNameOrFunc, dFrom, dTo, interval, m.Desc, m.MultiValue, m.EscapeValueName, m.Tagged,
+	)
+	ch := make(chan error)
+	nThreads := 0
+	dt := dFrom
+	var pDt time.Time
+	for dt.Before(dTo) {
+		nDt := nextIntervalStart(dt)
+		if nIntervals <= 1 {
+			pDt = dt
+		} else {
+			pDt = AddNIntervals(dt, 1-nIntervals, nextIntervalStart, prevIntervalStart)
+		}
+		// Wait for a free worker, collect results of finished intervals meanwhile
+		acquired := false
+		for !acquired {
+			select {
+			case mc.workers <- struct{}{}:
+				acquired = true
+			case e := <-ch:
+				nThreads--
+				if e != nil && err == nil {
+					err = e
+				}
+			}
+		}
+		go mc.calcInterval(ch, m, sqlQuery, nIntervals, dt, pDt, nDt)
+		nThreads++
+		dt = nDt
+	}
+	for nThreads > 0 {
+		e := <-ch
+		nThreads--
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// valueDescription - return string description for given float value
+// descFunc specifies how to treat value
+// currently supported:
+// `time_diff_as_string`: return string description of value that holds number of hours passed
+// like 30 -> 1 day 6 hours, 100 -> 4 days 4 hours, etc...
+func valueDescription(descFunc string, value float64) (result string) {
+	switch descFunc {
+	case "time_diff_as_string":
+		return DescriblePeriodInHours(value)
+	default:
+		Fatalf("unknown value description function '%v'", descFunc)
+	}
+	return
+}
+
+// Returns multi row and multi column series names array (different for different rows)
+// Each row must be in format: 'prefix;rowName;series1,series2,..,seriesN' serVal1 serVal2 ... serValN
+// if multivalue is true then rowName is not used for generating series name
+// Series name is independent from rowName, and metric returns "series_name;rowName"
+// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
+func multiRowMultiColumn(expr, period string, multivalue, escapeValueName bool) (result []string) {
+	ary := strings.Split(expr, ";")
+	pref := ary[0]
+	if pref == "" {
+		Printf("multiRowMultiColumn: Info: prefix '%v' (ary=%+v,expr=%+v,mv=%+v) skipping\n", pref, ary, expr, multivalue)
+		return
+	}
+	splitColumns := strings.Split(ary[2], ",")
+	if multivalue {
+		rowNameAry := strings.Split(ary[1], "`")
+		rowName := rowNameAry[0]
+		if escapeValueName {
+			rowName = NormalizeName(rowName)
+		}
+		if len(rowNameAry) > 1 {
+			rowNameNonMulti := NormalizeName(rowNameAry[1])
+			for _, series := range splitColumns {
+				result = append(result, fmt.Sprintf("%s_%s_%s_%s;%s", pref, rowNameNonMulti, series, period, rowName))
+			}
+			return
+		}
+		for _, series := range splitColumns {
+			result = append(result, fmt.Sprintf("%s_%s_%s;%s", pref, series, period, rowName))
+		}
+		return
+	}
+	rowName := NormalizeName(ary[1])
+	if rowName == "" {
+		Printf("multiRowMultiColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
+		return
+	}
+	for _, series := range splitColumns {
+		result = append(result, fmt.Sprintf("%s_%s_%s_%s", pref, rowName, series, period))
+	}
+	return
+}
+
+// Return default series names from multi column single row result
+// It takes name "a,b,c,d,...,z" and period for example "q"
+// and returns array [a_q, b_q, c_q, .., z_q]
+func singleRowMultiColumn(columns, period string) (result []string) {
+	splitColumns := strings.Split(columns, ",")
+	for _, column := range splitColumns {
+		result = append(result, column+"_"+period)
+	}
+	return
+}
+
+// Return default series names from multi row result single column
+// Each row is "prefix,rowName", value (prefix is hardcoded in metric, so it is assumed safe)
+// and returns array [a_q, b_q, c_q, .., z_q]
+// if multivalue is true then rowName is not used for generating series name
+// Series name is independent from rowName, and metric returns "series_name;rowName"
+// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
+func multiRowSingleColumn(col, period string, multivalue, escapeValueName bool) (result []string) {
+	ary := strings.Split(col, ",")
+	pref := ary[0]
+	if pref == "" {
+		Printf("multiRowSingleColumn: Info: prefix '%v' (ary=%+v,col=%+v,mv=%+v) skipping\n", pref, ary, col, multivalue)
+		return
+	}
+	if multivalue {
+		rowNameAry := strings.Split(ary[1], "`")
+		rowName := rowNameAry[0]
+		if escapeValueName {
+			rowName = NormalizeName(rowName)
+		}
+		if len(rowNameAry) > 1 {
+			rowNameNonMulti := NormalizeName(rowNameAry[1])
+			return []string{fmt.Sprintf("%s_%s_%s;%s", pref, rowNameNonMulti, period, rowName)}
+		}
+		return []string{fmt.Sprintf("%s_%s;%s", pref, period, rowName)}
+	}
+	rowName := NormalizeName(ary[1])
+	if rowName == "" {
+		Printf("multiRowSingleColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
+		return
+	}
+	return []string{fmt.Sprintf("%s_%s_%s", pref, rowName, period)}
+}
+
+// NameForMetricsRow - generate series names for given metric (series_name_or_func) row and period
+func NameForMetricsRow(metric, name, period string, multivalue, escapeValueName bool) []string {
+	switch metric {
+	case "single_row_multi_column":
+		return singleRowMultiColumn(name, period)
+	case "multi_row_single_column":
+		return multiRowSingleColumn(name, period, multivalue, escapeValueName)
+	case "multi_row_multi_column":
+		return multiRowMultiColumn(name, period, multivalue, escapeValueName)
+	default:
+		Fatalf("unknown metric '%v'", metric)
+	}
+	return []string{""}
+}
+
+// DefaultRowTag - tag used for row keys of tagged metrics when metric doesn't specify `row_tag`
+const DefaultRowTag = "name"
+
+// TaggedSeries - measurement name, tags and field name for a single value of tagged metric row
+type TaggedSeries struct {
+	Name  string
+	Tags  map[string]string
+	Field string
+}
+
+// TagsForMetricsRow - tagged version of NameForMetricsRow
+// Instead of name mangling, row key becomes rowTag tag (normalized the same way as idb_tags value_tag)
+// and period becomes "period" tag, so all rows and periods are stored in a single measurement:
+// single_row_multi_column "a,b" -> measurements a, b with tag period
+// multi_row_single_column "prefix,rowName" -> measurement prefix with tags rowTag=rowName, period
+// multi_row_multi_column "prefix;rowName;a,b" -> measurement prefix with tags rowTag=rowName, period and fields a, b
+// multivalue and escape_value_name are not used in tagged mode
+func TagsForMetricsRow(metric, name, period, rowTag string) (result []TaggedSeries) {
+	if rowTag == "" {
+		rowTag = DefaultRowTag
+	}
+	var (
+		pref    string
+		rowName string
+		fields  []string
+	)
+	switch metric {
+	case "single_row_multi_column":
+		for _, column := range strings.Split(name, ",") {
+			result = append(result, TaggedSeries{Name: column, Tags: map[string]string{"period": period}, Field: "value"})
+		}
+		return
+	case "multi_row_single_column":
+		ary := strings.SplitN(name, ",", 2)
+		if len(ary) < 2 {
+			Fatalf("multi_row_single_column: row '%v' must be in format 'prefix,rowName'", name)
+		}
+		pref, rowName, fields = ary[0], ary[1], []string{"value"}
+	case "multi_row_multi_column":
+		ary := strings.Split(name, ";")
+		if len(ary) < 3 {
+			Fatalf("multi_row_multi_column: row '%v' must be in format 'prefix;rowName;series1,...,seriesN'", name)
+		}
+		pref, rowName, fields = ary[0], ary[1], strings.Split(ary[2], ",")
+	default:
+		Fatalf("unknown metric '%v'", metric)
+	}
+	if pref == "" {
+		Printf("TagsForMetricsRow: Info: prefix '%v' (name=%+v) skipping\n", pref, name)
+		return
+	}
+	tagValue := NormalizeName(rowName)
+	if tagValue == "" {
+		Printf("TagsForMetricsRow: Info: rowName '%v' (name=%+v) maps to empty string, skipping\n", rowName, name)
+		return
+	}
+	for _, field := range fields {
+		result = append(result, TaggedSeries{Name: pref, Tags: map[string]string{rowTag: tagValue, "period": period}, Field: field})
+	}
+	return
+}
+
+// ReadTagValues - return values returned by idb_tags SQL (metrics/{{project}}/sqlFile.sql, single string column)
+// It is used by idb_tags and by gaps filling for tagged series (normalized values are tagged metrics row tags values)
+func ReadTagValues(con *sql.DB, ctx *Ctx, sqlFile string) (values []string, err error) {
+	// Local or cron mode?
+	dataPrefix := DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Per project directory for SQL files
+	dir := Metrics
+	if ctx.Project != "" {
+		dir += ctx.Project + "/"
+	}
+
+	// Read SQL file
+	bytes, err := ReadFile(ctx, dataPrefix+dir+sqlFile+".sql")
+	if err != nil {
+		return
+	}
+	sqlQuery := string(bytes)
+
+	// Handle excluding bots
+	bytes, err = ReadFile(ctx, dataPrefix+"util_sql/exclude_bots.sql")
+	if err != nil {
+		return
+	}
+	excludeBots := string(bytes)
+
+	// Transform SQL
+	sqlQuery = strings.Replace(sqlQuery, "{{lim}}", "69", -1)
+	sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+
+	// Execute SQL
+	rows, err := QuerySQL(con, ctx, sqlQuery)
+	if err != nil {
+		return
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	value := ""
+	for rows.Next() {
+		err = rows.Scan(&value)
+		if err != nil {
+			return
+		}
+		values = append(values, value)
+	}
+	err = rows.Err()
+	return
+}
+
+// calcInterval - calculate metric for a single interval [from, to), series are stored at dt
+// It is run in its own go routine, worker slot must be acquired before, it is released when done
+// Error (or fatal error) is sent to ch
+func (mc *MetricsCalc) calcInterval(ch chan error, m *CalcMetricData, sqlQuery string, nIntervals int, dt, from, to time.Time) {
+	var result error
+	defer func() {
+		if r := recover(); r != nil {
+			result = fmt.Errorf("%s %s: %v - %v: %v", m.SeriesNameOrFunc, m.SQLFile, from, to, r)
+		}
+		<-mc.workers
+		ch <- result
+	}()
+	ctx := mc.ctx
+	sqlc := mc.con
+	store := mc.store
+	excludeBots := mc.excludeBots
+	seriesNameOrFunc, period, desc := m.SeriesNameOrFunc, m.Period, m.Desc
+	multivalue, escapeValueName := m.MultiValue, m.EscapeValueName
+
+	// Points to write
+	var pts []SeriesPoint
+
+	// Prepare SQL query
+	sFrom := ToYMDHMSDate(from)
+	sTo := ToYMDHMSDate(to)
+	sqlQuery = strings.Replace(sqlQuery, "{{from}}", sFrom, -1)
+	sqlQuery = strings.Replace(sqlQuery, "{{to}}", sTo, -1)
+	sqlQuery = strings.Replace(sqlQuery, "{{n}}", strconv.Itoa(nIntervals)+".0", -1)
+	sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+
+	// Execute SQL query
+	rows := QuerySQLWithErr(sqlc, ctx, sqlQuery)
+	defer func() { FatalOnError(rows.Close()) }()
+
+	// Get Number of columns
+	// We support either query returnign single row with single numeric value
+	// Or multiple rows, each containing string (series name) and its numeric value(s)
+	columns, err := rows.Columns()
+	FatalOnError(err)
+	nColumns := len(columns)
+
+	// Use value descriptions?
+	useDesc := desc != ""
+
+	// Metric Results, assume they're floats
+	var (
+		pValue *float64
+		value  float64
+		name   string
+	)
+	// Single row & single column result
+	if nColumns == 1 {
+		rowCount := 0
+		for rows.Next() {
+			FatalOnError(rows.Scan(&pValue))
+			rowCount++
+		}
+		FatalOnError(rows.Err())
+		if rowCount != 1 {
+			Printf(
+				"Error:\nQuery should return either single value or "+
+					"multiple rows, each containing string and numbers\n"+
+					"Got %d rows, each containing single number\nQuery:%s\n",
+				rowCount, sqlQuery,
+			)
+		}
+		// Handle nulls
+		if pValue != nil {
+			value = *pValue
+		}
+		// In this simplest case 1 row, 1 column - series name is taken directly from YAML (metrics.yaml)
+		// It usually uses `add_period_to_name: true` to have _period suffix, period{=h,d,w,m,q,y}
+		// In tagged mode period is stored in "period" tag instead
+		name = seriesNameOrFunc
+		if ctx.Debug > 0 {
+			Printf("%v - %v -> %v, %v\n", from, to, name, value)
+		}
+		// Add batch point
+		fields := map[string]interface{}{"value": value}
+		if useDesc {
+			fields["descr"] = valueDescription(desc, value)
+		}
+		var tags map[string]string
+		if m.Tagged {
+			tags = map[string]string{"period": period}
+		}
+		pts = append(pts, NewSeriesPoint(ctx, name, tags, fields, dt))
+	} else if nColumns >= 2 {
+		// Multiple rows, each with (series name, value(s))
+		// Number of columns
+		columns, err := rows.Columns()
+		FatalOnError(err)
+		nColumns := len(columns)
+		// Alocate nColumns numeric values (first is series name)
+		pValues := make([]interface{}, nColumns)
+		for i := range columns {
+			pValues[i] = new(sql.RawBytes)
+		}
+		allFields := make(map[string]map[string]interface{})
+		// Tagged points (all fields of a given measurement and tags are written as a single point)
+		taggedPts := make(map[string]*SeriesPoint)
+		taggedKeys := []string{}
+		for rows.Next() {
+			// Get row values
+			FatalOnError(rows.Scan(pValues...))
+			// Get first column name, and using it all series names
+			// First column should contain nColumns - 1 names separated by ","
+			name := string(*pValues[0].(*sql.RawBytes))
+			if m.Tagged {
+				for idx, series := range TagsForMetricsRow(seriesNameOrFunc, name, period, m.RowTag) {
+					if idx+1 >= nColumns {
+						break
+					}
+					value = 0.0
+					if pVal := pValues[idx+1]; pVal != nil {
+						value, _ = strconv.ParseFloat(string(*pVal.(*sql.RawBytes)), 64)
+					}
+					if ctx.Debug > 0 {
+						Printf("%v - %v -> %v: %v%v.%v, %v\n", from, to, idx, series.Name, series.Tags, series.Field, value)
+					}
+					key := fmt.Sprintf("%s%v", series.Name, series.Tags)
+					pt, ok := taggedPts[key]
+					if !ok {
+						point := NewSeriesPoint(ctx, series.Name, series.Tags, nil, dt)
+						pt = &point
+						taggedPts[key] = pt
+						taggedKeys = append(taggedKeys, key)
+					}
+					pt.Fields[series.Field] = value
+					if useDesc && series.Field == "value" {
+						pt.Fields["descr"] = valueDescription(desc, value)
+					}
+				}
+				continue
+			}
+			names := NameForMetricsRow(seriesNameOrFunc, name, period, multivalue, escapeValueName)
+			if len(names) > 0 {
+				// Iterate values
+				pFloats := pValues[1:]
+				for idx, pVal := range pFloats {
+					if pVal != nil {
+						value, _ = strconv.ParseFloat(string(*pVal.(*sql.RawBytes)), 64)
+					} else {
+						value = 0.0
+					}
+					if multivalue {
+						nameArr := strings.Split(names[idx], ";")
+						seriesName := nameArr[0]
+						seriesValueName := nameArr[1]
+						if ctx.Debug > 0 {
+							Printf("%v - %v -> %v: %v[%v], %v\n", from, to, idx, seriesName, seriesValueName, value)
+						}
+						if _, ok := allFields[seriesName]; !ok {
+							allFields[seriesName] = make(map[string]interface{})
+						}
+						allFields[seriesName][seriesValueName] = value
+					} else {
+						name = names[idx]
+						if ctx.Debug > 0 {
+							Printf("%v - %v -> %v: %v, %v\n", from, to, idx, name, value)
+						}
+						// Add batch point
+						fields := map[string]interface{}{"value": value}
+						if useDesc {
+							fields["descr"] = valueDescription(desc, value)
+						}
+						pts = append(pts, NewSeriesPoint(ctx, name, nil, fields, dt))
+					}
+				}
+			}
+		}
+		// Multivalue series if any
+		for seriesName, seriesValues := range allFields {
+			pts = append(pts, NewSeriesPoint(ctx, seriesName, nil, seriesValues, dt))
+		}
+		// Tagged series if any
+		for _, key := range taggedKeys {
+			pts = append(pts, *taggedPts[key])
+		}
+		FatalOnError(rows.Err())
+	}
+	// Write the batch
+	if !ctx.SkipIDB {
+		setPointsPeriod(pts, period)
+		FatalOnError(store.WritePoints(pts))
+		atomic.AddInt64(&mc.points, int64(len(pts)))
+	} else if ctx.Debug > 0 {
+		Printf("Skipping series write\n")
+	}
+}
+
+// getPathIndependentKey (return path value independent from install path
+// /etc/gha2db/metrics/kubernetes/key.sql --> kubernetes/key.sql
+// ./metrics/kubernetes/key.sql --> kubernetes/key.sql
+func getPathIndependentKey(key string) string {
+	keyAry := strings.Split(key, "/")
+	length := len(keyAry)
+	if length < 3 {
+		return key
+	}
+	return keyAry[length-2] + "/" + keyAry[length-1]
+}
+
+// isAlreadyComputed check if given quick range period was already computed
+// It will skip past period marked as compued unless special flags are passed
+func isAlreadyComputed(store SeriesStore, ctx *Ctx, key, from string) bool {
+	key = getPathIndependentKey(key)
+	computed, err := store.HasPoint("computed", map[string]string{"computed_key": key, "computed_from": from})
+	FatalOnError(err)
+	if ctx.Debug > 0 {
+		Printf("Period '%s: %s' compute status: %v\n", key, from, computed)
+	}
+	return computed
+}
+
+// setPointsPeriod - set period the points were calculated for (it is passed to Prometheus export)
+func setPointsPeriod(pts []SeriesPoint, period string) {
+	for i := range pts {
+		pts[i].Period = period
+	}
+}
+
+// setAlreadyComputed marks given quick range period as computed
+// Should be called inside: if !ctx.SkipIDB { ... }
+func setAlreadyComputed(ctx *Ctx, pts *[]SeriesPoint, key, from string) {
+	key = getPathIndependentKey(key)
+	// No fields value needed
+	fields := map[string]interface{}{"value": 0.0}
+
+	// Tags to insert
+	tags := make(map[string]string)
+	tags["computed_from"] = from
+	tags["computed_key"] = key
+	dtFrom := TimeParseAny(from)
+
+	// Add point
+	*pts = append(*pts, NewSeriesPoint(ctx, "computed", tags, fields, dtFrom))
+	if ctx.Debug > 0 {
+		Printf("Period '%s: %s' marked as computed\n", key, from)
+	}
+}
+
+// calcHistogram - calculate histogram metric (it is a single query for the entire interval)
+func (mc *MetricsCalc) calcHistogram(m *CalcMetricData, sqlQuery, interval string, nIntervals int) {
+	ctx := mc.ctx
+	sqlc := mc.con
+	store := mc.store
+	excludeBots := mc.excludeBots
+	seriesNameOrFunc, sqlFile, intervalAbbr := m.SeriesNameOrFunc, m.SQLFile, m.Period
+	annotationsRanges, skipPast, multivalue := m.AnnotationsRanges, m.SkipPast, m.MultiValue
+
+	// Points to write
+	var pts []SeriesPoint
+
+	Printf("Histogram running interval '%v,%v' n:%d anno:%v past:%v multi:%v\n", interval, intervalAbbr, nIntervals, annotationsRanges, skipPast, multivalue)
+
+	// If using annotations ranges, then get their values
+	var qrFrom *string
+	if annotationsRanges {
+		// Get Quick Ranges from series store (it is filled by annotations command)
+		quickRanges, err := store.TagValues("quick_ranges_data")
+		FatalOnError(err)
+		if ctx.Debug > 0 {
+			Printf("Quick ranges: %+v\n", quickRanges)
+		}
+		found := false
+		for _, data := range quickRanges {
+			ary := strings.Split(data, ";")
+			sfx := ary[0]
+			if intervalAbbr == sfx {
+				found = true
+				Printf("Found quick range: %+v\n", ary)
+				period := ary[1]
+				from := ary[2]
+				to := ary[3]
+				// We can skip past data sometimes
+				if skipPast && period == "" {
+					dtTo := TimeParseAny(to)
+					prevHour := PrevHourStart(time.Now())
+					if dtTo.Before(prevHour) && isAlreadyComputed(store, ctx, sqlFile, from) {
+						Printf("Skipping past quick range: %v (already computed)\n", from)
+						return
+					}
+				}
+				sqlQuery = PrepareQuickRangeQuery(sqlQuery, period, from, to)
+				sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+				if period == "" {
+					dtTo := TimeParseAny(to)
+					prevHour := PrevHourStart(time.Now())
+					if dtTo.Before(prevHour) {
+						qrFrom = &from
+					}
+				}
+				break
+			}
+		}
+		if !found {
+			Fatalf("quick range not found: '%s' known quick ranges: %+v", intervalAbbr, quickRanges)
+		}
+	} else {
+		// Prepare SQL query
+		dbInterval := fmt.Sprintf("%d %s", nIntervals, interval)
+		if interval == Quarter {
+			dbInterval = fmt.Sprintf("%d month", nIntervals*3)
+		}
+		sqlQuery = strings.Replace(sqlQuery, "{{period}}", dbInterval, -1)
+		sqlQuery = strings.Replace(sqlQuery, "{{n}}", strconv.Itoa(nIntervals)+".0", -1)
+		sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+	}
+
+	// Execute SQL query
+	rows := QuerySQLWithErr(sqlc, ctx, sqlQuery)
+	defer func() { FatalOnError(rows.Close()) }()
+
+	// Get number of columns, for histograms there should be exactly 2 columns
+	columns, err := rows.Columns()
+	FatalOnError(err)
+	nColumns := len(columns)
+
+	// Expect 2 columns: string column with name and float column with value
+	var (
+		value float64
+		name  string
+	)
+	if nColumns == 2 {
+		if !ctx.SkipIDB {
+			// Drop existing data
+			if ctx.IDBDrop {
+				FatalOnError(store.DropSeries(seriesNameOrFunc))
+			}
+			if ctx.Debug > 0 {
+				Printf("Dropped measurement %s\n", seriesNameOrFunc)
+			}
+		}
+
+		// Add new data
+		tm := TimeParseAny("2014-01-01")
+		rowCount := 0
+		for rows.Next() {
+			FatalOnError(rows.Scan(&name, &value))
+			if ctx.Debug > 0 {
+				Printf("hist %v, %v %v -> %v, %v\n", seriesNameOrFunc, nIntervals, interval, name, value)
+			}
+			// Add batch point
+			fields := map[string]interface{}{"name": name, "value": value}
+			pts = append(pts, NewSeriesPoint(ctx, seriesNameOrFunc, nil, fields, tm))
+			rowCount++
+			tm = tm.Add(-time.Hour)
+		}
+		if ctx.Debug > 0 {
+			Printf("hist %v, %v %v: %v rows\n", seriesNameOrFunc, nIntervals, interval, rowCount)
+		}
+		FatalOnError(rows.Err())
+	} else if nColumns >= 3 {
+		var (
+			fValue float64
+			sValue string
+		)
+		columns, err := rows.Columns()
+		FatalOnError(err)
+		nColumns := len(columns)
+		pValues := make([]interface{}, nColumns)
+		for i := range columns {
+			pValues[i] = new(sql.RawBytes)
+		}
+		seriesToClear := make(map[string]time.Time)
+		for rows.Next() {
+			// Get row values
+			FatalOnError(rows.Scan(pValues...))
+			name := string(*pValues[0].(*sql.RawBytes))
+			names := NameForMetricsRow(seriesNameOrFunc, name, intervalAbbr, multivalue, false)
+			// multivalue will return names as [ser_name1;a,b,c]
+			valueNames := []string{}
+			if multivalue {
+				if len(names) > 1 {
+					Fatalf("should return only one series name when using multi value, got: %+v", names)
+				}
+				namesAry := strings.Split(names[0], ";")
+				names = []string{namesAry[0]}
+				if len(namesAry) > 1 {
+					valueNames = strings.Split(namesAry[1], ",")
+				}
+			}
+			nNames := len(names)
+			if multivalue {
+				fields := map[string]interface{}{}
+				name = names[0]
+				for i, valueData := range valueNames {
+					va := strings.Split(valueData, ":")
+					valueName := va[0]
+					valueType := va[1]
+					if pValues[i+1] == nil {
+						fields[valueName] = nil
+						Fatalf("nulls are unsupported, name: %+v, i: %d, valueData: %s", name, i, valueData)
+					} else {
+						switch valueType {
+						case "s":
+							v := string(*pValues[i+1].(*sql.RawBytes))
+							fields[valueName] = v
+						case "f":
+							v, e := strconv.ParseFloat(string(*pValues[i+1].(*sql.RawBytes)), 64)
+							FatalOnError(e)
+							fields[valueName] = v
+						default:
+							Fatalf("unknown data type: %v (%v), i: %d, valuedata: %s", valueType, valueData, i, valueData)
+						}
+					}
+				}
+				tm, ok := seriesToClear[name]
+				if ok {
+					tm = tm.Add(-time.Hour)
+					seriesToClear[name] = tm
+				} else {
+					tm = TimeParseAny("2014-01-01")
+					seriesToClear[name] = tm
+				}
+				if ctx.Debug > 0 {
+					//Printf("hist %v, %v %v -> %+v\n", name, nIntervals, interval, fields)
+				}
+				// Add batch point
+				pts = append(pts, NewSeriesPoint(ctx, name, nil, fields, tm))
+			} else {
+				if nNames > 0 {
+					for i := 0; i < nNames; i++ {
+						pName := pValues[2*i+1]
+						if pName != nil {
+							sValue = string(*pName.(*sql.RawBytes))
+						} else {
+							sValue = "(nil)"
+						}
+						pVal := pValues[2*i+2]
+						if pVal != nil {
+							fValue, _ = strconv.ParseFloat(string(*pVal.(*sql.RawBytes)), 64)
+						} else {
+							fValue = 0.0
+						}
+						name = names[i]
+						if ctx.Debug > 0 {
+							Printf("hist %v, %v %v -> %v, %v\n", name, nIntervals, interval, sValue, fValue)
+						}
+						tm, ok := seriesToClear[name]
+						if ok {
+							tm = tm.Add(-time.Hour)
+							seriesToClear[name] = tm
+						} else {
+							tm = TimeParseAny("2014-01-01")
+							seriesToClear[name] = tm
+						}
+						// Add batch point
+						fields := map[string]interface{}{"name": sValue, "value": fValue}
+						pts = append(pts, NewSeriesPoint(ctx, name, nil, fields, tm))
+					}
+				}
+			}
+		}
+		FatalOnError(rows.Err())
+		if len(seriesToClear) > 0 && !ctx.SkipIDB && ctx.IDBDrop {
+			for series := range seriesToClear {
+				FatalOnError(store.DropSeries(series))
+				if ctx.Debug > 0 {
+					Printf("Dropped series: %s\n", series)
+				}
+			}
+		}
+	}
+	// Write the batch
+	if !ctx.SkipIDB {
+		setPointsPeriod(pts, intervalAbbr)
+		// Mark this metric & period as already computed if this is a QR period
+		if qrFrom != nil {
+			setAlreadyComputed(ctx, &pts, sqlFile, *qrFrom)
+		}
+		FatalOnError(store.WritePoints(pts))
+		atomic.AddInt64(&mc.points, int64(len(pts)))
+	} else if ctx.Debug > 0 {
+		Printf("Skipping series write\n")
+	}
+}
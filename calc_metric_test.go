@@ -0,0 +1,200 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestCalcMetricSetOptions(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		opts     string
+		expected lib.CalcMetricData
+	}{
+		{opts: "", expected: lib.CalcMetricData{}},
+		{opts: "hist", expected: lib.CalcMetricData{Hist: true}},
+		{
+			opts:     "multivalue,escape_value_name,skip_past",
+			expected: lib.CalcMetricData{MultiValue: true, EscapeValueName: true, SkipPast: true},
+		},
+		{
+			opts:     "hist,annotations_ranges,desc:time_diff_as_string",
+			expected: lib.CalcMetricData{Hist: true, AnnotationsRanges: true, Desc: "time_diff_as_string"},
+		},
+		{opts: "unknown,desc", expected: lib.CalcMetricData{}},
+		{opts: "tagged", expected: lib.CalcMetricData{Tagged: true}},
+		{opts: "skip_past,tagged:repo_group", expected: lib.CalcMetricData{SkipPast: true, Tagged: true, RowTag: "repo_group"}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var got lib.CalcMetricData
+		got.SetOptions(test.opts)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestCalcMetricArgs(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		metric   lib.CalcMetricData
+		expected []string
+	}{
+		{
+			metric:   lib.CalcMetricData{SeriesNameOrFunc: "events_h", SQLFile: "metrics/events.sql", From: "2018-02-03 04", To: "2018-02-03 05", Period: "h"},
+			expected: []string{"events_h", "metrics/events.sql", "2018-02-03 04", "2018-02-03 05", "h"},
+		},
+		{
+			metric: lib.CalcMetricData{
+				SeriesNameOrFunc: "multi_row_single_column", SQLFile: "prs.sql", From: "2018-01-01 00", To: "2018-02-01 00", Period: "w",
+				MultiValue: true, EscapeValueName: true, SkipPast: true,
+			},
+			expected: []string{"multi_row_single_column", "prs.sql", "2018-01-01 00", "2018-02-01 00", "w", "multivalue,escape_value_name,skip_past"},
+		},
+		{
+			metric: lib.CalcMetricData{
+				SeriesNameOrFunc: "hist_bots", SQLFile: "bots.sql", From: "2018-01-01 00", To: "2018-02-01 00", Period: "anno_1_now",
+				Hist: true, AnnotationsRanges: true, Desc: "time_diff_as_string",
+			},
+			expected: []string{"hist_bots", "bots.sql", "2018-01-01 00", "2018-02-01 00", "anno_1_now", "hist,annotations_ranges,desc:time_diff_as_string"},
+		},
+		{
+			metric: lib.CalcMetricData{
+				SeriesNameOrFunc: "multi_row_single_column", SQLFile: "company_issues.sql", From: "2018-01-01 00", To: "2018-02-01 00", Period: "y",
+				SkipPast: true, Tagged: true, RowTag: "company",
+			},
+			expected: []string{"multi_row_single_column", "company_issues.sql", "2018-01-01 00", "2018-02-01 00", "y", "skip_past,tagged:company"},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := test.metric.Args()
+		if !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+		// Options must be parsed back into the same metric
+		m := lib.CalcMetricData{
+			SeriesNameOrFunc: test.metric.SeriesNameOrFunc,
+			SQLFile:          test.metric.SQLFile,
+			From:             test.metric.From,
+			To:               test.metric.To,
+			Period:           test.metric.Period,
+		}
+		m.SetOptions(test.metric.Options())
+		if m != test.metric {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.metric, m)
+		}
+	}
+}
+
+func TestNameForMetricsRow(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		metric          string
+		name            string
+		period          string
+		multivalue      bool
+		escapeValueName bool
+		expected        []string
+	}{
+		{metric: "single_row_multi_column", name: "a,b,c", period: "d", expected: []string{"a_d", "b_d", "c_d"}},
+		{metric: "multi_row_single_column", name: "prs,My Repo", period: "w", expected: []string{"prs_my_repo_w"}},
+		{metric: "multi_row_single_column", name: ",My Repo", period: "w", expected: []string{}},
+		{
+			metric:     "multi_row_single_column",
+			name:       "company,Google Inc.",
+			period:     "m",
+			multivalue: true,
+			expected:   []string{"company_m;Google Inc."},
+		},
+		{
+			metric:          "multi_row_single_column",
+			name:            "company,Google Inc.`All",
+			period:          "m",
+			multivalue:      true,
+			escapeValueName: true,
+			expected:        []string{"company_all_m;google_inc_"},
+		},
+		{
+			metric:   "multi_row_multi_column",
+			name:     "sig;Apps;issues,prs",
+			period:   "q",
+			expected: []string{"sig_apps_issues_q", "sig_apps_prs_q"},
+		},
+		{
+			metric:     "multi_row_multi_column",
+			name:       "sig;Apps;issues,prs",
+			period:     "q",
+			multivalue: true,
+			expected:   []string{"sig_issues_q;Apps", "sig_prs_q;Apps"},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.NameForMetricsRow(test.metric, test.name, test.period, test.multivalue, test.escapeValueName)
+		if !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestTagsForMetricsRow(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		metric   string
+		name     string
+		period   string
+		rowTag   string
+		expected []lib.TaggedSeries
+	}{
+		{
+			metric: "single_row_multi_column",
+			name:   "a,b",
+			period: "d",
+			expected: []lib.TaggedSeries{
+				{Name: "a", Tags: map[string]string{"period": "d"}, Field: "value"},
+				{Name: "b", Tags: map[string]string{"period": "d"}, Field: "value"},
+			},
+		},
+		{
+			metric: "multi_row_single_column",
+			name:   "company_multi_cluster_issues,Google Inc.",
+			period: "y",
+			rowTag: "company",
+			expected: []lib.TaggedSeries{
+				{Name: "company_multi_cluster_issues", Tags: map[string]string{"company": "google_inc_", "period": "y"}, Field: "value"},
+			},
+		},
+		{
+			metric: "multi_row_single_column",
+			name:   "prs,My Repo",
+			period: "w",
+			expected: []lib.TaggedSeries{
+				{Name: "prs", Tags: map[string]string{"name": "my_repo", "period": "w"}, Field: "value"},
+			},
+		},
+		{metric: "multi_row_single_column", name: ",My Repo", period: "w"},
+		{metric: "multi_row_single_column", name: "prs, ", period: "w"},
+		{
+			metric: "multi_row_multi_column",
+			name:   "sig;Apps;issues,prs",
+			period: "q",
+			rowTag: "repo_group",
+			expected: []lib.TaggedSeries{
+				{Name: "sig", Tags: map[string]string{"repo_group": "apps", "period": "q"}, Field: "issues"},
+				{Name: "sig", Tags: map[string]string{"repo_group": "apps", "period": "q"}, Field: "prs"},
+			},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.TagsForMetricsRow(test.metric, test.name, test.period, test.rowTag)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
@@ -4,22 +4,24 @@ import (
 	lib "devstats"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
-	"sort"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
-// Sync all projects from "projects.yaml", calling `gha2db_sync` for all of them
-func syncAllProjects() bool {
-	// Environment context parse
-	var ctx lib.Ctx
-	ctx.Init()
-
-	// Set non-fatal exec mode, we want to run sync for next project(s) if current fails
-	ctx.ExecFatal = false
+// Postgres advisory lock name
+const pgLockName = "devstats"
 
+// readProjects - read projects definitions, returns projects and tools commands prefix
+func readProjects(ctx *lib.Ctx) (lib.AllProjects, string) {
 	// Local or cron mode?
 	cmdPrefix := ""
 	dataPrefix := lib.DataDir
@@ -35,32 +37,94 @@ func syncAllProjects() bool {
 	var projects lib.AllProjects
 	lib.FatalOnError(yaml.Unmarshal(data, &projects))
 
-	// Create PID file (if not exists)
-	// If PID file exists, exit
-	pid := os.Getpid()
-	pidFile := "/tmp/devstats.pid"
-	f, err := os.OpenFile(pidFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0700)
-	if err != nil {
-		lib.Printf("Another `devstats` instance is running, PID file '%s' exists, exiting\n", pidFile)
-		return false
+	// Check projects time zones
+	for name, proj := range projects.Projects {
+		if proj.Timezone != "" {
+			_, err := time.LoadLocation(proj.Timezone)
+			if err != nil {
+				lib.Fatalf("project '%s': invalid timezone '%s': %v", name, proj.Timezone, err)
+			}
+		}
+	}
+	return projects, cmdPrefix
+}
+
+// acquireLocks - acquire lock file and eventual Postgres advisory lock
+// Returns function that releases them, or nil when another instance holds any of them
+func acquireLocks(ctx *lib.Ctx) func() {
+	// Acquire lock file, exit if it is held by another running instance
+	// Lock held by a crashed instance is released by the kernel
+	lock, holder, err := lib.AcquireFileLock(ctx.LockFile)
+	lib.FatalOnError(err)
+	if lock == nil {
+		lib.Printf("Another `devstats` instance is running, lock file '%s' held by %s, exiting\n", ctx.LockFile, holder.String())
+		return nil
 	}
-	fmt.Fprintf(f, "%d", pid)
-	lib.FatalOnError(f.Close())
+	release := func() { lib.FatalOnError(lock.Release()) }
+
+	// Postgres advisory lock, so two hosts sharing the same database cannot sync at the same time
+	if ctx.PgLock {
+		con := lib.PgConn(ctx)
+		pgLock, err := lib.AcquirePgLock(con, pgLockName)
+		lib.FatalOnError(err)
+		if pgLock == nil {
+			pgHolder, err := lib.PgLockHolder(con, pgLockName)
+			lib.FatalOnError(err)
+			lib.Printf("Another `devstats` instance is running, Postgres lock held by %s, exiting\n", pgHolder)
+			lib.FatalOnError(con.Close())
+			release()
+			return nil
+		}
+		releaseFile := release
+		release = func() {
+			lib.FatalOnError(pgLock.Release())
+			lib.FatalOnError(con.Close())
+			releaseFile()
+		}
+	}
+	return release
+}
 
-	// Schedule remove PID file when finished
-	defer func() { lib.FatalOnError(os.Remove(pidFile)) }()
+// Sync all projects from "projects.yaml", calling `gha2db_sync` for all of them
+func syncAllProjects() bool {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
 
-	// Sort projects by "order"
-	orders := []int{}
-	projectsMap := make(map[int]string)
+	// Set non-fatal exec mode, we want to run sync for next project(s) if current fails
+	ctx.ExecFatal = false
+
+	projects, cmdPrefix := readProjects(&ctx)
+	release := acquireLocks(&ctx)
+	if release == nil {
+		return false
+	}
+	defer release()
+	return syncProjects(&ctx, &projects, cmdPrefix, nil, nil, true)
+}
+
+// syncProjects - update git repos (when getRepos is set) and call `gha2db_sync` for given projects
+// All enabled projects are synced when names is empty, env is an additional `gha2db_sync` environment
+func syncProjects(ctx *lib.Ctx, projects *lib.AllProjects, cmdPrefix string, names []string, env map[string]string, getRepos bool) bool {
+	// Projects to sync, they're started by priority and "order"
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := projects.Projects[name]; !ok {
+			lib.Printf("Project '%s' is not defined in '%s', skipping\n", name, ctx.ProjectsYaml)
+			continue
+		}
+		selected[name] = true
+	}
+	toSync := []lib.ProjectSync{}
 	for name, proj := range projects.Projects {
-		if lib.IsProjectDisabled(&ctx, name, proj.Disabled) {
+		if lib.IsProjectDisabled(ctx, name, proj.Disabled) || (len(names) > 0 && !selected[name]) {
 			continue
 		}
-		orders = append(orders, proj.Order)
-		projectsMap[proj.Order] = name
+		toSync = append(
+			toSync,
+			lib.ProjectSync{Name: name, Order: proj.Order, Priority: proj.Priority, CPUs: proj.CPUs},
+		)
 	}
-	sort.Ints(orders)
 
 	// Only run clone/pull part here
 	// Remaining commit analysis in"gha2db_sync"
@@ -68,59 +132,445 @@ func syncAllProjects() bool {
 	// So here we get repo files to the newest state
 	// And the gha2db_sync takes Postgres DB commits to the newest state
 	// after this it need to update commit files
-	lib.Printf("Updating git repos for all projects\n")
-	dtStart := time.Now()
-	_, res := lib.ExecCommand(
-		&ctx,
-		[]string{
-			cmdPrefix + "get_repos",
-		},
-		map[string]string{
-			"GHA2DB_PROCESS_REPOS": "1",
-		},
-	)
-	dtEnd := time.Now()
-	if res != nil {
-		lib.Printf("Error updating git repos (took %v): %+v\n", dtEnd.Sub(dtStart), res)
-		fmt.Fprintf(os.Stderr, "%v: Error updating git repos (took %v): %+v\n", dtEnd, dtEnd.Sub(dtStart), res)
-		return false
-	}
-	lib.Printf("Updated git repos, took: %v\n", dtEnd.Sub(dtStart))
-
-	// Sync all projects
-	for _, order := range orders {
-		name := projectsMap[order]
-		proj := projects.Projects[name]
-		projEnv := map[string]string{
-			"GHA2DB_PROJECT": name,
-			"PG_DB":          proj.PDB,
-			"IDB_DB":         proj.IDB,
-		}
-		// Apply eventual per project specific environment
-		for envName, envValue := range proj.Env {
-			projEnv[envName] = envValue
-		}
-		lib.Printf("Syncing #%d %s\n", order, name)
+	if getRepos {
+		lib.Printf("Updating git repos for all projects\n")
 		dtStart := time.Now()
 		_, res := lib.ExecCommand(
-			&ctx,
+			ctx,
 			[]string{
-				cmdPrefix + "gha2db_sync",
+				cmdPrefix + "get_repos",
+			},
+			map[string]string{
+				"GHA2DB_PROCESS_REPOS": "1",
 			},
-			projEnv,
 		)
 		dtEnd := time.Now()
 		if res != nil {
-			lib.Printf("Error result for %s (took %v): %+v\n", name, dtEnd.Sub(dtStart), res)
-			fmt.Fprintf(os.Stderr, "%v: Error result for %s (took %v): %+v\n", dtEnd, name, dtEnd.Sub(dtStart), res)
+			lib.Printf("Error updating git repos (took %v): %+v\n", dtEnd.Sub(dtStart), res)
+			fmt.Fprintf(os.Stderr, "%v: Error updating git repos (took %v): %+v\n", dtEnd, dtEnd.Sub(dtStart), res)
+			return false
+		}
+		lib.Printf("Updated git repos, took: %v\n", dtEnd.Sub(dtStart))
+	}
+
+	// Sync all projects, GHA2DB_SYNC_PROJECTS at once
+	// Running projects share GHA2DB_SYNC_BUDGET workers (CPUs and DB connections)
+	budget := ctx.SyncBudget
+	if budget <= 0 {
+		budget = lib.GetThreadsNum(ctx)
+	}
+	if budget < 1 {
+		budget = 1
+	}
+	lib.Printf("Syncing %d projects, %d at once, workers budget: %d\n", len(toSync), ctx.SyncProjectsN, budget)
+	results := lib.SyncProjects(
+		toSync,
+		ctx.SyncProjectsN,
+		budget,
+		func(ps *lib.ProjectSync, cpus int) error {
+			name := ps.Name
+			proj := projects.Projects[name]
+			projEnv := map[string]string{
+				"GHA2DB_PROJECT": name,
+				"PG_DB":          proj.PDB,
+				"IDB_DB":         proj.IDB,
+			}
+			if proj.Timezone != "" {
+				projEnv["GHA2DB_TMZONE"] = proj.Timezone
+			}
+			// Apply eventual per project specific environment and then additional environment
+			for envName, envValue := range proj.Env {
+				projEnv[envName] = envValue
+			}
+			for envName, envValue := range env {
+				projEnv[envName] = envValue
+			}
+			// Workers budget is always enforced, use project's "cpus" to change it
+			projEnv["GHA2DB_NCPUS"] = strconv.Itoa(cpus)
+			lib.Printf("Syncing #%d %s (priority %d, cpus %d)\n", ps.Order, name, ps.Priority, cpus)
+			dtStart := time.Now()
+			_, res := lib.ExecCommand(
+				ctx,
+				[]string{
+					cmdPrefix + "gha2db_sync",
+				},
+				projEnv,
+			)
+			dtEnd := time.Now()
+			if res != nil {
+				lib.Printf("Error result for %s (took %v): %+v\n", name, dtEnd.Sub(dtStart), res)
+				fmt.Fprintf(os.Stderr, "%v: Error result for %s (took %v): %+v\n", dtEnd, name, dtEnd.Sub(dtStart), res)
+				return res
+			}
+			lib.Printf("Synced %s, took: %v\n", name, dtEnd.Sub(dtStart))
+			return nil
+		},
+	)
+	summary, failed := lib.SyncProjectsSummary(results)
+	lib.Printf("Projects sync status (%d failed):\n%s", failed, summary)
+
+	// Save project run records (gha2db_sync saves its own records, this one also covers crashed syncs)
+	runs := []lib.SyncRun{}
+	for _, result := range results {
+		run := lib.SyncRun{
+			Prog:     "devstats",
+			Project:  result.Name,
+			Step:     lib.SyncRunStep,
+			Start:    result.Start,
+			End:      result.Start.Add(result.Time),
+			Status:   lib.SyncStepOK,
+			Attempts: 1,
+		}
+		if result.Err != nil {
+			run.Status = lib.SyncStepFailed
+			run.Error = result.Err.Error()
+		}
+		runs = append(runs, run)
+	}
+	err := lib.RecordSyncRuns(ctx, runs)
+	if err != nil {
+		lib.Printf("Error saving sync runs: %v\n", err)
+	}
+	return true
+}
+
+// Report per project sync status: last run, last success, data freshness and failing steps
+// Returns number of projects with problems (failed, failing steps or stale), so it can be used for monitoring
+func syncReport() int {
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read defined projects
+	data, err := ioutil.ReadFile(dataPrefix + ctx.ProjectsYaml)
+	lib.FatalOnError(err)
+	var projects lib.AllProjects
+	lib.FatalOnError(yaml.Unmarshal(data, &projects))
+
+	// Sync runs are stored in `devstats` database
+	dctx := ctx
+	dctx.PgDB = lib.Devstats
+	con := lib.PgConn(&dctx)
+	defer func() { lib.FatalOnError(con.Close()) }()
+
+	statuses := []lib.ProjectSyncStatus{}
+	for name, proj := range projects.Projects {
+		if lib.IsProjectDisabled(&ctx, name, proj.Disabled) {
 			continue
 		}
-		lib.Printf("Synced %s, took: %v\n", name, dtEnd.Sub(dtStart))
+		status, err := lib.GetProjectSyncStatus(con, &dctx, name)
+		lib.FatalOnError(err)
+
+		// Newest GHA event in project's database, report continues when it is not available
+		pcon := lib.PgConnDB(&ctx, proj.PDB)
+		err = lib.QueryRowSQL(pcon, &ctx, "select max(created_at) from gha_events").Scan(&status.LastData)
+		if err != nil {
+			lib.Printf("Cannot get data freshness for %s: %v\n", name, err)
+		}
+		lib.FatalOnError(pcon.Close())
+		statuses = append(statuses, *status)
+	}
+	report, problems := lib.SyncStatusReport(statuses, time.Now(), ctx.MaxSyncAge)
+	fmt.Printf("%s", report)
+	fmt.Printf("%d/%d projects have problems (max sync age %v)\n", problems, len(statuses), ctx.MaxSyncAge)
+	return problems
+}
+
+// Report lock holders (and lock age)
+func lockStatus() {
+	var ctx lib.Ctx
+	ctx.Init()
+	holder, err := lib.ReadFileLock(ctx.LockFile)
+	lib.FatalOnError(err)
+	if holder == nil {
+		fmt.Printf("Lock file '%s': not locked\n", ctx.LockFile)
+	} else {
+		fmt.Printf("Lock file '%s': %s\n", ctx.LockFile, holder.String())
+	}
+	if ctx.PgLock {
+		con := lib.PgConn(&ctx)
+		defer func() { lib.FatalOnError(con.Close()) }()
+		pgHolder, err := lib.PgLockHolder(con, pgLockName)
+		lib.FatalOnError(err)
+		if pgHolder == "" {
+			pgHolder = "not locked"
+		}
+		fmt.Printf("Postgres lock (%s database): %s\n", ctx.PgDB, pgHolder)
+	}
+}
+
+// daemonRun - queued daemon job run, projects (when set) override job's projects
+type daemonRun struct {
+	job      *lib.DaemonJob
+	projects []string
+	reason   string
+}
+
+// daemonState - devstats daemon: jobs schedule, runs queue and status
+type daemonState struct {
+	ctx     *lib.Ctx
+	config  lib.DaemonConfig
+	queue   chan daemonRun
+	mtx     sync.Mutex
+	queued  map[string]bool
+	next    map[string]time.Time
+	running string
+	closed  bool
+}
+
+// enqueue - add job run to the queue, job that is already queued is not added again
+func (d *daemonState) enqueue(run daemonRun) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.closed {
+		return fmt.Errorf("daemon is shutting down")
+	}
+	if d.queued[run.job.Name] {
+		return fmt.Errorf("job '%s' is already queued", run.job.Name)
+	}
+	select {
+	case d.queue <- run:
+	default:
+		return fmt.Errorf("queue is full")
+	}
+	d.queued[run.job.Name] = true
+	lib.Printf("Daemon: queued job '%s' (%s)\n", run.job.Name, run.reason)
+	return nil
+}
+
+// runJobs - run queued jobs one by one, jobs queued when shutting down are dropped
+func (d *daemonState) runJobs(done chan struct{}) {
+	for run := range d.queue {
+		d.mtx.Lock()
+		delete(d.queued, run.job.Name)
+		if d.closed {
+			d.mtx.Unlock()
+			lib.Printf("Daemon: dropped job '%s', shutting down\n", run.job.Name)
+			continue
+		}
+		d.running = run.job.Name
+		d.mtx.Unlock()
+
+		// Projects definitions are read on each run, so changes are used without restart
+		projects, cmdPrefix := readProjects(d.ctx)
+		names := run.job.Projects
+		if len(run.projects) > 0 {
+			names = run.projects
+		}
+		dtStart := time.Now()
+		lib.Printf("Daemon: running job '%s' (%s)\n", run.job.Name, run.reason)
+		syncProjects(d.ctx, &projects, cmdPrefix, names, run.job.SyncEnv(), run.job.GetRepos)
+		lib.Printf("Daemon: job '%s' finished, took: %v\n", run.job.Name, time.Now().Sub(dtStart))
+
+		d.mtx.Lock()
+		d.running = ""
+		d.mtx.Unlock()
+	}
+	close(done)
+}
+
+// triggerHandler - queue a job on demand: /trigger?job=name[&projects=p1,p2]
+func (d *daemonState) triggerHandler(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("job")
+	job := d.config.Job(name)
+	if job == nil {
+		http.Error(w, fmt.Sprintf("unknown job '%s'", name), http.StatusNotFound)
+		return
+	}
+	run := daemonRun{job: job, reason: "trigger from " + req.RemoteAddr}
+	if projects := req.URL.Query().Get("projects"); projects != "" {
+		run.projects = strings.Split(projects, ",")
 	}
+	err := d.enqueue(run)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	fmt.Fprintf(w, "job '%s' queued\n", name)
+}
+
+// statusHandler - jobs, their next scheduled runs and current status
+func (d *daemonState) statusHandler(w http.ResponseWriter, req *http.Request) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, job := range d.config.Jobs {
+		status := "idle"
+		if d.running == job.Name {
+			status = "running"
+		} else if d.queued[job.Name] {
+			status = "queued"
+		}
+		next := "never"
+		if dt := d.next[job.Name]; !dt.IsZero() {
+			next = lib.ToYMDHMSDate(dt)
+		}
+		fmt.Fprintf(w, "%-20s %-16s %-8s next: %s\n", job.Name, job.Schedule.Expr, status, next)
+	}
+}
+
+// runDaemon - long running devstats: run jobs on their schedules and on demand (see GHA2DB_DAEMON_YAML)
+// SIGTERM or SIGINT stops scheduling, currently running job is finished before exit (second signal exits immediately)
+func runDaemon() bool {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Set non-fatal exec mode, we want to run sync for next project(s) if current fails
+	ctx.ExecFatal = false
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read jobs schedule
+	data, err := lib.ReadFile(&ctx, dataPrefix+ctx.DaemonYaml)
+	lib.FatalOnError(err)
+	d := daemonState{
+		ctx:    &ctx,
+		queue:  make(chan daemonRun, 0x40),
+		queued: make(map[string]bool),
+		next:   make(map[string]time.Time),
+	}
+	lib.FatalOnError(yaml.Unmarshal(data, &d.config))
+	lib.FatalOnError(d.config.Prepare())
+
+	// Daemon holds locks for its whole life, so cron `devstats` calls exit immediately
+	release := acquireLocks(&ctx)
+	if release == nil {
+		return false
+	}
+	defer release()
+
+	// Handle signals
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+
+	// Triggers and status server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/trigger", d.triggerHandler)
+	mux.HandleFunc("/status", d.statusHandler)
+	srv := &http.Server{Addr: ctx.DaemonAddr, Handler: mux}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			lib.Printf("Daemon: server error: %v\n", err)
+		}
+	}()
+
+	// Run queued jobs
+	done := make(chan struct{})
+	go d.runJobs(done)
+
+	// Scheduler
+	now := time.Now()
+	d.mtx.Lock()
+	for _, job := range d.config.Jobs {
+		d.next[job.Name] = job.Schedule.Next(now)
+		lib.Printf("Daemon: job '%s' (%s) next run: %v\n", job.Name, job.Schedule.Expr, d.next[job.Name])
+	}
+	d.mtx.Unlock()
+	lib.Printf("Daemon: started, %d jobs, listening on %s\n", len(d.config.Jobs), ctx.DaemonAddr)
+	for running := true; running; {
+		wait := time.Minute
+		d.mtx.Lock()
+		for _, next := range d.next {
+			if !next.IsZero() && next.Sub(now) < wait {
+				wait = next.Sub(now)
+			}
+		}
+		d.mtx.Unlock()
+		select {
+		case sig := <-sigs:
+			lib.Printf("Daemon: received %v, shutting down\n", sig)
+			running = false
+			continue
+		case <-time.After(wait):
+		}
+		now = time.Now()
+		for i := range d.config.Jobs {
+			job := &d.config.Jobs[i]
+			d.mtx.Lock()
+			next := d.next[job.Name]
+			due := !next.IsZero() && !now.Before(next)
+			if due {
+				d.next[job.Name] = job.Schedule.Next(now)
+			}
+			d.mtx.Unlock()
+			if due {
+				err := d.enqueue(daemonRun{job: job, reason: "scheduled " + lib.ToYMDHMSDate(next)})
+				if err != nil {
+					lib.Printf("Daemon: job '%s' not queued: %v\n", job.Name, err)
+				}
+			}
+		}
+	}
+
+	// Graceful shutdown: stop accepting triggers, wait for the current job
+	d.mtx.Lock()
+	d.closed = true
+	close(d.queue)
+	d.mtx.Unlock()
+	lib.FatalOnError(srv.Close())
+	select {
+	case <-done:
+	case sig := <-sigs:
+		lib.Printf("Daemon: received %v again, exiting without waiting for the current job\n", sig)
+		return false
+	}
+	lib.Printf("Daemon: stopped\n")
 	return true
 }
 
+// triggerJob - ask running daemon to run a job now (optionally only for given projects)
+func triggerJob(args []string) bool {
+	var ctx lib.Ctx
+	ctx.Init()
+	if len(args) < 1 {
+		lib.Fatalf("usage: devstats trigger job_name [project1,project2,...]")
+	}
+	query := url.Values{}
+	query.Set("job", args[0])
+	if len(args) > 1 {
+		query.Set("projects", args[1])
+	}
+	resp, err := http.Get("http://" + ctx.DaemonAddr + "/trigger?" + query.Encode())
+	lib.FatalOnError(err)
+	defer func() { lib.FatalOnError(resp.Body.Close()) }()
+	body, err := ioutil.ReadAll(resp.Body)
+	lib.FatalOnError(err)
+	fmt.Printf("%s", body)
+	return resp.StatusCode == http.StatusOK
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "status":
+			lockStatus()
+		case "report":
+			if syncReport() > 0 {
+				os.Exit(1)
+			}
+		case "daemon":
+			if !runDaemon() {
+				os.Exit(1)
+			}
+		case "trigger":
+			if !triggerJob(os.Args[2:]) {
+				os.Exit(1)
+			}
+		default:
+			lib.Fatalf("unknown command '%s', only 'status', 'report', 'daemon' and 'trigger' are supported", os.Args[1])
+		}
+		return
+	}
 	dtStart := time.Now()
 	synced := syncAllProjects()
 	dtEnd := time.Now()
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	lib "devstats"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Serve pipeline health metrics of all enabled projects in Prometheus format
+func metricsHandler(w http.ResponseWriter, req *http.Request) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read defined projects (on each scrape, so changes are visible without restart)
+	data, err := ioutil.ReadFile(dataPrefix + ctx.ProjectsYaml)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var projects lib.AllProjects
+	err = yaml.Unmarshal(data, &projects)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dtStart := time.Now()
+	metrics := lib.CollectPromMetrics(&ctx, &projects)
+	scrape := lib.PromMetric{Name: "devstats_collect_duration_seconds", Help: "Time spent collecting metrics.", Type: "gauge"}
+	scrape.Add(time.Now().Sub(dtStart).Seconds())
+	var buf bytes.Buffer
+	lib.FatalOnError(lib.WritePromMetrics(&buf, append(metrics, scrape)))
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(buf.Bytes())
+}
+
+func main() {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Start metrics server
+	// ExporterAddr defaults to ":9292"
+	// ExporterPath defaults to "/metrics"
+	http.HandleFunc(ctx.ExporterPath, metricsHandler)
+	lib.Printf("Serving metrics on %s%s\n", ctx.ExporterAddr, ctx.ExporterPath)
+	lib.FatalOnError(http.ListenAndServe(ctx.ExporterAddr, nil))
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -17,64 +18,64 @@ import (
 )
 
 // Inserts single GHA Actor
-func ghaActor(con *sql.Tx, ctx *lib.Ctx, actor *lib.Actor) {
+func ghaActor(con *lib.PgWriter, ctx *lib.Ctx, actor *lib.Actor) {
 	// gha_actors
 	// {"id:Fixnum"=>48592, "login:String"=>48592, "display_login:String"=>48592,
 	// "gravatar_id:String"=>48592, "url:String"=>48592, "avatar_url:String"=>48592}
 	// {"id"=>8, "login"=>34, "display_login"=>34, "gravatar_id"=>0, "url"=>63, "avatar_url"=>49}
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		lib.InsertIgnore("into gha_actors(id, login, name) "+lib.NValues(3)),
+		true,
+		"into gha_actors(id, login, name)",
 		lib.AnyArray{actor.ID, actor.Login, ""}...,
 	)
 }
 
 // Inserts single GHA Repo
-func ghaRepo(db *sql.DB, ctx *lib.Ctx, repo *lib.Repo, orgID, orgLogin interface{}) {
+func ghaRepo(con *lib.PgWriter, ctx *lib.Ctx, repo *lib.Repo, orgID, orgLogin interface{}) {
 	// gha_repos
 	// {"id:Fixnum"=>48592, "name:String"=>48592, "url:String"=>48592}
 	// {"id"=>8, "name"=>111, "url"=>140}
-	lib.ExecSQLWithErr(
-		db,
+	con.Insert(
 		ctx,
-		lib.InsertIgnore("into gha_repos(id, name, org_id, org_login) "+lib.NValues(4)),
+		true,
+		"into gha_repos(id, name, org_id, org_login)",
 		lib.AnyArray{repo.ID, repo.Name, orgID, orgLogin}...,
 	)
 }
 
 // Inserts single GHA Org
-func ghaOrg(db *sql.DB, ctx *lib.Ctx, org *lib.Org) {
+func ghaOrg(con *lib.PgWriter, ctx *lib.Ctx, org *lib.Org) {
 	// gha_orgs
 	// {"id:Fixnum"=>18494, "login:String"=>18494, "gravatar_id:String"=>18494,
 	// "url:String"=>18494, "avatar_url:String"=>18494}
 	// {"id"=>8, "login"=>38, "gravatar_id"=>0, "url"=>66, "avatar_url"=>49}
 	if org != nil {
-		lib.ExecSQLWithErr(
-			db,
+		con.Insert(
 			ctx,
-			lib.InsertIgnore("into gha_orgs(id, login) "+lib.NValues(2)),
+			true,
+			"into gha_orgs(id, login)",
 			lib.AnyArray{org.ID, org.Login}...,
 		)
 	}
 }
 
 // Inserts single GHA Milestone
-func ghaMilestone(con *sql.Tx, ctx *lib.Ctx, eid string, milestone *lib.Milestone, ev *lib.Event) {
+func ghaMilestone(con *lib.PgWriter, ctx *lib.Ctx, eid string, milestone *lib.Milestone, ev *lib.Event) {
 	// creator
 	if milestone.Creator != nil {
 		ghaActor(con, ctx, milestone.Creator)
 	}
 
 	// gha_milestones
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_milestones("+
+		false,
+		"into gha_milestones("+
 			"id, event_id, closed_at, closed_issues, created_at, creator_id, "+
 			"description, due_on, number, open_issues, state, title, updated_at, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-			"dupn_creator_login) "+lib.NValues(20),
+			"dupn_creator_login)",
 		lib.AnyArray{
 			milestone.ID,
 			eid,
@@ -101,10 +102,10 @@ func ghaMilestone(con *sql.Tx, ctx *lib.Ctx, eid string, milestone *lib.Mileston
 }
 
 // Inserts single GHA Forkee (old format < 2015)
-func ghaForkeeOld(con *sql.Tx, ctx *lib.Ctx, eid string, forkee *lib.ForkeeOld, actor *lib.Actor, repo *lib.Repo, ev *lib.EventOld) {
+func ghaForkeeOld(con *lib.PgWriter, ctx *lib.Ctx, eid string, forkee *lib.ForkeeOld, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
 
 	// Lookup author by GitHub login
-	aid := lookupActorTx(con, ctx, forkee.Owner)
+	aid := lookupActor(con, ctx, forkee.Owner)
 
 	// Owner
 	owner := lib.Actor{ID: aid, Login: forkee.Owner}
@@ -112,16 +113,16 @@ func ghaForkeeOld(con *sql.Tx, ctx *lib.Ctx, eid string, forkee *lib.ForkeeOld,
 
 	// gha_forkees
 	// Table details and analysis in `analysis/analysis.txt` and `analysis/forkee_*.json`
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_forkees("+
+		false,
+		"into gha_forkees("+
 			"id, event_id, name, full_name, owner_id, description, fork, "+
 			"created_at, updated_at, pushed_at, homepage, size, language, organization, "+
 			"stargazers_count, has_issues, has_projects, has_downloads, "+
 			"has_wiki, has_pages, forks, default_branch, open_issues, watchers, public, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-			"dup_owner_login) "+lib.NValues(32),
+			"dup_owner_login)",
 		lib.AnyArray{
 			forkee.ID,
 			eid,
@@ -152,30 +153,30 @@ func ghaForkeeOld(con *sql.Tx, ctx *lib.Ctx, eid string, forkee *lib.ForkeeOld,
 			actor.Login,
 			repo.ID,
 			repo.Name,
-			ev.Type,
-			ev.CreatedAt,
+			eType,
+			eCreatedAt,
 			owner.Login,
 		}...,
 	)
 }
 
 // Inserts single GHA Forkee
-func ghaForkee(con *sql.Tx, ctx *lib.Ctx, eid string, forkee *lib.Forkee, ev *lib.Event) {
+func ghaForkee(con *lib.PgWriter, ctx *lib.Ctx, eid string, forkee *lib.Forkee, ev *lib.Event) {
 	// owner
 	ghaActor(con, ctx, &forkee.Owner)
 
 	// gha_forkees
 	// Table details and analysis in `analysis/analysis.txt` and `analysis/forkee_*.json`
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_forkees("+
+		false,
+		"into gha_forkees("+
 			"id, event_id, name, full_name, owner_id, description, fork, "+
 			"created_at, updated_at, pushed_at, homepage, size, language, organization, "+
 			"stargazers_count, has_issues, has_projects, has_downloads, "+
 			"has_wiki, has_pages, forks, default_branch, open_issues, watchers, public, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-			"dup_owner_login) "+lib.NValues(32),
+			"dup_owner_login)",
 		lib.AnyArray{
 			forkee.ID,
 			eid,
@@ -214,7 +215,7 @@ func ghaForkee(con *sql.Tx, ctx *lib.Ctx, eid string, forkee *lib.Forkee, ev *li
 }
 
 // Inserts single GHA Branch
-func ghaBranch(con *sql.Tx, ctx *lib.Ctx, eid string, branch *lib.Branch, ev *lib.Event, skipIDs []int) {
+func ghaBranch(con *lib.PgWriter, ctx *lib.Ctx, eid string, branch *lib.Branch, ev *lib.Event, skipIDs []int) {
 	// user
 	if branch.User != nil {
 		ghaActor(con, ctx, branch.User)
@@ -236,13 +237,13 @@ func ghaBranch(con *sql.Tx, ctx *lib.Ctx, eid string, branch *lib.Branch, ev *li
 	}
 
 	// gha_branches
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_branches("+
+		false,
+		"into gha_branches("+
 			"sha, event_id, user_id, repo_id, label, ref, "+
 			"dup_type, dup_created_at, dupn_user_login, dupn_forkee_name"+
-			") "+lib.NValues(10),
+			")",
 		lib.AnyArray{
 			branch.SHA,
 			eid,
@@ -260,9 +261,9 @@ func ghaBranch(con *sql.Tx, ctx *lib.Ctx, eid string, branch *lib.Branch, ev *li
 
 // Search for given label using name & color
 // If not found, return hash as its ID
-func lookupLabel(con *sql.Tx, ctx *lib.Ctx, name string, color string) int {
-	rows := lib.QuerySQLTxWithErr(
-		con,
+func lookupLabel(con *lib.PgWriter, ctx *lib.Ctx, name string, color string) int {
+	con.FlushIfPending(ctx, "gha_labels")
+	rows := con.Query(
 		ctx,
 		fmt.Sprintf(
 			"select id from gha_labels where name=%s and color=%s",
@@ -286,30 +287,9 @@ func lookupLabel(con *sql.Tx, ctx *lib.Ctx, name string, color string) int {
 
 // Search for given actor using his/her login
 // If not found, return hash as its ID
-func lookupActor(db *sql.DB, ctx *lib.Ctx, login string) int {
-	rows := lib.QuerySQLWithErr(
-		db,
-		ctx,
-		fmt.Sprintf("select id from gha_actors where login=%s", lib.NValue(1)),
-		login,
-	)
-	defer func() { lib.FatalOnError(rows.Close()) }()
-	aid := 0
-	for rows.Next() {
-		lib.FatalOnError(rows.Scan(&aid))
-	}
-	lib.FatalOnError(rows.Err())
-	if aid == 0 {
-		aid = lib.HashStrings([]string{login})
-	}
-	return aid
-}
-
-// Search for given actor using his/her login
-// If not found, return hash as its ID
-func lookupActorTx(con *sql.Tx, ctx *lib.Ctx, login string) int {
-	rows := lib.QuerySQLTxWithErr(
-		con,
+func lookupActor(con *lib.PgWriter, ctx *lib.Ctx, login string) int {
+	con.FlushIfPending(ctx, "gha_actors")
+	rows := con.Query(
 		ctx,
 		fmt.Sprintf("select id from gha_actors where login=%s", lib.NValue(1)),
 		login,
@@ -327,11 +307,11 @@ func lookupActorTx(con *sql.Tx, ctx *lib.Ctx, login string) int {
 }
 
 // Try to find Repo by name and Organization
-func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *int) (int, bool) {
+func findRepoFromNameAndOrg(con *lib.PgWriter, ctx *lib.Ctx, repoName string, orgID *int) (int, bool) {
 	var rows *sql.Rows
+	con.FlushIfPending(ctx, "gha_repos")
 	if orgID != nil {
-		rows = lib.QuerySQLWithErr(
-			db,
+		rows = con.Query(
 			ctx,
 			fmt.Sprintf(
 				"select id from gha_repos where name=%s and org_id=%s",
@@ -342,8 +322,7 @@ func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *in
 			orgID,
 		)
 	} else {
-		rows = lib.QuerySQLWithErr(
-			db,
+		rows = con.Query(
 			ctx,
 			fmt.Sprintf(
 				"select id from gha_repos where name=%s and org_id is null",
@@ -364,13 +343,13 @@ func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *in
 }
 
 // Try to find OrgID for given OrgLogin (returns nil for nil)
-func findOrgIDOrNil(db *sql.DB, ctx *lib.Ctx, orgLogin *string) *int {
+func findOrgIDOrNil(con *lib.PgWriter, ctx *lib.Ctx, orgLogin *string) *int {
 	var orgID int
 	if orgLogin == nil {
 		return nil
 	}
-	rows := lib.QuerySQLWithErr(
-		db,
+	con.FlushIfPending(ctx, "gha_orgs")
+	rows := con.Query(
 		ctx,
 		fmt.Sprintf(
 			"select id from gha_orgs where login=%s",
@@ -388,8 +367,12 @@ func findOrgIDOrNil(db *sql.DB, ctx *lib.Ctx, orgLogin *string) *int {
 }
 
 // Check if given event existis (given by ID)
-func eventExists(db *sql.DB, ctx *lib.Ctx, eventID string) bool {
-	rows := lib.QuerySQLWithErr(db, ctx, fmt.Sprintf("select 1 from gha_events where id=%s", lib.NValue(1)), eventID)
+// In batch mode events queued since the last flush are not in the DB yet
+func eventExists(con *lib.PgWriter, ctx *lib.Ctx, eventID string) bool {
+	if con.HasKey(eventID) {
+		return true
+	}
+	rows := con.Query(ctx, fmt.Sprintf("select 1 from gha_events where id=%s", lib.NValue(1)), eventID)
 	defer func() { lib.FatalOnError(rows.Close()) }()
 	exists := false
 	for rows.Next() {
@@ -404,20 +387,19 @@ func eventExists(db *sql.DB, ctx *lib.Ctx, eventID string) bool {
 // "action:String"=>370, "sha:String"=>370, "html_url:String"=>370}
 // {"page_name"=>65, "title"=>65, "summary"=>0, "action"=>7, "sha"=>40, "html_url"=>130}
 // 370
-func ghaPages(con *sql.Tx, ctx *lib.Ctx, payloadPages *[]lib.Page, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
+func ghaPages(con *lib.PgWriter, ctx *lib.Ctx, payloadPages *[]lib.Page, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
 	pages := []lib.Page{}
 	if payloadPages != nil {
 		pages = *payloadPages
 	}
 	for _, page := range pages {
 		sha := page.SHA
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			lib.InsertIgnore(
-				"into gha_pages(sha, event_id, action, title, "+
-					"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-					") "+lib.NValues(10)),
+			true,
+			"into gha_pages(sha, event_id, action, title, "+
+				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
+				")",
 			lib.AnyArray{
 				sha,
 				eventID,
@@ -436,7 +418,7 @@ func ghaPages(con *sql.Tx, ctx *lib.Ctx, payloadPages *[]lib.Page, eventID strin
 
 // gha_comments
 // Table details and analysis in `analysis/analysis.txt` and `analysis/comment_*.json`
-func ghaComment(con *sql.Tx, ctx *lib.Ctx, payloadComment *lib.Comment, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
+func ghaComment(con *lib.PgWriter, ctx *lib.Ctx, payloadComment *lib.Comment, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
 	if payloadComment == nil {
 		return
 	}
@@ -447,17 +429,15 @@ func ghaComment(con *sql.Tx, ctx *lib.Ctx, payloadComment *lib.Comment, eventID
 
 	// comment
 	cid := comment.ID
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		lib.InsertIgnore(
-			"into gha_comments("+
-				"id, event_id, body, created_at, updated_at, user_id, "+
-				"commit_id, original_commit_id, diff_hunk, position, "+
-				"original_position, path, pull_request_review_id, line, "+
-				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_user_login) "+lib.NValues(21),
-		),
+		true,
+		"into gha_comments("+
+			"id, event_id, body, created_at, updated_at, user_id, "+
+			"commit_id, original_commit_id, diff_hunk, position, "+
+			"original_position, path, pull_request_review_id, line, "+
+			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
+			"dup_user_login)",
 		lib.AnyArray{
 			cid,
 			eventID,
@@ -484,9 +464,50 @@ func ghaComment(con *sql.Tx, ctx *lib.Ctx, payloadComment *lib.Comment, eventID
 	)
 }
 
+// gha_reviews
+// PR review from PullRequestReviewEvent, state is stored lowercase (approved, changes_requested, commented, dismissed)
+func ghaReview(con *lib.PgWriter, ctx *lib.Ctx, payloadReview *lib.Review, payloadPullRequest *lib.PullRequest, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
+	if payloadReview == nil || payloadPullRequest == nil {
+		return
+	}
+	review := *payloadReview
+
+	// user
+	ghaActor(con, ctx, &review.User)
+
+	// review
+	con.Insert(
+		ctx,
+		true,
+		"into gha_reviews("+
+			"id, event_id, pull_request_id, user_id, commit_id, submitted_at, state, body, author_association, "+
+			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
+			"dup_user_login, dup_pull_request_number)",
+		lib.AnyArray{
+			review.ID,
+			eventID,
+			payloadPullRequest.ID,
+			review.User.ID,
+			lib.StringOrNil(review.CommitID),
+			lib.TimeOrNil(review.SubmittedAt),
+			strings.ToLower(review.State),
+			lib.TruncStringOrNil(review.Body, 0xffff),
+			lib.StringOrNil(review.AuthorAssociation),
+			actor.ID,
+			actor.Login,
+			repo.ID,
+			repo.Name,
+			eType,
+			eCreatedAt,
+			review.User.Login,
+			payloadPullRequest.Number,
+		}...,
+	)
+}
+
 // gha_releases
 // Table details and analysis in `analysis/analysis.txt` and `analysis/release_*.json`
-func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
+func ghaRelease(con *lib.PgWriter, ctx *lib.Ctx, payloadRelease *lib.Release, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
 	if payloadRelease == nil {
 		return
 	}
@@ -497,14 +518,14 @@ func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID
 
 	// release
 	rid := release.ID
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_releases("+
+		false,
+		"into gha_releases("+
 			"id, event_id, tag_name, target_commitish, name, draft, "+
 			"author_id, prerelease, created_at, published_at, body, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-			"dup_author_login) "+lib.NValues(18),
+			"dup_author_login)",
 		lib.AnyArray{
 			rid,
 			eventID,
@@ -534,14 +555,14 @@ func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID
 
 		// asset
 		aid := asset.ID
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_assets("+
+			false,
+			"into gha_assets("+
 				"id, event_id, name, label, uploader_id, content_type, "+
 				"state, size, download_count, created_at, updated_at, "+
 				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_uploader_login) "+lib.NValues(18),
+				"dup_uploader_login)",
 			lib.AnyArray{
 				aid,
 				eventID,
@@ -565,10 +586,10 @@ func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID
 		)
 
 		// release-asset connection
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_releases_assets(release_id, event_id, asset_id) "+lib.NValues(3),
+			false,
+			"into gha_releases_assets(release_id, event_id, asset_id)",
 			lib.AnyArray{rid, eventID, aid}...,
 		)
 	}
@@ -576,7 +597,7 @@ func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID
 
 // gha_pull_requests
 // Table details and analysis in `analysis/analysis.txt` and `analysis/pull_request_*.json`
-func ghaPullRequest(con *sql.Tx, ctx *lib.Ctx, payloadPullRequest *lib.PullRequest, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time, forkeeIDsToSkip []int) {
+func ghaPullRequest(con *lib.PgWriter, ctx *lib.Ctx, payloadPullRequest *lib.PullRequest, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time, forkeeIDsToSkip []int) {
 	if payloadPullRequest == nil {
 		return
 	}
@@ -622,16 +643,16 @@ func ghaPullRequest(con *sql.Tx, ctx *lib.Ctx, payloadPullRequest *lib.PullReque
 
 	// pull_request
 	prid := pr.ID
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_pull_requests("+
+		false,
+		"into gha_pull_requests("+
 			"id, event_id, user_id, base_sha, head_sha, merged_by_id, assignee_id, milestone_id, "+
 			"number, state, locked, title, body, created_at, updated_at, closed_at, merged_at, "+
 			"merge_commit_sha, merged, mergeable, rebaseable, mergeable_state, comments, "+
 			"review_comments, maintainer_can_modify, commits, additions, deletions, changed_files, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-			"dup_user_login, dupn_assignee_login, dupn_merged_by_login) "+lib.NValues(38),
+			"dup_user_login, dupn_assignee_login, dupn_merged_by_login)",
 		lib.AnyArray{
 			prid,
 			eventID,
@@ -698,10 +719,10 @@ func ghaPullRequest(con *sql.Tx, ctx *lib.Ctx, payloadPullRequest *lib.PullReque
 		ghaActor(con, ctx, &assignee)
 
 		// pull_request-assignee connection
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_pull_requests_assignees(pull_request_id, event_id, assignee_id) "+lib.NValues(3),
+			false,
+			"into gha_pull_requests_assignees(pull_request_id, event_id, assignee_id)",
 			lib.AnyArray{prid, eventID, assignee.ID}...,
 		)
 	}
@@ -713,10 +734,10 @@ func ghaPullRequest(con *sql.Tx, ctx *lib.Ctx, payloadPullRequest *lib.PullReque
 			ghaActor(con, ctx, &reviewer)
 
 			// pull_request-requested_reviewer connection
-			lib.ExecSQLTxWithErr(
-				con,
+			con.Insert(
 				ctx,
-				"insert into gha_pull_requests_requested_reviewers(pull_request_id, event_id, requested_reviewer_id) "+lib.NValues(3),
+				false,
+				"into gha_pull_requests_requested_reviewers(pull_request_id, event_id, requested_reviewer_id)",
 				lib.AnyArray{prid, eventID, reviewer.ID}...,
 			)
 		}
@@ -724,7 +745,7 @@ func ghaPullRequest(con *sql.Tx, ctx *lib.Ctx, payloadPullRequest *lib.PullReque
 }
 
 // gha_teams
-func ghaTeam(con *sql.Tx, ctx *lib.Ctx, payloadTeam *lib.Team, payloadRepo *lib.Forkee, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
+func ghaTeam(con *lib.PgWriter, ctx *lib.Ctx, payloadTeam *lib.Team, payloadRepo *lib.Forkee, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time) {
 	if payloadTeam == nil {
 		return
 	}
@@ -732,13 +753,13 @@ func ghaTeam(con *sql.Tx, ctx *lib.Ctx, payloadTeam *lib.Team, payloadRepo *lib.
 
 	// team
 	tid := team.ID
-	lib.ExecSQLTxWithErr(
-		con,
+	con.Insert(
 		ctx,
-		"insert into gha_teams("+
+		false,
+		"into gha_teams("+
 			"id, event_id, name, slug, permission, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-			") "+lib.NValues(11),
+			")",
 		lib.AnyArray{
 			tid,
 			eventID,
@@ -756,293 +777,58 @@ func ghaTeam(con *sql.Tx, ctx *lib.Ctx, payloadTeam *lib.Team, payloadRepo *lib.
 
 	// team-repository connection
 	if payloadRepo != nil {
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_teams_repositories(team_id, event_id, repository_id) "+lib.NValues(3),
+			false,
+			"into gha_teams_repositories(team_id, event_id, repository_id)",
 			lib.AnyArray{tid, eventID, payloadRepo.ID}...,
 		)
 	}
 }
 
-// Write GHA entire event (in old pre 2015 format) into Postgres DB
-func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld) int {
-	if eventExists(db, ctx, eventID) {
-		return 0
-	}
+// resolveEventOld - find IDs of pre 2015 event's actor, organization and repository
+// Actor ID is looked up by login, organization and repository IDs are taken from already imported data (if found)
+func resolveEventOld(con *lib.PgWriter, ctx *lib.Ctx, ev *lib.NormEvent) {
+	repository := ev.RepositoryOld
 
 	// Lookup author by GitHub login
-	aid := lookupActor(db, ctx, ev.Actor)
-	actor := lib.Actor{ID: aid, Login: ev.Actor}
-
-	// Repository
-	repository := ev.Repository
+	ev.Actor.ID = lookupActor(con, ctx, ev.Actor.Login)
 
 	// Find Org ID from Repository.Organization
-	oid := findOrgIDOrNil(db, ctx, repository.Organization)
-
-	// Find Repo ID from Repository (this is a ForkeeOld before 2015).
-	rid, ok := findRepoFromNameAndOrg(db, ctx, repository.Name, oid)
-	if !ok {
-		rid = repository.ID
+	// Org not found keeps its login hash as ID, it is only used for gha_orgs and gha_repos
+	oid := findOrgIDOrNil(con, ctx, repository.Organization)
+	if oid != nil {
+		ev.Org = &lib.Org{ID: *oid, Login: *repository.Organization}
+		ev.OrgHashID = false
 	}
 
-	// We defer transaction create until we're inserting data that can be shared between different events
-	lib.ExecSQLWithErr(
-		db,
-		ctx,
-		"insert into gha_events("+
-			"id, type, actor_id, repo_id, public, created_at, "+
-			"dup_actor_login, dup_repo_name, org_id, forkee_id) "+lib.NValues(10),
-		lib.AnyArray{
-			eventID,
-			ev.Type,
-			aid,
-			rid,
-			ev.Public,
-			ev.CreatedAt,
-			ev.Actor,
-			ev.Repository.Name,
-			oid,
-			ev.Repository.ID,
-		}...,
-	)
-
-	// Organization
-	if repository.Organization != nil {
-		if oid == nil {
-			h := lib.HashStrings([]string{*repository.Organization})
-			oid = &h
-		}
-		ghaOrg(db, ctx, &lib.Org{ID: *oid, Login: *repository.Organization})
+	// Find Repo ID from Repository (this is a ForkeeOld before 2015).
+	rid, ok := findRepoFromNameAndOrg(con, ctx, repository.Name, oid)
+	if ok {
+		ev.Repo.ID = rid
 	}
+}
 
-	// Add Repository
-	repo := lib.Repo{ID: rid, Name: repository.Name}
-	ghaRepo(db, ctx, &repo, oid, repository.Organization)
-
-	// Pre 2015 Payload
-	pl := ev.Payload
-	if pl == nil {
+// Write entire GHA event (in canonical format, see lib.NormalizeEvent and lib.NormalizeEventOld) into Postgres DB
+func writeEvent(con *lib.PgWriter, ctx *lib.Ctx, ev *lib.NormEvent) int {
+	if !lib.EventTypeHit(ctx, ev.Type) {
 		return 0
 	}
-
-	iid := lib.FirstIntOrNil([]*int{pl.Issue, pl.IssueID})
-	cid := lib.CommentIDOrNil(pl.Comment)
-	if cid == nil {
-		cid = lib.IntOrNil(pl.CommentID)
-	}
-
-	lib.ExecSQLWithErr(
-		db,
-		ctx,
-		"insert into gha_payloads("+
-			"event_id, push_id, size, ref, head, befor, action, "+
-			"issue_id, pull_request_id, comment_id, ref_type, master_branch, commit, "+
-			"description, number, forkee_id, release_id, member_id, "+
-			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-			") "+lib.NValues(24),
-		lib.AnyArray{
-			eventID,
-			nil,
-			lib.IntOrNil(pl.Size),
-			lib.TruncStringOrNil(pl.Ref, 200),
-			lib.StringOrNil(pl.Head),
-			nil,
-			lib.StringOrNil(pl.Action),
-			iid,
-			lib.PullRequestIDOrNil(pl.PullRequest),
-			cid,
-			lib.StringOrNil(pl.RefType),
-			lib.TruncStringOrNil(pl.MasterBranch, 200),
-			lib.StringOrNil(pl.Commit),
-			lib.TruncStringOrNil(pl.Description, 0xffff),
-			lib.IntOrNil(pl.Number),
-			lib.ForkeeIDOrNil(pl.Repository),
-			lib.ReleaseIDOrNil(pl.Release),
-			lib.ActorIDOrNil(pl.Member),
-			actor.ID,
-			actor.Login,
-			repo.ID,
-			repo.Name,
-			ev.Type,
-			ev.CreatedAt,
-		}...,
-	)
-
-	// Start transaction for data possibly shared between events
-	con, err := db.Begin()
-	lib.FatalOnError(err)
-
-	// gha_actors
-	ghaActor(con, ctx, &actor)
-
-	// Payload's Forkee (it uses new structure, so I'm giving it precedence over
-	// Event's Forkee (which uses older structure)
-	if pl.Repository != nil {
-		// Reposotory is actually a Forkee (non old in this case!)
-		// Artificial event is only used to allow duplicating EventOld's data
-		// (passed as Event to avoid code duplication)
-		artificialEv := lib.Event{Actor: actor, Repo: repo, Type: ev.Type, CreatedAt: ev.CreatedAt}
-		ghaForkee(con, ctx, eventID, pl.Repository, &artificialEv)
-	}
-
-	// Add Forkee in old mode if we didn't added it from payload or if it is a different Forkee
-	if pl.Repository == nil || pl.Repository.ID != ev.Repository.ID {
-		ghaForkeeOld(con, ctx, eventID, &ev.Repository, &actor, &repo, ev)
-	}
-
-	// SHAs - commits
-	if pl.SHAs != nil {
-		commits := *pl.SHAs
-		for _, comm := range commits {
-			commit, ok := comm.([]interface{})
-			if !ok {
-				lib.Fatalf("comm is not []interface{}: %+v", comm)
-			}
-			sha, ok := commit[0].(string)
-			if !ok {
-				lib.Fatalf("commit[0] is not string: %+v", commit[0])
-			}
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				"insert into gha_commits("+
-					"sha, event_id, author_name, message, is_distinct, "+
-					"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-					") "+lib.NValues(11),
-				lib.AnyArray{
-					sha,
-					eventID,
-					lib.TruncToBytes(commit[3].(string), 160),
-					lib.TruncToBytes(commit[2].(string), 0xffff),
-					commit[4].(bool),
-					actor.ID,
-					actor.Login,
-					repo.ID,
-					repo.Name,
-					ev.Type,
-					ev.CreatedAt,
-				}...,
-			)
-		}
-	}
-
-	// Pages
-	ghaPages(con, ctx, pl.Pages, eventID, &actor, &repo, ev.Type, ev.CreatedAt)
-
-	// Member
-	if pl.Member != nil {
-		ghaActor(con, ctx, pl.Member)
-	}
-
-	// Comment
-	ghaComment(con, ctx, pl.Comment, eventID, &actor, &repo, ev.Type, ev.CreatedAt)
-
-	// Release & assets
-	ghaRelease(con, ctx, pl.Release, eventID, &actor, &repo, ev.Type, ev.CreatedAt)
-
-	// Team & Repo connection
-	ghaTeam(con, ctx, pl.Team, pl.Repository, eventID, &actor, &repo, ev.Type, ev.CreatedAt)
-
-	// Pull Request
-	forkeeIDsToSkip := []int{ev.Repository.ID}
-	if pl.Repository != nil {
-		forkeeIDsToSkip = append(forkeeIDsToSkip, pl.Repository.ID)
-	}
-	ghaPullRequest(con, ctx, pl.PullRequest, eventID, &actor, &repo, ev.Type, ev.CreatedAt, forkeeIDsToSkip)
-
-	// We need artificial issue
-	// gha_issues
-	// Table details and analysis in `analysis/analysis.txt` and `analysis/issue_*.json`
-	if pl.PullRequest != nil {
-		pr := *pl.PullRequest
-
-		// issue
-		iid = -pr.ID
-		isPR := true
-		comments := 0
-		locked := false
-		if pr.Comments != nil {
-			comments = *pr.Comments
-		}
-		if pr.Locked != nil {
-			locked = *pr.Locked
-		}
-		lib.ExecSQLTxWithErr(
-			con,
-			ctx,
-			"insert into gha_issues("+
-				"id, event_id, assignee_id, body, closed_at, comments, created_at, "+
-				"locked, milestone_id, number, state, title, updated_at, user_id, "+
-				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_user_login, dupn_assignee_login, is_pull_request) "+lib.NValues(23),
-			lib.AnyArray{
-				iid,
-				eventID,
-				lib.ActorIDOrNil(pr.Assignee),
-				lib.TruncStringOrNil(pr.Body, 0xffff),
-				lib.TimeOrNil(pr.ClosedAt),
-				comments,
-				pr.CreatedAt,
-				locked,
-				lib.MilestoneIDOrNil(pr.Milestone),
-				pr.Number,
-				pr.State,
-				pr.Title,
-				pr.UpdatedAt,
-				pr.User.ID,
-				actor.ID,
-				actor.Login,
-				repo.ID,
-				repo.Name,
-				ev.Type,
-				ev.CreatedAt,
-				pr.User.Login,
-				lib.ActorLoginOrNil(pr.Assignee),
-				isPR,
-			}...,
-		)
-
-		var assignees []lib.Actor
-
-		prAid := lib.ActorIDOrNil(pr.Assignee)
-		if pr.Assignee != nil {
-			assignees = append(assignees, *pr.Assignee)
-		}
-
-		if pr.Assignees != nil {
-			for _, assignee := range *pr.Assignees {
-				aid := assignee.ID
-				if aid == prAid {
-					continue
-				}
-				assignees = append(assignees, assignee)
-			}
-		}
-
-		for _, assignee := range assignees {
-			// pull_request-assignee connection
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				"insert into gha_issues_assignees(issue_id, event_id, assignee_id) "+lib.NValues(3),
-				lib.AnyArray{iid, eventID, assignee.ID}...,
-			)
-		}
-	}
-
-	// Final commit
-	lib.FatalOnError(con.Commit())
-	return 1
-}
-
-// Write entire GHA event (in a new 2015+ format) into Postgres DB
-func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	eventID := ev.ID
-	if eventExists(db, ctx, eventID) {
+	if eventExists(con, ctx, eventID) {
 		return 0
 	}
+	// In batch mode all event's rows are queued together, so event is either written entirely or not at all
+	con.BeginEvent()
+	defer con.EndEvent(ctx)
+	con.AddKey(eventID)
+
+	// Pre 2015 event's repository is also a forkee
+	var forkeeID interface{}
+	if ev.RepositoryOld != nil {
+		resolveEventOld(con, ctx, ev)
+		forkeeID = ev.RepositoryOld.ID
+	}
 
 	// We defer transaction create until we're inserting data that can be shared between different events
 	// gha_events
@@ -1053,12 +839,12 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	// "created_at"=>20, "org"=>230}
 	// Fields dup_actor_login, dup_repo_name are copied from (gha_actors and gha_repos) to save
 	// joins on complex queries (MySQL has no hash joins and is very slow on big tables joins)
-	lib.ExecSQLWithErr(
-		db,
+	con.Insert(
 		ctx,
-		"insert into gha_events("+
+		false,
+		"into gha_events("+
 			"id, type, actor_id, repo_id, public, created_at, "+
-			"dup_actor_login, dup_repo_name, org_id, forkee_id) "+lib.NValues(10),
+			"dup_actor_login, dup_repo_name, org_id, forkee_id)",
 		lib.AnyArray{
 			eventID,
 			ev.Type,
@@ -1068,19 +854,25 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 			ev.CreatedAt,
 			ev.Actor.Login,
 			ev.Repo.Name,
-			lib.OrgIDOrNil(ev.Org),
-			nil,
+			ev.EventOrgID(),
+			forkeeID,
 		}...,
 	)
 
 	// Repository
 	repo := ev.Repo
 	org := ev.Org
-	ghaRepo(db, ctx, &repo, lib.OrgIDOrNil(org), lib.OrgLoginOrNil(org))
+	ghaRepo(con, ctx, &repo, lib.OrgIDOrNil(org), lib.OrgLoginOrNil(org))
 
 	// Organization
 	if org != nil {
-		ghaOrg(db, ctx, org)
+		ghaOrg(con, ctx, org)
+	}
+
+	// Pre 2015 events can have no payload
+	pl := ev.Payload
+	if pl == nil {
+		return 0
 	}
 
 	// gha_payloads
@@ -1098,16 +890,15 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	// 48746
 	// using exec_stmt (without select), because payload are per event_id.
 	// Columns duplicated from gha_events starts with "dup_"
-	pl := ev.Payload
-	lib.ExecSQLWithErr(
-		db,
+	con.Insert(
 		ctx,
-		"insert into gha_payloads("+
+		false,
+		"into gha_payloads("+
 			"event_id, push_id, size, ref, head, befor, action, "+
 			"issue_id, pull_request_id, comment_id, ref_type, master_branch, commit, "+
 			"description, number, forkee_id, release_id, member_id, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-			") "+lib.NValues(24),
+			")",
 		lib.AnyArray{
 			eventID,
 			lib.IntOrNil(pl.PushID),
@@ -1116,12 +907,12 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 			lib.StringOrNil(pl.Head),
 			lib.StringOrNil(pl.Before),
 			lib.StringOrNil(pl.Action),
-			lib.IssueIDOrNil(pl.Issue),
+			lib.IntOrNil(pl.IssueID),
 			lib.PullRequestIDOrNil(pl.PullRequest),
-			lib.CommentIDOrNil(pl.Comment),
+			lib.IntOrNil(pl.CommentID),
 			lib.StringOrNil(pl.RefType),
 			lib.TruncStringOrNil(pl.MasterBranch, 200),
-			nil,
+			lib.StringOrNil(pl.Commit),
 			lib.TruncStringOrNil(pl.Description, 0xffff),
 			lib.IntOrNil(pl.Number),
 			lib.ForkeeIDOrNil(pl.Forkee),
@@ -1137,12 +928,14 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	)
 
 	// Start transaction for data possibly shared between events
-	con, err := db.Begin()
-	lib.FatalOnError(err)
+	con.Begin()
 
 	// gha_actors
 	ghaActor(con, ctx, &ev.Actor)
 
+	// Event data duplicated in other tables
+	dupEv := lib.Event{Actor: ev.Actor, Repo: ev.Repo, Type: ev.Type, CreatedAt: ev.CreatedAt}
+
 	// gha_commits
 	// {"sha:String"=>23265, "author:Hash"=>23265, "message:String"=>23265,
 	// "distinct:TrueClass"=>21789, "url:String"=>23265, "distinct:FalseClass"=>1476}
@@ -1150,19 +943,15 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	// author: {"name:String"=>23265, "email:String"=>23265} (only git username/email)
 	// author: {"name"=>96, "email"=>95}
 	// 23265
-	commits := []lib.Commit{}
-	if pl.Commits != nil {
-		commits = *pl.Commits
-	}
-	for _, commit := range commits {
+	for _, commit := range pl.Commits {
 		sha := commit.SHA
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_commits("+
+			false,
+			"into gha_commits("+
 				"sha, event_id, author_name, message, is_distinct, "+
 				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-				") "+lib.NValues(11),
+				")",
 			lib.AnyArray{
 				sha,
 				eventID,
@@ -1190,15 +979,21 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 	// Comment
 	ghaComment(con, ctx, pl.Comment, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt)
 
+	// Review
+	ghaReview(con, ctx, pl.Review, pl.PullRequest, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt)
+
 	// gha_issues
 	// Table details and analysis in `analysis/analysis.txt` and `analysis/issue_*.json`
+	// Artificial (pre 2015) issue's actors and milestone are stored with its pull request
 	if pl.Issue != nil {
 		issue := *pl.Issue
 
 		// user, assignee
-		ghaActor(con, ctx, &issue.User)
-		if issue.Assignee != nil {
-			ghaActor(con, ctx, issue.Assignee)
+		if !pl.ArtificialIssue {
+			ghaActor(con, ctx, &issue.User)
+			if issue.Assignee != nil {
+				ghaActor(con, ctx, issue.Assignee)
+			}
 		}
 
 		// issue
@@ -1207,14 +1002,14 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 		if issue.PullRequest != nil {
 			isPR = true
 		}
-		lib.ExecSQLTxWithErr(
-			con,
+		con.Insert(
 			ctx,
-			"insert into gha_issues("+
+			false,
+			"into gha_issues("+
 				"id, event_id, assignee_id, body, closed_at, comments, created_at, "+
 				"locked, milestone_id, number, state, title, updated_at, user_id, "+
 				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_user_login, dupn_assignee_login, is_pull_request) "+lib.NValues(23),
+				"dup_user_login, dupn_assignee_login, is_pull_request)",
 			lib.AnyArray{
 				iid,
 				eventID,
@@ -1243,11 +1038,20 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 		)
 
 		// milestone
-		if issue.Milestone != nil {
-			ghaMilestone(con, ctx, eventID, issue.Milestone, ev)
+		if issue.Milestone != nil && !pl.ArtificialIssue {
+			ghaMilestone(con, ctx, eventID, issue.Milestone, &dupEv)
 		}
 
+		// Artificial issue-assignee connections also include main assignee
 		pAid := lib.ActorIDOrNil(issue.Assignee)
+		if pl.ArtificialIssue && issue.Assignee != nil {
+			con.Insert(
+				ctx,
+				false,
+				"into gha_issues_assignees(issue_id, event_id, assignee_id)",
+				lib.AnyArray{iid, eventID, issue.Assignee.ID}...,
+			)
+		}
 		for _, assignee := range issue.Assignees {
 			aid := assignee.ID
 			if aid == pAid {
@@ -1255,13 +1059,15 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 			}
 
 			// assignee
-			ghaActor(con, ctx, &assignee)
+			if !pl.ArtificialIssue {
+				ghaActor(con, ctx, &assignee)
+			}
 
 			// issue-assignee connection
-			lib.ExecSQLTxWithErr(
-				con,
+			con.Insert(
 				ctx,
-				"insert into gha_issues_assignees(issue_id, event_id, assignee_id) "+lib.NValues(3),
+				false,
+				"into gha_issues_assignees(issue_id, event_id, assignee_id)",
 				lib.AnyArray{iid, eventID, aid}...,
 			)
 		}
@@ -1274,22 +1080,21 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 			}
 
 			// label
-			lib.ExecSQLTxWithErr(
-				con,
+			con.Insert(
 				ctx,
-				lib.InsertIgnore("into gha_labels(id, name, color, is_default) "+lib.NValues(4)),
+				true,
+				"into gha_labels(id, name, color, is_default)",
 				lib.AnyArray{lid, lib.TruncToBytes(label.Name, 160), label.Color, lib.BoolOrNil(label.Default)}...,
 			)
 
 			// issue-label connection
-			lib.ExecSQLTxWithErr(
-				con,
+			con.Insert(
 				ctx,
-				lib.InsertIgnore(
-					"into gha_issues_labels(issue_id, event_id, label_id, "+
-						"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-						"dup_issue_number, dup_label_name"+
-						") "+lib.NValues(11)),
+				true,
+				"into gha_issues_labels(issue_id, event_id, label_id, "+
+					"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
+					"dup_issue_number, dup_label_name"+
+					")",
 				lib.AnyArray{
 					iid,
 					eventID,
@@ -1309,28 +1114,124 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event) int {
 
 	// gha_forkees
 	if pl.Forkee != nil {
-		ghaForkee(con, ctx, eventID, pl.Forkee, ev)
+		ghaForkee(con, ctx, eventID, pl.Forkee, &dupEv)
+	}
+
+	// Add pre 2015 event's Forkee if we didn't add it from payload or if it is a different Forkee
+	if ev.RepositoryOld != nil && (pl.Forkee == nil || pl.Forkee.ID != ev.RepositoryOld.ID) {
+		ghaForkeeOld(con, ctx, eventID, ev.RepositoryOld, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt)
 	}
 
 	// Release & assets
 	ghaRelease(con, ctx, pl.Release, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt)
 
+	// Team & Repo connection
+	ghaTeam(con, ctx, pl.Team, pl.Forkee, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt)
+
 	// Pull Request
-	ghaPullRequest(con, ctx, pl.PullRequest, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, []int{})
+	forkeeIDsToSkip := []int{}
+	if ev.RepositoryOld != nil {
+		forkeeIDsToSkip = append(forkeeIDsToSkip, ev.RepositoryOld.ID)
+		if pl.Forkee != nil {
+			forkeeIDsToSkip = append(forkeeIDsToSkip, pl.Forkee.ID)
+		}
+	}
+	ghaPullRequest(con, ctx, pl.PullRequest, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, forkeeIDsToSkip)
 
 	// Final commit
-	lib.FatalOnError(con.Commit())
+	con.Commit(ctx)
 	return 1
 }
 
+// eventRepo - minimal GHA event structure, only used to get repository name
+// before doing a full (expensive) unmarshal of a given JSON
+type eventRepo struct {
+	Repo lib.Repo `json:"repo"`
+}
+
+// eventRepoOld - minimal pre-2015 GHA event structure, see eventRepo
+type eventRepoOld struct {
+	Repository struct {
+		ID           int     `json:"id"`
+		Name         string  `json:"name"`
+		Organization *string `json:"organization"`
+	} `json:"repository"`
+}
+
+// Reports JSON that cannot be unmarshalled and exits
+func unmarshalFailed(dt time.Time, jsonStr []byte, err error) {
+	lib.Printf("%v: Cannot unmarshal:\n%s\n%v\n", dt, string(jsonStr), err)
+	fmt.Fprintf(os.Stderr, "%v: Cannot unmarshal:\n%s\n%v\n", dt, string(jsonStr), err)
+	pretty := lib.PrettyPrintJSON(jsonStr)
+	lib.Printf("%v: JSON Unmarshal failed for:\n'%v'\n", dt, string(pretty))
+	fmt.Fprintf(os.Stderr, "%v: JSON Unmarshal failed for:\n'%v'\n", dt, string(pretty))
+	lib.FatalOnError(err)
+}
+
+// Returns repository ID and full name for a given JSON, only decodes repository data
+func jsonRepo(ctx *lib.Ctx, jsonStr []byte, dt time.Time) (id int, fullName string) {
+	var err error
+	if ctx.OldFormat {
+		var r eventRepoOld
+		err = json.Unmarshal(jsonStr, &r)
+		id = r.Repository.ID
+		fullName = lib.MakeOldRepoName(
+			&lib.ForkeeOld{Name: r.Repository.Name, Organization: r.Repository.Organization},
+		)
+	} else {
+		var r eventRepo
+		err = json.Unmarshal(jsonStr, &r)
+		id, fullName = r.Repo.ID, r.Repo.Name
+	}
+	if err != nil {
+		unmarshalFailed(dt, jsonStr, err)
+	}
+	return
+}
+
+// pgSink - Postgres event sink, writes events into gha_* tables
+// It also collects repository ID -> name history and saves it into gha_repo_names on flush
+type pgSink struct {
+	con   *lib.PgWriter
+	names lib.RepoNames
+}
+
+// WriteEvent - write event and all its data into Postgres
+// Event is copied, because pre 2015 event's IDs are resolved using DB lookups
+func (s *pgSink) WriteEvent(ctx *lib.Ctx, dt time.Time, ev *lib.SinkEvent) (int, error) {
+	nev := *ev.Event
+	e := writeEvent(s.con, ctx, &nev)
+	if e > 0 {
+		s.names.Add(ev.Event.Repo.ID, ev.Event.RepoFullName(), ev.Event.CreatedAt)
+	}
+	return e, nil
+}
+
+// Flush - write remaining batched rows (no-op when not in batch mode) and repository names history
+func (s *pgSink) Flush(ctx *lib.Ctx) error {
+	s.con.Flush(ctx)
+	s.names.Save(s.con.DB, ctx)
+	return nil
+}
+
+// Close - nothing to do, connection is owned by the caller
+func (s *pgSink) Close(ctx *lib.Ctx) error {
+	return nil
+}
+
 // parseJSON - parse signle GHA JSON event
-func parseJSON(con *sql.DB, ctx *lib.Ctx, jsonStr []byte, dt time.Time, forg, frepo map[string]struct{}) (f int, e int) {
+// Repository name is checked first, full JSON is only unmarshalled for matching repositories
+// Repositories can also be matched by ID (repoIDs), see GHA2DB_MATCH_REPO_IDS
+func parseJSON(sinks []lib.EventSink, ctx *lib.Ctx, jsonStr []byte, dt time.Time, forg, frepo map[string]struct{}, repoIDs map[int]struct{}) (f int, e int) {
+	repoID, repoName := jsonRepo(ctx, jsonStr, dt)
+	if !lib.RepoIDHit(ctx, repoID, repoName, forg, frepo, repoIDs) {
+		return
+	}
 	var (
-		h        lib.Event
-		hOld     lib.EventOld
-		err      error
-		fullName string
-		eid      string
+		h    lib.Event
+		hOld lib.EventOld
+		err  error
+		eid  string
 	)
 	if ctx.OldFormat {
 		err = json.Unmarshal(jsonStr, &hOld)
@@ -1338,114 +1239,155 @@ func parseJSON(con *sql.DB, ctx *lib.Ctx, jsonStr []byte, dt time.Time, forg, fr
 		err = json.Unmarshal(jsonStr, &h)
 	}
 	if err != nil {
-		lib.Printf("%v: Cannot unmarshal:\n%s\n%v\n", dt, string(jsonStr), err)
-		fmt.Fprintf(os.Stderr, "%v: Cannot unmarshal:\n%s\n%v\n", dt, string(jsonStr), err)
+		unmarshalFailed(dt, jsonStr, err)
+	}
+	if ctx.OldFormat {
+		eid = fmt.Sprintf("%v", lib.HashStrings([]string{hOld.Type, hOld.Actor, hOld.Repository.Name, lib.ToYMDHMSDate(hOld.CreatedAt)}))
+	} else {
+		eid = h.ID
+	}
+	if ctx.JSONOut {
+		// We want to Unmarshal/Marshall ALL JSON data, regardless of what is defined in lib.Event
 		pretty := lib.PrettyPrintJSON(jsonStr)
-		lib.Printf("%v: JSON Unmarshal failed for:\n'%v'\n", dt, string(pretty))
-		fmt.Fprintf(os.Stderr, "%v: JSON Unmarshal failed for:\n'%v'\n", dt, string(pretty))
+		ofn := fmt.Sprintf("jsons/%v_%v.json", dt.Unix(), eid)
+		lib.FatalOnError(ioutil.WriteFile(ofn, pretty, 0644))
 	}
-	lib.FatalOnError(err)
+	ev := lib.SinkEvent{ID: eid, JSON: jsonStr}
 	if ctx.OldFormat {
-		fullName = lib.MakeOldRepoName(&hOld.Repository)
+		hOld.ID = eid
+		ev.Event, err = lib.NormalizeEventOld(eid, &hOld)
+		lib.FatalOnError(err)
 	} else {
-		fullName = h.Repo.Name
+		ev.Event = lib.NormalizeEvent(&h)
 	}
-	if lib.RepoHit(ctx, fullName, forg, frepo) {
-		if ctx.OldFormat {
-			eid = fmt.Sprintf("%v", lib.HashStrings([]string{hOld.Type, hOld.Actor, hOld.Repository.Name, lib.ToYMDHMSDate(hOld.CreatedAt)}))
-		} else {
-			eid = h.ID
-		}
-		if ctx.JSONOut {
-			// We want to Unmarshal/Marshall ALL JSON data, regardless of what is defined in lib.Event
-			pretty := lib.PrettyPrintJSON(jsonStr)
-			ofn := fmt.Sprintf("jsons/%v_%v.json", dt.Unix(), eid)
-			lib.FatalOnError(ioutil.WriteFile(ofn, pretty, 0644))
-		}
-		if ctx.DBOut {
-			if ctx.OldFormat {
-				e = writeToDBOldFmt(con, ctx, eid, &hOld)
-			} else {
-				e = writeToDB(con, ctx, &h)
-			}
-		}
-		if ctx.Debug >= 1 {
-			lib.Printf("Processed: '%v' event: %v\n", dt, eid)
+	for _, sink := range sinks {
+		n, err := sink.WriteEvent(ctx, dt, &ev)
+		lib.FatalOnError(err)
+		if n > e {
+			e = n
 		}
-		f = 1
 	}
+	if ctx.Debug >= 1 {
+		lib.Printf("Processed: '%v' event: %v\n", dt, eid)
+	}
+	f = 1
 	return
 }
 
 // getGHAJSON - This is a work for single go routine - 1 hour of GHA data
 // Usually such JSON conatin about 15000 - 60000 singe GHA events
 // Boolean channel `ch` is used to synchronize go routines
-func getGHAJSON(ch chan bool, ctx *lib.Ctx, dt time.Time, forg map[string]struct{}, frepo map[string]struct{}) {
+func getGHAJSON(ch chan bool, ctx *lib.Ctx, dt time.Time, forg map[string]struct{}, frepo map[string]struct{}, repoIDs map[int]struct{}, ledger bool) {
 	lib.Printf("Working on %v\n", dt)
+	dtStart := time.Now()
 
-	// Connect to Postgres DB
-	con := lib.PgConn(ctx)
-	defer func() { lib.FatalOnError(con.Close()) }()
-
-	fn := fmt.Sprintf("http://data.gharchive.org/%s.json.gz", lib.ToGHADate(dt))
+	// Connect to Postgres DB (only when Postgres sink is used)
+	var db *sql.DB
+	if ctx.DBOut {
+		db = lib.PgConn(ctx)
+		defer func() { lib.FatalOnError(db.Close()) }()
+	}
+
+	// Ingestion ledger: mark hour as running, save final status when done
+	// Hour that crashes stays in "running" state and will be retried
+	entry := lib.LedgerEntry{Hour: dt}
+	if ledger {
+		lib.LedgerStart(db, ctx, dt)
+	}
+	finish := func(status string, err error) {
+		if ledger {
+			entry.Status = status
+			entry.Duration = time.Now().Sub(dtStart).Seconds()
+			if err != nil {
+				entry.Error = err.Error()
+			}
+			lib.LedgerFinish(db, ctx, &entry)
+		}
+		if ch != nil {
+			ch <- true
+		}
+	}
 
-	// Get gzipped JSON array via HTTP
-	response, err := http.Get(fn)
+	// Get gzipped JSON array from local GH Archive mirror or via HTTP
+	body, fn, err := lib.OpenGHAArchive(ctx, dt)
+	if err != nil && os.IsNotExist(err) {
+		lib.Printf("%v: No data yet, %s not found in local mirror\n", dt, fn)
+		fmt.Fprintf(os.Stderr, "%v: No data yet, %s not found in local mirror\n", dt, fn)
+		finish(lib.LedgerNoData, err)
+		return
+	}
 	if err != nil {
-		lib.Printf("%v: Error http.Get:\n%v\n", dt, err)
-		fmt.Fprintf(os.Stderr, "%v: Error http.Get:\n%v\n", dt, err)
+		lib.Printf("%v: Error opening %s:\n%v\n", dt, fn, err)
+		fmt.Fprintf(os.Stderr, "%v: Error opening %s:\n%v\n", dt, fn, err)
 	}
 	lib.FatalOnError(err)
-	defer func() { _ = response.Body.Close() }()
+	defer func() { _ = body.Close() }()
+
+	// Compute checksum of gzipped data while reading it
+	hash := sha256.New()
+	tee := io.TeeReader(body, hash)
 
 	// Decompress Gzipped response
-	reader, err := gzip.NewReader(response.Body)
+	reader, err := gzip.NewReader(tee)
 	//lib.FatalOnError(err)
 	if err != nil {
 		lib.Printf("%v: No data yet, gzip reader:\n%v\n", dt, err)
 		fmt.Fprintf(os.Stderr, "%v: No data yet, gzip reader:\n%v\n", dt, err)
-		if ch != nil {
-			ch <- true
-		}
+		finish(lib.LedgerNoData, err)
 		return
 	}
 	lib.Printf("Opened %s\n", fn)
 	defer func() { _ = reader.Close() }()
 
-	jsonsBytes, err := ioutil.ReadAll(reader)
-	//lib.FatalOnError(err)
-	if err != nil {
-		lib.Printf("%v: Error (no data yet, ioutil readall):\n%v\n", dt, err)
-		fmt.Fprintf(os.Stderr, "%v: Error (no data yet, ioutil readall):\n%v\n", dt, err)
-		if ch != nil {
-			ch <- true
+	// Create event sinks for this hour
+	sinks := []lib.EventSink{}
+	for _, name := range ctx.Sinks {
+		var sink lib.EventSink
+		if name == lib.SinkPostgres {
+			sink = &pgSink{con: lib.NewPgWriter(db, ctx), names: lib.RepoNames{}}
+		} else {
+			sink, err = lib.NewFileSink(ctx, name, dt)
+			lib.FatalOnError(err)
 		}
-		return
+		sinks = append(sinks, sink)
+	}
+
+	// Process JSONs one by one while decompressing, never holding the whole hour in memory
+	f, e := 0, 0
+	n, err := lib.ProcessGHAJSONs(
+		reader,
+		func(json []byte) error {
+			fi, ei := parseJSON(sinks, ctx, json, dt, forg, frepo, repoIDs)
+			f += fi
+			e += ei
+			return nil
+		},
+	)
+	if err != nil {
+		lib.Printf("%v: Error (no more data, processed %d JSONs):\n%v\n", dt, n, err)
+		fmt.Fprintf(os.Stderr, "%v: Error (no more data, processed %d JSONs):\n%v\n", dt, n, err)
 	}
-	lib.Printf("Decompressed %s\n", fn)
-
-	// Split JSON array into separate JSONs
-	jsonsArray := bytes.Split(jsonsBytes, []byte("\n"))
-	lib.Printf("Splitted %s, %d JSONs\n", fn, len(jsonsArray))
-
-	// Process JSONs one by one
-	n, f, e := 0, 0, 0
-	for _, json := range jsonsArray {
-		if len(json) < 1 {
-			continue
-		}
-		fi, ei := parseJSON(con, ctx, json, dt, forg, frepo)
-		n++
-		f += fi
-		e += ei
+	// Write remaining buffered data and finalize all sinks
+	for _, sink := range sinks {
+		lib.FatalOnError(sink.Flush(ctx))
+		lib.FatalOnError(sink.Close(ctx))
 	}
 	lib.Printf(
 		"Parsed: %s: %d JSONs, found %d matching, events %d\n",
 		fn, n, f, e,
 	)
-	if ch != nil {
-		ch <- true
+	status := lib.LedgerOK
+	if err != nil {
+		status = lib.LedgerFailed
+	} else {
+		_, err = io.Copy(ioutil.Discard, tee)
+		if err != nil {
+			status = lib.LedgerFailed
+		}
 	}
+	entry.JSONs, entry.Found, entry.Events = n, f, e
+	entry.Checksum = hex.EncodeToString(hash.Sum(nil))
+	finish(status, err)
 }
 
 // gha2db - main work horse
@@ -1521,6 +1463,68 @@ func gha2db(args []string) {
 		)
 	}
 
+	// Ingestion ledger is only used when its table exists, ledger modes require it
+	ledger := false
+	if ctx.DBOut || ctx.GapAudit || ctx.LedgerList || ctx.LedgerRetry {
+		con := lib.PgConn(&ctx)
+		ledger = lib.LedgerAvailable(con, &ctx)
+		lib.FatalOnError(con.Close())
+		if !ledger {
+			if ctx.GapAudit || ctx.LedgerList || ctx.LedgerRetry {
+				lib.Fatalf(lib.LedgerUnavailableMessage)
+			}
+			lib.Printf("%s\n", lib.LedgerUnavailableMessage)
+		}
+	}
+
+	// Gap audit: report hours with no imported data, optionally record them in the ledger
+	if ctx.GapAudit {
+		con := lib.PgConn(&ctx)
+		gaps := lib.LedgerAudit(con, &ctx, dFrom, dTo)
+		lib.Printf("%d hours missing in %v - %v\n", len(gaps), dFrom, dTo)
+		for _, entry := range gaps {
+			fmt.Printf("%s\n", lib.LedgerEntryString(&entry))
+		}
+		if ctx.GapAuditMark {
+			n := lib.LedgerMarkMissing(con, &ctx, gaps)
+			lib.Printf("%d missing hours marked for retry\n", n)
+		}
+		lib.FatalOnError(con.Close())
+		return
+	}
+
+	// Hours to process: whole range or only hours not imported yet (ingestion ledger)
+	var hours []time.Time
+	if ctx.LedgerList || ctx.LedgerRetry {
+		con := lib.PgConn(&ctx)
+		entries := lib.LedgerPending(con, &ctx, dFrom, dTo, true)
+		lib.FatalOnError(con.Close())
+		if ctx.LedgerList {
+			lib.Printf("%d hours not imported in %v - %v\n", len(entries), dFrom, dTo)
+			for _, entry := range entries {
+				fmt.Printf("%s\n", lib.LedgerEntryString(&entry))
+			}
+			return
+		}
+		for _, entry := range entries {
+			hours = append(hours, entry.Hour)
+		}
+		lib.Printf("Retrying %d hours not imported in %v - %v\n", len(hours), dFrom, dTo)
+	} else {
+		for dt := dFrom; dt.Before(dTo) || dt.Equal(dTo); dt = dt.Add(time.Hour) {
+			hours = append(hours, dt)
+		}
+	}
+
+	// Match repositories by ID too, so renamed/transferred repositories are imported with all their names
+	var repoIDs map[int]struct{}
+	if ctx.MatchRepoIDs {
+		con := lib.PgConn(&ctx)
+		repoIDs = lib.RepoIDsMatching(con, &ctx, org, repo)
+		lib.FatalOnError(con.Close())
+		lib.Printf("Matching %d repository IDs\n", len(repoIDs))
+	}
+
 	// Get number of CPUs available
 	thrN := lib.GetThreadsNum(&ctx)
 	lib.Printf(
@@ -1530,13 +1534,11 @@ func gha2db(args []string) {
 		strings.Join(lib.StringsSetKeys(repo), "+"),
 	)
 
-	dt := dFrom
 	if thrN > 1 {
 		ch := make(chan bool)
 		nThreads := 0
-		for dt.Before(dTo) || dt.Equal(dTo) {
-			go getGHAJSON(ch, &ctx, dt, org, repo)
-			dt = dt.Add(time.Hour)
+		for _, dt := range hours {
+			go getGHAJSON(ch, &ctx, dt, org, repo, repoIDs, ledger)
 			nThreads++
 			if nThreads == thrN {
 				<-ch
@@ -1550,9 +1552,8 @@ func gha2db(args []string) {
 		}
 	} else {
 		lib.Printf("Using single threaded version\n")
-		for dt.Before(dTo) || dt.Equal(dTo) {
-			getGHAJSON(nil, &ctx, dt, org, repo)
-			dt = dt.Add(time.Hour)
+		for _, dt := range hours {
+			getGHAJSON(nil, &ctx, dt, org, repo, repoIDs, ledger)
 		}
 	}
 	// Finished
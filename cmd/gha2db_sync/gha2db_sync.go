@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"strconv"
@@ -27,14 +28,21 @@ type gaps struct {
 // format is "=prefix;suffix;join;list1item1,list1item2,...;list2item1,list2item2,...;..."
 // Values can be set the same way as Series, it is the array of series properties to clear
 // If not specified, ["value"] is assumed - it is used for multi-value series
+// Tagged series (metrics.yaml `tagged: true`) are given without period suffix, period is written as "period" tag
+// RowTag is their row tag and TagValues (formulas allowed) are row tag values to fill gaps for
+// TagValuesSQL is idb_tags SQL file returning (not normalized) row tag values, they can be used instead of TagValues
 type metricGap struct {
-	Name      string   `yaml:"name"`
-	Series    []string `yaml:"series"`
-	Periods   string   `yaml:"periods"`
-	Aggregate string   `yaml:"aggregate"`
-	Skip      string   `yaml:"skip"`
-	Desc      bool     `yaml:"desc"`
-	Values    []string `yaml:"values"`
+	Name         string   `yaml:"name"`
+	Series       []string `yaml:"series"`
+	Periods      string   `yaml:"periods"`
+	Aggregate    string   `yaml:"aggregate"`
+	Skip         string   `yaml:"skip"`
+	Desc         bool     `yaml:"desc"`
+	Values       []string `yaml:"values"`
+	Tagged       bool     `yaml:"tagged"`
+	RowTag       string   `yaml:"row_tag"`
+	TagValues    []string `yaml:"tag_values"`
+	TagValuesSQL string   `yaml:"tag_values_sql"`
 }
 
 // metrics contain list of metrics to evaluate
@@ -56,6 +64,8 @@ type metric struct {
 	MultiValue        bool   `yaml:"multi_value"`
 	EscapeValueName   bool   `yaml:"escape_value_name"`
 	AnnotationsRanges bool   `yaml:"annotations_ranges"`
+	Tagged            bool   `yaml:"tagged"`
+	RowTag            string `yaml:"row_tag"`
 }
 
 // Add _period to all array items
@@ -155,9 +165,48 @@ func createSeriesFromFormula(def string) (result []string) {
 	return
 }
 
+// execCommand - execute command, in plan mode (GHA2DB_SYNC_PLAN) only print it
+func execCommand(ctx *lib.Ctx, cmdAndArgs []string, env map[string]string) error {
+	if ctx.SyncPlan {
+		lib.PlanPrintf("%s\n", lib.CommandString(cmdAndArgs, env))
+		return nil
+	}
+	_, err := lib.ExecCommand(ctx, cmdAndArgs, env)
+	return err
+}
+
+// gapTagValues - return tagged series row tag values: TagValues (formulas allowed)
+// and normalized values returned by TagValuesSQL (idb_tags SQL file)
+func gapTagValues(ctx *lib.Ctx, metric *metricGap) (values []string, err error) {
+	for _, value := range metric.TagValues {
+		if value[0:1] == "=" {
+			values = append(values, createSeriesFromFormula(value)...)
+		} else {
+			values = append(values, value)
+		}
+	}
+	if metric.TagValuesSQL == "" {
+		return
+	}
+	con := lib.PgConn(ctx)
+	defer func() { lib.FatalOnError(con.Close()) }()
+	sqlValues, err := lib.ReadTagValues(con, ctx, metric.TagValuesSQL)
+	if err != nil {
+		return
+	}
+	for _, value := range sqlValues {
+		value = lib.NormalizeName(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
 // fills series gaps
 // Reads config from YAML (which series, for which periods)
-func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) {
+// Failed z2influx calls don't stop filling other series, number of failures is returned as an error
+func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) error {
 	lib.Printf("Fill gaps in series\n")
 	var gaps gaps
 
@@ -171,13 +220,13 @@ func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) {
 
 	data, err := lib.ReadFile(ctx, dataPrefix+ctx.GapsYaml)
 	if err != nil {
-		lib.FatalOnError(err)
-		return
+		return err
 	}
 	lib.FatalOnError(yaml.Unmarshal(data, &gaps))
 
 	// Iterate metrics and periods
 	bSize := 1000
+	failed := 0
 	for _, metric := range gaps.Metrics {
 		extraParams := []string{}
 		if metric.Desc {
@@ -197,6 +246,24 @@ func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) {
 			values = append(values, "value")
 		}
 		extraParams = append(extraParams, "values:"+strings.Join(values, ";"))
+		// Parse tagged series row tag values
+		if metric.Tagged {
+			tagValues, err := gapTagValues(ctx, &metric)
+			if err != nil {
+				lib.Printf("Filling metric gaps %v: cannot get tag values: %v\n", metric.Name, err)
+				failed++
+				continue
+			}
+			if len(tagValues) > 0 {
+				rowTag := metric.RowTag
+				if rowTag == "" {
+					rowTag = lib.DefaultRowTag
+				}
+				extraParams = append(extraParams, "tags:"+rowTag+"="+strings.Join(tagValues, ";"))
+			} else {
+				extraParams = append(extraParams, "tags")
+			}
+		}
 		// Parse series
 		series := []string{}
 		for _, ser := range metric.Series {
@@ -248,11 +315,15 @@ func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) {
 						bTo = nSeries
 					}
 					lib.Printf("Filling metric gaps %v, descriptions %v, period: %s, %d series (%d - %d)...\n", metric.Name, metric.Desc, periodAggr, nSeries, bFrom, bTo)
-					_, err := lib.ExecCommand(
+					bSeries := series[bFrom:bTo]
+					if !metric.Tagged {
+						bSeries = addPeriodSuffix(bSeries, periodAggr)
+					}
+					err := execCommand(
 						ctx,
 						[]string{
 							cmdPrefix + "z2influx",
-							strings.Join(addPeriodSuffix(series[bFrom:bTo], periodAggr), ","),
+							strings.Join(bSeries, ","),
 							lib.ToYMDHDate(from),
 							lib.ToYMDHDate(to),
 							periodAggr,
@@ -260,11 +331,455 @@ func fillGapsInSeries(ctx *lib.Ctx, from, to time.Time) {
 						},
 						nil,
 					)
-					lib.FatalOnError(err)
+					if err != nil {
+						lib.Printf("Filling metric gaps %v, period %s failed: %v\n", metric.Name, periodAggr, err)
+						failed++
+					}
+				}
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("filling gaps failed %d times", failed)
+	}
+	return nil
+}
+
+// retryLedgerHours - re-run gha2db on all hours up to a given date that are not marked as imported in the ingestion ledger
+func retryLedgerHours(ctx *lib.Ctx, con *sql.DB, cmdPrefix string, to time.Time, org, repo []string) error {
+	entries := lib.LedgerPending(con, ctx, ctx.DefaultStartDate, to, false)
+	if len(entries) == 0 {
+		return nil
+	}
+	hours := []time.Time{}
+	for _, entry := range entries {
+		hours = append(hours, entry.Hour)
+	}
+	ranges := lib.HourRanges(hours)
+	lib.Printf("Retrying %d not imported hours (%d ranges)\n", len(hours), len(ranges))
+	for _, rng := range ranges {
+		lib.Printf("GHA retry range: %s - %s\n", lib.ToYMDHDate(rng[0]), lib.ToYMDHDate(rng[1]))
+		err := execCommand(
+			ctx,
+			[]string{
+				cmdPrefix + "gha2db",
+				lib.ToYMDDate(rng[0]),
+				strconv.Itoa(rng[0].Hour()),
+				lib.ToYMDDate(rng[1]),
+				strconv.Itoa(rng[1].Hour()),
+				strings.Join(org, ","),
+				strings.Join(repo, ","),
+			},
+			map[string]string{"GHA2DB_LEDGER_RETRY": "1", "GHA2DB_GAP_AUDIT": ""},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncState - data shared by all sync steps
+type syncState struct {
+	con        *sql.DB
+	store      lib.SeriesStore
+	org        []string
+	repo       []string
+	cmdPrefix  string
+	dataPrefix string
+	from       time.Time
+	to         time.Time
+	idbFrom    time.Time
+	rows       map[string]int64
+	points     map[string]int64
+	ledger     bool
+	clearLogs  func()
+}
+
+// defaultSyncSteps - gha2db_sync steps, they can be changed using GHA2DB_SYNC_YAML, see syncSteps
+func defaultSyncSteps(st *syncState) []lib.SyncStep {
+	return []lib.SyncStep{
+		{Name: "gha2db", SkipIf: []string{"skip_pdb"}, Run: st.gha2db},
+		{Name: "get_repos", Needs: []string{"gha2db"}, SkipIf: []string{"skip_pdb"}, Run: st.getRepos},
+		{Name: "ghapi2db", Needs: []string{"gha2db"}, SkipIf: []string{"skip_pdb"}, Run: st.ghapi2db},
+		{Name: "structure", Needs: []string{"gha2db"}, SkipIf: []string{"skip_pdb"}, Run: st.structure},
+		{Name: "idb_tags", Needs: []string{"structure"}, SkipIf: []string{"skip_idb", "not_daily"}, Run: st.idbTags},
+		{Name: "annotations", SkipIf: []string{"skip_idb", "not_daily", "no_project"}, Run: st.annotations},
+		{Name: "gaps", SkipIf: []string{"skip_idb"}, Run: st.gaps},
+		{Name: "metrics", Needs: []string{"structure", "gaps"}, SkipIf: []string{"skip_idb"}, Run: st.metrics},
+	}
+}
+
+// syncSteps - return default steps with eventual overrides from GHA2DB_SYNC_YAML (it is optional)
+// Commands of steps defined in YAML are run from the same directory as other tools (unless they're given with a path)
+func syncSteps(ctx *lib.Ctx, st *syncState) []lib.SyncStep {
+	steps := defaultSyncSteps(st)
+	data, err := lib.ReadFile(ctx, st.dataPrefix+ctx.SyncYaml)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return onlySteps(ctx, steps)
+		}
+		lib.FatalOnError(err)
+	}
+	var overrides lib.SyncSteps
+	lib.FatalOnError(yaml.Unmarshal(data, &overrides))
+	steps, err = lib.MergeSyncSteps(steps, overrides.Steps)
+	lib.FatalOnError(err)
+	for i := range steps {
+		if steps[i].Run == nil && !strings.Contains(steps[i].Command[0], "/") {
+			steps[i].Command = append([]string{st.cmdPrefix + steps[i].Command[0]}, steps[i].Command[1:]...)
+		}
+	}
+	return onlySteps(ctx, steps)
+}
+
+// onlySteps - skip steps that are not listed in GHA2DB_SYNC_STEPS (if set)
+func onlySteps(ctx *lib.Ctx, steps []lib.SyncStep) []lib.SyncStep {
+	if len(ctx.SyncOnlySteps) == 0 {
+		return steps
+	}
+	found := make(map[string]bool)
+	for i := range steps {
+		found[steps[i].Name] = true
+		if !ctx.SyncOnlySteps[steps[i].Name] {
+			steps[i].Skip = true
+		}
+	}
+	for step := range ctx.SyncOnlySteps {
+		if !found[step] {
+			lib.Fatalf("unknown step '%s' in GHA2DB_SYNC_STEPS", step)
+		}
+	}
+	return steps
+}
+
+// gha2db - get new GHAs (and retry hours that failed or were not finished in previous syncs)
+func (st *syncState) gha2db(ctx *lib.Ctx) error {
+	dtStart := time.Now()
+
+	// Clear old DB logs
+	if !ctx.SyncPlan && st.clearLogs != nil {
+		st.clearLogs()
+	}
+
+	// Find hours that have no imported data (for example GHA archive was not available yet)
+	// and mark them, so they're retried below
+	if ctx.SyncGapAudit && st.ledger {
+		gaps := lib.LedgerAudit(st.con, ctx, ctx.DefaultStartDate, lib.HourStart(st.from).Add(-time.Hour))
+		if ctx.SyncPlan {
+			lib.PlanPrintf("gap audit: %d hours missing\n", len(gaps))
+		} else {
+			n := lib.LedgerMarkMissing(st.con, ctx, gaps)
+			lib.Printf("Gap audit: %d hours missing, %d new\n", len(gaps), n)
+		}
+	}
+
+	// Retry hours that failed or were not finished in previous syncs
+	if st.ledger {
+		err := retryLedgerHours(ctx, st.con, st.cmdPrefix, lib.HourStart(st.from).Add(-time.Hour), st.org, st.repo)
+		if err != nil {
+			return err
+		}
+	}
+
+	// gha2db
+	fromDate := lib.ToYMDDate(st.from)
+	fromHour := strconv.Itoa(st.from.Hour())
+	toDate := lib.ToYMDDate(st.to)
+	toHour := strconv.Itoa(st.to.Hour())
+	lib.Printf("GHA range: %s %s - %s %s\n", fromDate, fromHour, toDate, toHour)
+	err := execCommand(
+		ctx,
+		[]string{
+			st.cmdPrefix + "gha2db",
+			fromDate,
+			fromHour,
+			toDate,
+			toHour,
+			strings.Join(st.org, ","),
+			strings.Join(st.repo, ","),
+		},
+		// gha2db in gap audit mode only reports missing hours, never run it that way from sync
+		map[string]string{"GHA2DB_GAP_AUDIT": ""},
+	)
+	if err != nil || ctx.SyncPlan {
+		return err
+	}
+
+	// Number of events written by this step (gha2db records events written for each hour in the ingestion ledger)
+	// It is only used for sync statistics, so failing to get it doesn't fail the step
+	if st.ledger {
+		rows, err := lib.LedgerEventsSince(st.con, ctx, dtStart)
+		if err != nil {
+			lib.Printf("Cannot get number of events written by gha2db: %v\n", err)
+		} else {
+			st.rows["gha2db"] = rows
+		}
+	}
+	return nil
+}
+
+// getRepos - only run commits analysis for current DB here
+// We have updated repos to the newest state as 1st step in "devstats" call
+// We have also fetched all data from current GHA hour using "gha2db"
+// Now let's update new commits files (from newest hour)
+func (st *syncState) getRepos(ctx *lib.Ctx) error {
+	lib.Printf("Update git commits\n")
+	return execCommand(
+		ctx,
+		[]string{
+			st.cmdPrefix + "get_repos",
+		},
+		map[string]string{
+			"GHA2DB_PROCESS_COMMITS":  "1",
+			"GHA2DB_PROJECTS_COMMITS": ctx.Project,
+		},
+	)
+}
+
+// ghapi2db - GitHub API calls to get open issues state
+// It updates milestone and/or label(s) when different sice last comment state
+func (st *syncState) ghapi2db(ctx *lib.Ctx) error {
+	lib.Printf("Update data from GitHub API\n")
+	return execCommand(
+		ctx,
+		[]string{
+			st.cmdPrefix + "ghapi2db",
+		},
+		nil,
+	)
+}
+
+// structure - eventual postprocess SQL's from 'structure' call
+func (st *syncState) structure(ctx *lib.Ctx) error {
+	lib.Printf("Update structure\n")
+	// Recompute views and DB summaries
+	return execCommand(
+		ctx,
+		[]string{
+			st.cmdPrefix + "structure",
+		},
+		map[string]string{
+			"GHA2DB_SKIPTABLE": "1",
+			"GHA2DB_MGETC":     "y",
+		},
+	)
+}
+
+// idbTags - InfluxDB tags (repo groups template variable currently)
+func (st *syncState) idbTags(ctx *lib.Ctx) error {
+	return execCommand(ctx, []string{st.cmdPrefix + "idb_tags"}, nil)
+}
+
+// annotations - project's annotations and quick ranges
+func (st *syncState) annotations(ctx *lib.Ctx) error {
+	return execCommand(
+		ctx,
+		[]string{
+			st.cmdPrefix + "annotations",
+		},
+		nil,
+	)
+}
+
+// gaps - fill gaps in series
+func (st *syncState) gaps(ctx *lib.Ctx) error {
+	return fillGapsInSeries(ctx, st.idbFrom, st.to)
+}
+
+// metrics - calculate all metrics (DB2Influx)
+// Metrics are calculated in-process, they share Postgres and InfluxDB connections and workers budget
+// Failed metric doesn't stop calculating other metrics, number of failed metrics is returned as an error
+// Metrics are not started after step's deadline
+// Each metric's period is calculated from its own watermark (date up to which it was last calculated successfully)
+// so metrics that failed or were not calculated are recalculated from that date by the next sync
+// In plan mode metrics and histograms are only printed as equivalent db2influx calls
+func (st *syncState) metrics(ctx *lib.Ctx) error {
+	metricsDir := st.dataPrefix + "metrics"
+	if ctx.Project != "" {
+		metricsDir += "/" + ctx.Project
+	}
+	from, to := st.idbFrom, st.to
+	lib.Printf("Influx range: %s - %s\n", lib.ToYMDHDate(from), lib.ToYMDHDate(to))
+
+	// Get Quick Ranges from series store (it is filled by annotations command)
+	quickRanges, err := st.store.TagValues("quick_ranges_suffix")
+	lib.FatalOnError(err)
+	lib.Printf("Quick ranges: %+v\n", quickRanges)
+
+	// Read metrics configuration
+	data, err := lib.ReadFile(ctx, st.dataPrefix+ctx.MetricsYaml)
+	if err != nil {
+		return err
+	}
+	var allMetrics metrics
+	lib.FatalOnError(yaml.Unmarshal(data, &allMetrics))
+
+	// Metrics watermarks, not used when recalculating everything
+	marks := &lib.MetricsWatermarks{}
+	if !ctx.SkipWatermarks && !ctx.ResetIDB {
+		marks, err = lib.GetMetricsWatermarks(st.con, ctx)
+		if err != nil {
+			lib.Printf("Cannot read metrics watermarks, using Influx range for all metrics: %v\n", err)
+			marks = &lib.MetricsWatermarks{}
+		}
+	}
+	if !ctx.SkipWatermarks && !ctx.SyncPlan {
+		defer func() {
+			err := lib.SaveMetricsWatermarks(st.con, ctx, marks)
+			if err != nil {
+				lib.Printf("Error saving metrics watermarks: %v\n", err)
+			}
+		}()
+	}
+
+	// Metrics calculation engine
+	thrN := lib.GetThreadsNum(ctx)
+	var mc *lib.MetricsCalc
+	if !ctx.SyncPlan {
+		mc = lib.NewMetricsCalc(ctx, thrN)
+		defer func() {
+			st.points["metrics"] = mc.Points()
+			mc.Close()
+		}()
+	}
+
+	// Keep all histograms (and their watermarks) here
+	var (
+		hists     []lib.CalcMetricData
+		histMarks []lib.MetricWatermark
+	)
+	failed := 0
+
+	// Iterate all metrics
+	for _, metric := range allMetrics.Metrics {
+		extraParams := []string{}
+		if metric.Histogram {
+			extraParams = append(extraParams, "hist")
+		}
+		if metric.MultiValue {
+			extraParams = append(extraParams, "multivalue")
+		}
+		if metric.EscapeValueName {
+			extraParams = append(extraParams, "escape_value_name")
+		}
+		if metric.Desc != "" {
+			extraParams = append(extraParams, "desc:"+metric.Desc)
+		}
+		if metric.Tagged {
+			if metric.RowTag != "" {
+				extraParams = append(extraParams, "tagged:"+metric.RowTag)
+			} else {
+				extraParams = append(extraParams, "tagged")
+			}
+		}
+		periods := strings.Split(metric.Periods, ",")
+		aggregate := metric.Aggregate
+		if aggregate == "" {
+			aggregate = "1"
+		}
+		if metric.AnnotationsRanges {
+			extraParams = append(extraParams, "annotations_ranges")
+			periods = quickRanges
+			aggregate = "1"
+		}
+		aggregateArr := strings.Split(aggregate, ",")
+		skips := strings.Split(metric.Skip, ",")
+		skipMap := make(map[string]struct{})
+		for _, skip := range skips {
+			skipMap[skip] = struct{}{}
+		}
+		if !ctx.ResetIDB && !ctx.ResetRanges {
+			extraParams = append(extraParams, "skip_past")
+		}
+		for _, aggrStr := range aggregateArr {
+			_, err := strconv.Atoi(aggrStr)
+			lib.FatalOnError(err)
+			aggrSuffix := aggrStr
+			if aggrSuffix == "1" {
+				aggrSuffix = ""
+			}
+			for _, period := range periods {
+				periodAggr := period + aggrSuffix
+				_, found := skipMap[periodAggr]
+				if found {
+					lib.Printf("Skipped period %s\n", periodAggr)
+					continue
+				}
+				if !ctx.ResetIDB && !lib.ComputePeriodAtThisDate(ctx, period, to) {
+					lib.Printf("Skipping recalculating period \"%s%s\" for date to %v\n", period, aggrSuffix, to)
+					continue
+				}
+				seriesNameOrFunc := metric.SeriesNameOrFunc
+				if metric.AddPeriodToName && !metric.Tagged {
+					seriesNameOrFunc += "_" + periodAggr
+				}
+				if !ctx.ExecDeadline.IsZero() && time.Now().After(ctx.ExecDeadline) {
+					return fmt.Errorf("deadline %v exceeded, %d metrics failed", ctx.ExecDeadline, failed)
+				}
+				mark := lib.MetricWatermark{Metric: metric.Name, Period: periodAggr}
+				m := lib.CalcMetricData{
+					SeriesNameOrFunc: seriesNameOrFunc,
+					SQLFile:          fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL),
+					From:             lib.ToYMDHDate(marks.From(mark, from)),
+					To:               lib.ToYMDHDate(to),
+					Period:           periodAggr,
+				}
+				m.SetOptions(strings.Join(extraParams, ","))
+				// Histogram metrics usualy take long time, but executes single query, so there is no way to
+				// Implement multi threading inside a single metric calculation for them
+				// So we're creating array of such metrics to be executed at the end - each in a separate go routine
+				if metric.Histogram {
+					lib.Printf("Scheduled histogram metric %v, period %v, desc: '%v', aggregate: '%v' ...\n", metric.Name, period, metric.Desc, aggrSuffix)
+					hists = append(hists, m)
+					histMarks = append(histMarks, mark)
+				} else if ctx.SyncPlan {
+					lib.PlanPrintf("%s\n", lib.CommandString(append([]string{st.cmdPrefix + "db2influx"}, m.Args()...), nil))
+				} else {
+					lib.Printf("Calculate metric %v, period %v, desc: '%v', aggregate: '%v' ...\n", metric.Name, period, metric.Desc, aggrSuffix)
+					err = mc.Calc(&m)
+					if err != nil {
+						lib.Printf("Metric %v, period %v failed: %v\n", metric.Name, periodAggr, err)
+						failed++
+					} else {
+						marks.Advance(mark, to)
+					}
 				}
 			}
 		}
 	}
+	if ctx.SyncPlan {
+		lib.PlanPrintf("histograms: %d\n", len(hists))
+		for i := range hists {
+			lib.PlanPrintf("%s\n", lib.CommandString(append([]string{st.cmdPrefix + "db2influx"}, hists[i].Args()...), nil))
+		}
+		return nil
+	}
+	// Process histograms, each in its own go routine, number of concurrent histograms is limited by workers budget
+	lib.Printf("Now processing %d histograms using %d workers\n", len(hists), thrN)
+	errs := make([]error, len(hists))
+	ch := make(chan int)
+	for i := range hists {
+		go func(i int) {
+			m := &hists[i]
+			lib.Printf("Calculate histogram %s,%s,%s,%s,%s ...\n", m.SeriesNameOrFunc, m.SQLFile, m.From, m.To, m.Period)
+			errs[i] = mc.Calc(m)
+			ch <- i
+		}(i)
+	}
+	for range hists {
+		i := <-ch
+		if errs[i] != nil {
+			lib.Printf("Histogram failed: %v\n", errs[i])
+			failed++
+		} else {
+			marks.Advance(histMarks[i], to)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d metrics failed", failed)
+	}
+	return nil
 }
 
 func sync(ctx *lib.Ctx, args []string) {
@@ -296,9 +811,9 @@ func sync(ctx *lib.Ctx, args []string) {
 	con := lib.PgConn(ctx)
 	defer func() { lib.FatalOnError(con.Close()) }()
 
-	// Connect to InfluxDB
-	ic := lib.IDBConn(ctx)
-	defer func() { lib.FatalOnError(ic.Close()) }()
+	// Connect to series store
+	store := lib.NewSeriesStore(ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
 
 	// Get max event date from Postgres database
 	var maxDtPtr *time.Time
@@ -310,13 +825,13 @@ func sync(ctx *lib.Ctx, args []string) {
 		}
 	}
 
-	// Get max series date from Influx database
+	// Get max series date from series store
 	maxDtIDB := ctx.DefaultStartDate
 	if !ctx.ForceStartDate {
-		res := lib.QueryIDB(ic, ctx, "select last(value) from "+ctx.LastSeries)
-		series := res[0].Series
-		if len(series) > 0 {
-			maxDtIDB = lib.TimeParseIDB(series[0].Values[0][0].(string))
+		point, err := store.LastPoint(ctx.LastSeries)
+		lib.FatalOnError(err)
+		if point != nil {
+			maxDtIDB = point.Time
 		}
 	}
 
@@ -324,290 +839,96 @@ func sync(ctx *lib.Ctx, args []string) {
 	// Just to get into next GHA hour
 	from := maxDtPg.Add(5 * time.Minute)
 	to := time.Now()
-	fromDate := lib.ToYMDDate(from)
-	fromHour := strconv.Itoa(from.Hour())
-	toDate := lib.ToYMDDate(to)
-	toHour := strconv.Itoa(to.Hour())
-
-	// Get new GHAs
-	if !ctx.SkipPDB {
-		// Clear old DB logs
-		lib.ClearDBLogs()
-
-		// gha2db
-		lib.Printf("GHA range: %s %s - %s %s\n", fromDate, fromHour, toDate, toHour)
-		_, err := lib.ExecCommand(
-			ctx,
-			[]string{
-				cmdPrefix + "gha2db",
-				fromDate,
-				fromHour,
-				toDate,
-				toHour,
-				strings.Join(org, ","),
-				strings.Join(repo, ","),
-			},
-			nil,
-		)
-		lib.FatalOnError(err)
-
-		// Only run commits analysis for current DB here
-		// We have updated repos to the newest state as 1st step in "devstats" call
-		// We have also fetched all data from current GHA hour using "gha2db"
-		// Now let's update new commits files (from newest hour)
-		lib.Printf("Update git commits\n")
-		_, err = lib.ExecCommand(
-			ctx,
-			[]string{
-				cmdPrefix + "get_repos",
-			},
-			map[string]string{
-				"GHA2DB_PROCESS_COMMITS":  "1",
-				"GHA2DB_PROJECTS_COMMITS": ctx.Project,
-			},
-		)
-		lib.FatalOnError(err)
-
-		// GitHub API calls to get open issues state
-		// It updates milestone and/or label(s) when different sice last comment state
-		lib.Printf("Update data from GitHub API\n")
-		// Recompute views and DB summaries
-		_, err = lib.ExecCommand(
-			ctx,
-			[]string{
-				cmdPrefix + "ghapi2db",
-			},
-			nil,
-		)
-		lib.FatalOnError(err)
 
-		// Eventual postprocess SQL's from 'structure' call
-		lib.Printf("Update structure\n")
-		// Recompute views and DB summaries
-		_, err = lib.ExecCommand(
-			ctx,
-			[]string{
-				cmdPrefix + "structure",
-			},
-			map[string]string{
-				"GHA2DB_SKIPTABLE": "1",
-				"GHA2DB_MGETC":     "y",
-			},
-		)
-		lib.FatalOnError(err)
+	// Ingestion ledger is not used on databases without its table
+	ledger := lib.LedgerAvailable(con, ctx)
+	if !ledger {
+		lib.Printf("%s\n", lib.LedgerUnavailableMessage)
 	}
 
-	// DB2Influx
-	if !ctx.SkipIDB {
-		metricsDir := dataPrefix + "metrics"
-		if ctx.Project != "" {
-			metricsDir += "/" + ctx.Project
-		}
-		// Regenerate points from this date
-		if ctx.ResetIDB {
-			from = ctx.DefaultStartDate
-		} else {
-			from = maxDtIDB
-		}
-		lib.Printf("Influx range: %s - %s\n", lib.ToYMDHDate(from), lib.ToYMDHDate(to))
-
-		// InfluxDB tags (repo groups template variable currently)
-		if ctx.ResetIDB || time.Now().Hour() == 0 {
-			_, err := lib.ExecCommand(ctx, []string{cmdPrefix + "idb_tags"}, nil)
-			lib.FatalOnError(err)
-		} else {
-			lib.Printf("Skipping `idb_tags` recalculation, it is only computed once per day\n")
-		}
-
-		// Annotations
-		if ctx.Project != "" && (ctx.ResetIDB || time.Now().Hour() == 0) {
-			_, err := lib.ExecCommand(
-				ctx,
-				[]string{
-					cmdPrefix + "annotations",
-				},
-				nil,
-			)
-			lib.FatalOnError(err)
-		} else {
-			lib.Printf("Skipping `annotations` recalculation, it is only computed once per day\n")
-		}
-
-		// Get Quick Ranges from IDB (it is filled by annotations command)
-		quickRanges := lib.GetTagValues(ic, ctx, "quick_ranges_suffix")
-		lib.Printf("Quick ranges: %+v\n", quickRanges)
-
-		// Fill gaps in series
-		fillGapsInSeries(ctx, from, to)
-
-		// Read metrics configuration
-		data, err := lib.ReadFile(ctx, dataPrefix+ctx.MetricsYaml)
-		if err != nil {
-			lib.FatalOnError(err)
+	// Only list hours that failed or were not finished (ingestion ledger)
+	if ctx.LedgerList {
+		if !ledger {
 			return
 		}
-		var allMetrics metrics
-		lib.FatalOnError(yaml.Unmarshal(data, &allMetrics))
-
-		// Keep all histograms here
-		var hists [][]string
-
-		// Iterate all metrics
-		for _, metric := range allMetrics.Metrics {
-			extraParams := []string{}
-			if metric.Histogram {
-				extraParams = append(extraParams, "hist")
-			}
-			if metric.MultiValue {
-				extraParams = append(extraParams, "multivalue")
-			}
-			if metric.EscapeValueName {
-				extraParams = append(extraParams, "escape_value_name")
-			}
-			if metric.Desc != "" {
-				extraParams = append(extraParams, "desc:"+metric.Desc)
-			}
-			periods := strings.Split(metric.Periods, ",")
-			aggregate := metric.Aggregate
-			if aggregate == "" {
-				aggregate = "1"
-			}
-			if metric.AnnotationsRanges {
-				extraParams = append(extraParams, "annotations_ranges")
-				periods = quickRanges
-				aggregate = "1"
-			}
-			aggregateArr := strings.Split(aggregate, ",")
-			skips := strings.Split(metric.Skip, ",")
-			skipMap := make(map[string]struct{})
-			for _, skip := range skips {
-				skipMap[skip] = struct{}{}
-			}
-			if !ctx.ResetIDB && !ctx.ResetRanges {
-				extraParams = append(extraParams, "skip_past")
-			}
-			for _, aggrStr := range aggregateArr {
-				_, err := strconv.Atoi(aggrStr)
-				lib.FatalOnError(err)
-				aggrSuffix := aggrStr
-				if aggrSuffix == "1" {
-					aggrSuffix = ""
-				}
-				for _, period := range periods {
-					periodAggr := period + aggrSuffix
-					_, found := skipMap[periodAggr]
-					if found {
-						lib.Printf("Skipped period %s\n", periodAggr)
-						continue
-					}
-					if !ctx.ResetIDB && !lib.ComputePeriodAtThisDate(ctx, period, to) {
-						lib.Printf("Skipping recalculating period \"%s%s\" for date to %v\n", period, aggrSuffix, to)
-						continue
-					}
-					seriesNameOrFunc := metric.SeriesNameOrFunc
-					if metric.AddPeriodToName {
-						seriesNameOrFunc += "_" + periodAggr
-					}
-					// Histogram metrics usualy take long time, but executes single query, so there is no way to
-					// Implement multi threading inside "db2influx" call fro them
-					// So we're creating array of such metrics to be executed at the end - each in a separate go routine
-					if metric.Histogram {
-						lib.Printf("Scheduled histogram metric %v, period %v, desc: '%v', aggregate: '%v' ...\n", metric.Name, period, metric.Desc, aggrSuffix)
-						hists = append(
-							hists,
-							[]string{
-								cmdPrefix + "db2influx",
-								seriesNameOrFunc,
-								fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL),
-								lib.ToYMDHDate(from),
-								lib.ToYMDHDate(to),
-								periodAggr,
-								strings.Join(extraParams, ","),
-							},
-						)
-					} else {
-						lib.Printf("Calculate metric %v, period %v, desc: '%v', aggregate: '%v' ...\n", metric.Name, period, metric.Desc, aggrSuffix)
-						_, err = lib.ExecCommand(
-							ctx,
-							[]string{
-								cmdPrefix + "db2influx",
-								seriesNameOrFunc,
-								fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL),
-								lib.ToYMDHDate(from),
-								lib.ToYMDHDate(to),
-								periodAggr,
-								strings.Join(extraParams, ","),
-							},
-							nil,
-						)
-						lib.FatalOnError(err)
-					}
-				}
-			}
-		}
-		// Process histograms (possibly MT)
-		// Get number of CPUs available
-		thrN := lib.GetThreadsNum(ctx)
-		if thrN > 1 {
-			lib.Printf("Now processing %d histograms using MT%d version\n", len(hists), thrN)
-			ch := make(chan bool)
-			nThreads := 0
-			for _, hist := range hists {
-				go calcHistogram(ch, ctx, hist)
-				nThreads++
-				if nThreads == thrN {
-					<-ch
-					nThreads--
-				}
-			}
-			lib.Printf("Final threads join\n")
-			for nThreads > 0 {
-				<-ch
-				nThreads--
-			}
-		} else {
-			lib.Printf("Now processing %d histograms using ST version\n", len(hists))
-			for _, hist := range hists {
-				calcHistogram(nil, ctx, hist)
-			}
+		entries := lib.LedgerPending(con, ctx, ctx.DefaultStartDate, to, false)
+		lib.Printf("%d hours not imported since %v\n", len(entries), ctx.DefaultStartDate)
+		for _, entry := range entries {
+			fmt.Printf("%s\n", lib.LedgerEntryString(&entry))
 		}
+		return
 	}
-	lib.Printf("Sync success\n")
-}
 
-// calcHistogram - calculate single histogram by calling "db2influx" program with parameters from "hist"
-func calcHistogram(ch chan bool, ctx *lib.Ctx, hist []string) {
-	if len(hist) != 7 {
-		lib.Fatalf("calcHistogram, expected 7 strings, got: %d: %v", len(hist), hist)
-	}
-	lib.Printf(
-		"Calculate histogram %s,%s,%s,%s,%s,%s ...\n",
-		hist[1],
-		hist[2],
-		hist[3],
-		hist[4],
-		hist[5],
-		hist[6],
-	)
-	// Execute "db2influx"
-	_, err := lib.ExecCommand(
-		ctx,
-		[]string{
-			hist[0],
-			hist[1],
-			hist[2],
-			hist[3],
-			hist[4],
-			hist[5],
-			hist[6],
-		},
-		nil,
-	)
+	// Regenerate points from this date
+	idbFrom := maxDtIDB
+	if ctx.ResetIDB {
+		idbFrom = ctx.DefaultStartDate
+	}
+
+	// Run all steps
+	st := syncState{
+		con:        con,
+		store:      store,
+		org:        org,
+		repo:       repo,
+		cmdPrefix:  cmdPrefix,
+		dataPrefix: dataPrefix,
+		from:       from,
+		to:         to,
+		idbFrom:    idbFrom,
+		rows:       make(map[string]int64),
+		points:     make(map[string]int64),
+		ledger:     ledger,
+		clearLogs:  lib.ClearDBLogs,
+	}
+	conditions := map[string]bool{
+		"skip_pdb":   ctx.SkipPDB,
+		"skip_idb":   ctx.SkipIDB,
+		"not_daily":  !ctx.ResetIDB && !ctx.SyncDaily && lib.LocalDayHour(ctx, time.Now()) != 0,
+		"no_project": ctx.Project == "",
+	}
+	if ctx.SyncPlan {
+		lib.PlanPrintf("project '%s', %s/%s\n", ctx.Project, strings.Join(org, "+"), strings.Join(repo, "+"))
+		lib.PlanPrintf("Postgres range: %s - %s\n", lib.ToYMDHDate(from), lib.ToYMDHDate(to))
+		lib.PlanPrintf("Influx range: %s - %s\n", lib.ToYMDHDate(idbFrom), lib.ToYMDHDate(to))
+	}
+	dtStart := time.Now()
+	results, err := lib.RunSyncSteps(ctx, syncSteps(ctx, &st), conditions)
 	lib.FatalOnError(err)
-	// Synchronize go routine
-	if ch != nil {
-		ch <- true
+	if ctx.SyncPlan {
+		lib.Printf("Sync plan finished\n")
+		return
+	}
+	summary, failed := lib.SyncStepsSummary(results)
+	lib.Printf("Sync steps:\n%s", summary)
+
+	// Save run records: all steps and the whole sync
+	runs := lib.SyncRunsFromSteps("gha2db_sync", ctx.Project, results, st.rows, st.points)
+	run := lib.SyncRun{
+		Prog:     "gha2db_sync",
+		Project:  ctx.Project,
+		Step:     lib.SyncRunStep,
+		Start:    dtStart,
+		End:      time.Now(),
+		Status:   lib.SyncStepOK,
+		Attempts: 1,
 	}
+	if failed > 0 {
+		run.Status = lib.SyncStepFailed
+		run.Error = fmt.Sprintf("%d sync steps failed", failed)
+	}
+	for _, stepRun := range runs {
+		run.Rows += stepRun.Rows
+		run.Points += stepRun.Points
+	}
+	err = lib.RecordSyncRuns(ctx, append(runs, run))
+	if err != nil {
+		lib.Printf("Error saving sync runs: %v\n", err)
+	}
+	if failed > 0 {
+		lib.Fatalf("%d sync steps failed", failed)
+	}
+	lib.Printf("Sync success\n")
 }
 
 // Return per project args (if no args given) or get args from command line (if given)
@@ -643,6 +964,14 @@ func getSyncArgs(ctx *lib.Ctx, osArgs []string) []string {
 		if proj.StartDate != nil && !ctx.ForceStartDate {
 			ctx.DefaultStartDate = *proj.StartDate
 		}
+		// Project's time zone, GHA2DB_TMZONE takes precedence
+		// It is also exported, so tools called by sync (like z2influx) use the same time zone
+		if proj.Timezone != "" && ctx.TmZone == nil {
+			loc, err := time.LoadLocation(proj.Timezone)
+			lib.FatalOnError(err)
+			ctx.TmZone = loc
+			lib.FatalOnError(os.Setenv("GHA2DB_TMZONE", proj.Timezone))
+		}
 		return proj.CommandLine
 	}
 	// No user commandline and project not found
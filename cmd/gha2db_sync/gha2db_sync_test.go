@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestSyncGha2dbGapAudit(t *testing.T) {
+	// Fake gha2db command, it records gap audit mode and its arguments
+	dir, err := ioutil.TempDir("", "gha2db_sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	out := filepath.Join(dir, "gha2db.out")
+	script := "#!/bin/sh\necho \"audit=${GHA2DB_GAP_AUDIT} $*\" >> " + out + "\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "gha2db"), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Gap audit enabled for both gha2db_sync and (inherited from environment) gha2db
+	for key, value := range map[string]string{"GHA2DB_GAP_AUDIT": "1", "GHA2DB_SYNC_GAP_AUDIT": "1", "GHA2DB_SKIPLOG": "1"} {
+		old, ok := os.LookupEnv(key)
+		lib.FatalOnError(os.Setenv(key, value))
+		if ok {
+			defer func(key, old string) { _ = os.Setenv(key, old) }(key, old)
+		} else {
+			defer func(key string) { _ = os.Unsetenv(key) }(key)
+		}
+	}
+	var ctx lib.Ctx
+	ctx.Init()
+	ctx.ExecFatal = false
+	if !ctx.SyncGapAudit {
+		t.Errorf("expected sync gap audit mode")
+	}
+
+	// No ingestion ledger (no database), so only new data is imported
+	st := syncState{
+		org:       []string{"kubernetes"},
+		repo:      []string{},
+		cmdPrefix: dir + "/",
+		from:      time.Date(2018, 2, 3, 4, 0, 0, 0, time.UTC),
+		to:        time.Date(2018, 2, 3, 6, 0, 0, 0, time.UTC),
+		rows:      make(map[string]int64),
+	}
+	err = st.gha2db(&ctx)
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "audit= 2018-02-03 4 2018-02-03 6 kubernetes"
+	got := strings.TrimSpace(string(data))
+	if got != expected {
+		t.Errorf("expected gha2db call '%s', got '%s'", expected, got)
+	}
+}
+
+func TestGetSyncArgsTimezone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gha2db_sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	yaml := "projects:\n  kubernetes:\n    command_line:\n      - kubernetes\n    timezone: America/New_York\n"
+	err = ioutil.WriteFile(filepath.Join(dir, "projects.yaml"), []byte(yaml), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.FatalOnError(os.Chdir(dir))
+	defer func() { _ = os.Chdir(wd) }()
+	old, ok := os.LookupEnv("GHA2DB_TMZONE")
+	if ok {
+		defer func() { _ = os.Setenv("GHA2DB_TMZONE", old) }()
+	} else {
+		defer func() { _ = os.Unsetenv("GHA2DB_TMZONE") }()
+	}
+	lib.FatalOnError(os.Unsetenv("GHA2DB_TMZONE"))
+
+	// Time zone is taken from project definition and exported for called tools
+	ctx := lib.Ctx{Project: "kubernetes", Local: true, ProjectsYaml: "projects.yaml"}
+	args := getSyncArgs(&ctx, []string{"gha2db_sync"})
+	if strings.Join(args, " ") != "kubernetes" {
+		t.Errorf("expected args 'kubernetes', got %v", args)
+	}
+	if ctx.TmZone == nil || ctx.TmZone.String() != "America/New_York" || os.Getenv("GHA2DB_TMZONE") != "America/New_York" {
+		t.Errorf("expected time zone America/New_York, got %v (GHA2DB_TMZONE='%s')", ctx.TmZone, os.Getenv("GHA2DB_TMZONE"))
+	}
+
+	// Time zone set by GHA2DB_TMZONE takes precedence
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx = lib.Ctx{Project: "kubernetes", Local: true, ProjectsYaml: "projects.yaml", TmZone: loc}
+	getSyncArgs(&ctx, []string{"gha2db_sync"})
+	if ctx.TmZone != loc {
+		t.Errorf("expected time zone %v, got %v", loc, ctx.TmZone)
+	}
+}
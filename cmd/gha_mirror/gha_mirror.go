@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	lib "devstats"
+)
+
+// Verifies already mirrored file, returns number of JSONs or error
+func verifyFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	return lib.VerifyGHAArchive(file)
+}
+
+// Fetches a single GH Archive hour into local mirror, verifies it and moves into place
+func mirrorHour(ch chan bool, ctx *lib.Ctx, dt time.Time) {
+	defer func() {
+		if ch != nil {
+			ch <- true
+		}
+	}()
+	path := lib.GHAArchiveLocalPath(ctx, dt)
+
+	// Skip files that are already mirrored and valid
+	if _, err := os.Stat(path); err == nil {
+		n, err := verifyFile(path)
+		if err == nil {
+			if ctx.Debug > 0 {
+				lib.Printf("%v: %s already mirrored, %d JSONs\n", dt, path, n)
+			}
+			return
+		}
+		lib.Printf("%v: %s is corrupted (%v), fetching again\n", dt, path, err)
+	}
+
+	// Get gzipped JSON array via HTTP
+	url := lib.GHAArchiveRemoteURL(ctx, dt)
+	response, err := http.Get(url)
+	if err != nil {
+		lib.Printf("%v: Error http.Get %s:\n%v\n", dt, url, err)
+		fmt.Fprintf(os.Stderr, "%v: Error http.Get %s:\n%v\n", dt, url, err)
+		return
+	}
+	defer func() { _ = response.Body.Close() }()
+	if response.StatusCode == http.StatusNotFound {
+		lib.Printf("%v: No data yet, %s not found\n", dt, url)
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		lib.Printf("%v: Error http.Get %s: status %d\n", dt, url, response.StatusCode)
+		fmt.Fprintf(os.Stderr, "%v: Error http.Get %s: status %d\n", dt, url, response.StatusCode)
+		return
+	}
+
+	// Save into temporary file, verify it and then rename to its final name
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	lib.FatalOnError(err)
+	_, err = io.Copy(file, response.Body)
+	lib.FatalOnError(file.Close())
+	if err != nil {
+		lib.Printf("%v: Error downloading %s:\n%v\n", dt, url, err)
+		fmt.Fprintf(os.Stderr, "%v: Error downloading %s:\n%v\n", dt, url, err)
+		_ = os.Remove(tmp)
+		return
+	}
+	n, err := verifyFile(tmp)
+	if err != nil {
+		lib.Printf("%v: Error verifying %s:\n%v\n", dt, url, err)
+		fmt.Fprintf(os.Stderr, "%v: Error verifying %s:\n%v\n", dt, url, err)
+		_ = os.Remove(tmp)
+		return
+	}
+	lib.FatalOnError(os.Rename(tmp, path))
+	lib.Printf("Mirrored %s: %d JSONs\n", path, n)
+}
+
+// Parses day and hour arguments, "today" and "now" are allowed
+func parseDateHour(now time.Time, d, h string) time.Time {
+	var (
+		hour int
+		err  error
+		dt   time.Time
+	)
+	if strings.ToLower(h) == lib.Now {
+		hour = now.Hour()
+	} else {
+		hour, err = strconv.Atoi(h)
+		lib.FatalOnError(err)
+	}
+	if strings.ToLower(d) == lib.Today {
+		dt = lib.DayStart(now).Add(time.Duration(hour) * time.Hour)
+	} else {
+		dt, err = time.Parse(
+			time.RFC3339,
+			fmt.Sprintf("%sT%02d:00:00+00:00", d, hour),
+		)
+		lib.FatalOnError(err)
+	}
+	return dt
+}
+
+// Mirrors GH Archive hours from a given range into GHA2DB_ARCHIVE_DIR
+func ghaMirror(args []string) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+	if ctx.ArchiveDir == "" {
+		lib.Fatalf("you need to set GHA2DB_ARCHIVE_DIR to use mirror tool")
+	}
+	dir := strings.TrimPrefix(ctx.ArchiveDir, "file://")
+	lib.FatalOnError(os.MkdirAll(dir, 0755))
+
+	// Parse date range
+	now := time.Now()
+	dFrom := parseDateHour(now, args[0], args[1])
+	dTo := parseDateHour(now, args[2], args[3])
+
+	// Get number of CPUs available
+	thrN := lib.GetThreadsNum(&ctx)
+	lib.Printf("gha_mirror.go: Running (%v CPUs): %v - %v into %s\n", thrN, dFrom, dTo, dir)
+
+	dt := dFrom
+	if thrN > 1 {
+		ch := make(chan bool)
+		nThreads := 0
+		for dt.Before(dTo) || dt.Equal(dTo) {
+			go mirrorHour(ch, &ctx, dt)
+			dt = dt.Add(time.Hour)
+			nThreads++
+			if nThreads == thrN {
+				<-ch
+				nThreads--
+			}
+		}
+		lib.Printf("Final threads join\n")
+		for nThreads > 0 {
+			<-ch
+			nThreads--
+		}
+	} else {
+		lib.Printf("Using single threaded version\n")
+		for dt.Before(dTo) || dt.Equal(dTo) {
+			mirrorHour(nil, &ctx, dt)
+			dt = dt.Add(time.Hour)
+		}
+	}
+	// Finished
+	lib.Printf("All done.\n")
+}
+
+func main() {
+	dtStart := time.Now()
+	// Required args
+	if len(os.Args) < 5 {
+		lib.Printf(
+			"Arguments required: date_from_YYYY-MM-DD hour_from_HH date_to_YYYY-MM-DD hour_to_HH\n",
+		)
+		os.Exit(1)
+	}
+	ghaMirror(os.Args[1:])
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+}
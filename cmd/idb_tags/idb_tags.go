@@ -1,7 +1,6 @@
 package main
 
 import (
-	"strings"
 	"time"
 
 	lib "devstats"
@@ -15,12 +14,15 @@ type tags struct {
 }
 
 // tag contain each InfluxDB tag data
+// RowTag - tagged metrics row tag (metrics.yaml `row_tag`), it is set to normalized value (the same as ValueTag)
+// so tag values can be matched with tagged metrics rows using the same tag key
 type tag struct {
 	Name       string `yaml:"name"`
 	SQLFile    string `yaml:"sql"`
 	SeriesName string `yaml:"series_name"`
 	NameTag    string `yaml:"name_tag"`
 	ValueTag   string `yaml:"value_tag"`
+	RowTag     string `yaml:"row_tag"`
 }
 
 // Insert InfluxDB tags
@@ -33,9 +35,9 @@ func idbTags() {
 	con := lib.PgConn(&ctx)
 	defer func() { lib.FatalOnError(con.Close()) }()
 
-	// Connect to InfluxDB
-	ic := lib.IDBConn(&ctx)
-	defer func() { lib.FatalOnError(ic.Close()) }()
+	// Connect to series store
+	store := lib.NewSeriesStore(&ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
 
 	// Local or cron mode?
 	dataPrefix := lib.DataDir
@@ -54,15 +56,6 @@ func idbTags() {
 
 	// No fields value needed
 	fields := map[string]interface{}{"value": 0.0}
-	// String value to read tags into
-	strVal := ""
-
-	// Per project directory for SQL files
-	dir := lib.Metrics
-	if ctx.Project != "" {
-		dir += ctx.Project + "/"
-	}
-
 	thrN := lib.GetThreadsNum(&ctx)
 	// Iterate tags
 	ch := make(chan bool)
@@ -76,40 +69,22 @@ func idbTags() {
 				lib.Printf("Tag '%s' --> '%s'\n", tg.Name, tg.SeriesName)
 			}
 
-			// Get BatchPoints
-			var pts lib.IDBBatchPointsN
-			bp := lib.IDBBatchPoints(&ctx, &ic)
-			pts.NPoints = 0
-			pts.Points = &bp
-
-			// Read SQL file
-			bytes, err := lib.ReadFile(&ctx, dataPrefix+dir+tg.SQLFile+".sql")
-			lib.FatalOnError(err)
-			sqlQuery := string(bytes)
+			// Points to write
+			var pts []lib.SeriesPoint
 
-			// Handle excluding bots
-			bytes, err = lib.ReadFile(&ctx, dataPrefix+"util_sql/exclude_bots.sql")
+			// Read tag values
+			values, err := lib.ReadTagValues(con, &ctx, tg.SQLFile)
 			lib.FatalOnError(err)
-			excludeBots := string(bytes)
-
-			// Transform SQL
-			sqlQuery = strings.Replace(sqlQuery, "{{lim}}", "69", -1)
-			sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
-
-			// Execute SQL
-			rows := lib.QuerySQLWithErr(con, &ctx, sqlQuery)
-			defer func() { lib.FatalOnError(rows.Close()) }()
 
 			// Drop current tags
 			if ctx.IDBDrop {
-				lib.QueryIDB(ic, &ctx, "delete from \""+tg.SeriesName+"\"")
+				lib.FatalOnError(store.DropSeries(tg.SeriesName))
 			}
 			tm := lib.TimeParseAny("2014-01-01")
 
 			// Iterate tag values
 			tags := make(map[string]string)
-			for rows.Next() {
-				lib.FatalOnError(rows.Scan(&strVal))
+			for _, strVal := range values {
 				if ctx.Debug > 0 {
 					lib.Printf("'%s': %v\n", tg.SeriesName, strVal)
 				}
@@ -119,15 +94,16 @@ func idbTags() {
 				if tg.ValueTag != "" {
 					tags[tg.ValueTag] = lib.NormalizeName(strVal)
 				}
+				if tg.RowTag != "" {
+					tags[tg.RowTag] = lib.NormalizeName(strVal)
+				}
 				// Add batch point
-				pt := lib.IDBNewPointWithErr(&ctx, tg.SeriesName, tags, fields, tm)
-				lib.IDBAddPointN(&ctx, &ic, &pts, pt)
+				pts = append(pts, lib.NewSeriesPoint(&ctx, tg.SeriesName, tags, fields, tm))
 			}
-			lib.FatalOnError(rows.Err())
 
 			// Write the batch
 			if !ctx.SkipIDB {
-				lib.FatalOnError(lib.IDBWritePointsN(&ctx, &ic, &pts))
+				lib.FatalOnError(store.WritePoints(pts))
 			} else if ctx.Debug > 0 {
 				lib.Printf("Skipping tags series write\n")
 			}
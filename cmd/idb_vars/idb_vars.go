@@ -29,15 +29,12 @@ func idbVars() {
 	var ctx lib.Ctx
 	ctx.Init()
 
-	// Connect to InfluxDB
-	ic := lib.IDBConn(&ctx)
-	defer func() { lib.FatalOnError(ic.Close()) }()
+	// Connect to series store
+	store := lib.NewSeriesStore(&ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
 
-	// Get BatchPoints
-	var pts lib.IDBBatchPointsN
-	bp := lib.IDBBatchPoints(&ctx, &ic)
-	pts.NPoints = 0
-	pts.Points = &bp
+	// Points to write
+	var pts []lib.SeriesPoint
 
 	// Local or cron mode?
 	dataPrefix := lib.DataDir
@@ -68,7 +65,7 @@ func idbVars() {
 		}
 		// Drop current vars
 		if ctx.IDBDrop {
-			lib.QueryIDB(ic, &ctx, "drop series from \""+tag.Tag+"\"")
+			lib.FatalOnError(store.DropSeries(tag.Tag))
 		}
 
 		if len(tag.Command) > 0 {
@@ -91,11 +88,9 @@ func idbVars() {
 		}
 
 		// Insert tag name/value
-		lib.IDBAddPointN(
-			&ctx,
-			&ic,
-			&pts,
-			lib.IDBNewPointWithErr(
+		pts = append(
+			pts,
+			lib.NewSeriesPoint(
 				&ctx,
 				tag.Tag,
 				map[string]string{tag.Name: tag.Value},
@@ -107,7 +102,7 @@ func idbVars() {
 
 	// Write the batch
 	if !ctx.SkipIDB {
-		lib.FatalOnError(lib.IDBWritePointsN(&ctx, &ic, &pts))
+		lib.FatalOnError(store.WritePoints(pts))
 	} else if ctx.Debug > 0 {
 		lib.Printf("Skipping vars series write\n")
 	}
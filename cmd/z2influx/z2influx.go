@@ -10,34 +10,31 @@ import (
 
 // getMatchingSeries returns series name that matches given regexp
 func getMatchingSeries(ctx *lib.Ctx, seriesRegExp string) (seriesSet map[string]struct{}) {
-	// Connect to InfluxDB
-	ic := lib.IDBConn(ctx)
-	defer func() { lib.FatalOnError(ic.Close()) }()
+	// Connect to series store
+	store := lib.NewSeriesStore(ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
 
 	// Create result map
 	seriesSet = make(map[string]struct{})
 
-	// Get series that match given regexp by selecting their last value
+	// Get series that match given regexp
 	lib.Printf("Fetching series names matching %s\n", seriesRegExp)
-	res := lib.QueryIDB(ic, ctx, "select last(*) from "+seriesRegExp)
-	allSeries := res[0].Series
+	allSeries, err := store.MatchingSeries(seriesRegExp)
+	lib.FatalOnError(err)
 	for _, series := range allSeries {
-		seriesSet[series.Name] = struct{}{}
+		seriesSet[series] = struct{}{}
 	}
 	lib.Printf("Found %d series matching %s: %v\n", len(allSeries), seriesRegExp, seriesSet)
 	return
 }
 
-func workerThread(ch chan bool, ctx *lib.Ctx, seriesSet map[string]struct{}, period string, desc bool, values []string, from, to time.Time) {
-	// Connect to InfluxDB
-	ic := lib.IDBConn(ctx)
-	defer func() { lib.FatalOnError(ic.Close()) }()
+func workerThread(ch chan bool, ctx *lib.Ctx, seriesSet map[string]struct{}, period string, desc bool, values []string, tags []map[string]string, from, to time.Time) {
+	// Connect to series store
+	store := lib.NewSeriesStore(ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
 
-	// Get BatchPoints
-	var pts lib.IDBBatchPointsN
-	bp := lib.IDBBatchPoints(ctx, &ic)
-	pts.NPoints = 0
-	pts.Points = &bp
+	// Points to write
+	var pts []lib.SeriesPoint
 
 	// Zero
 	fields := make(map[string]interface{})
@@ -48,31 +45,25 @@ func workerThread(ch chan bool, ctx *lib.Ctx, seriesSet map[string]struct{}, per
 		fields["descr"] = ""
 	}
 
-	// YYYY-MM-DDTHH:MI:SSZ
-	idbFrom := lib.ToIDBDate(from)
-
 	for series := range seriesSet {
 		if ctx.Debug > 0 {
 			lib.Printf("%+v %v - %v %v\n", series, from, to, period)
 		}
 
-		// Support overwite all
+		// Support overwite all: zero all series columns, also those without value at this time
 		if values[0] == "*" {
-			res := lib.QueryIDB(ic, ctx, "select * from \""+series+"\" where time = '"+idbFrom+"'")
-			allSeries := res[0].Series
-			if len(allSeries) == 0 {
+			point, err := store.PointAt(series, from)
+			lib.FatalOnError(err)
+			if point == nil {
 				continue
 			}
-			series := allSeries[0]
-			columns := series.Columns
+			columns, err := store.SeriesFields(series)
+			lib.FatalOnError(err)
 			if ctx.Debug > 0 {
-				lib.Printf("%v %s: * -> %v\n", series, idbFrom, columns)
+				lib.Printf("%v %v: * -> %v\n", series, from, columns)
 			}
 			n := 0
 			for _, column := range columns {
-				if column == lib.TimeCol {
-					continue
-				}
 				fields[column] = 0.0
 				n++
 			}
@@ -81,14 +72,15 @@ func workerThread(ch chan bool, ctx *lib.Ctx, seriesSet map[string]struct{}, per
 			}
 		}
 
-		// Add batch point
-		pt := lib.IDBNewPointWithErr(ctx, series, nil, fields, from)
-		lib.IDBAddPointN(ctx, &ic, &pts, pt)
+		// Add batch point (one per tags set for tagged series)
+		for _, tagSet := range tags {
+			pts = append(pts, lib.NewSeriesPoint(ctx, series, tagSet, fields, from))
+		}
 	}
 
 	// Write the batch
 	if !ctx.SkipIDB {
-		lib.FatalOnError(lib.IDBWritePointsN(ctx, &ic, &pts))
+		lib.FatalOnError(store.WritePoints(pts))
 	} else if ctx.Debug > 0 {
 		lib.Printf("Skipping series write\n")
 	}
@@ -99,7 +91,24 @@ func workerThread(ch chan bool, ctx *lib.Ctx, seriesSet map[string]struct{}, per
 	}
 }
 
-func z2influx(series, from, to, intervalAbbr string, desc bool, values []string) {
+// seriesTags - return tags sets to write zero points with
+// Untagged series have a single nil tags set, tagged series have "period" tag and optionally
+// tagKey tag set to all tagValues (tags option "tags:tagKey=value1;value2;...;valueN")
+func seriesTags(intervalAbbr string, tagged bool, tagKey string, tagValues []string) []map[string]string {
+	if !tagged {
+		return []map[string]string{nil}
+	}
+	if tagKey == "" {
+		return []map[string]string{{"period": intervalAbbr}}
+	}
+	tags := []map[string]string{}
+	for _, value := range tagValues {
+		tags = append(tags, map[string]string{"period": intervalAbbr, tagKey: value})
+	}
+	return tags
+}
+
+func z2influx(series, from, to, intervalAbbr string, desc bool, values []string, tagged bool, tagKey string, tagValues []string) {
 	// Environment context parse
 	var ctx lib.Ctx
 	ctx.Init()
@@ -122,13 +131,16 @@ func z2influx(series, from, to, intervalAbbr string, desc bool, values []string)
 	dFrom := lib.TimeParseAny(from)
 	dTo := lib.TimeParseAny(to)
 
-	// Process interval
-	interval, _, intervalStart, nextIntervalStart, _ := lib.GetIntervalFunctions(intervalAbbr, false)
+	// Process interval (the same way as metrics are calculated)
+	interval, _, intervalStart, nextIntervalStart, _ := lib.GetIntervalFunctionsInZone(intervalAbbr, false, ctx.TmZone)
 
 	// Round dates to the given interval
 	dFrom = intervalStart(dFrom)
 	dTo = nextIntervalStart(dTo)
 
+	// Tags sets
+	tags := seriesTags(intervalAbbr, tagged, tagKey, tagValues)
+
 	// Get number of CPUs available
 	thrN := lib.GetThreadsNum(&ctx)
 
@@ -145,7 +157,7 @@ func z2influx(series, from, to, intervalAbbr string, desc bool, values []string)
 		nThreads := 0
 		for dt.Before(dTo) {
 			nDt := nextIntervalStart(dt)
-			go workerThread(ch, &ctx, seriesSet, intervalAbbr, desc, values, dt, nDt)
+			go workerThread(ch, &ctx, seriesSet, intervalAbbr, desc, values, tags, dt, nDt)
 			dt = nDt
 			nThreads++
 			if nThreads == thrN {
@@ -162,7 +174,7 @@ func z2influx(series, from, to, intervalAbbr string, desc bool, values []string)
 		lib.Printf("Using single threaded version\n")
 		for dt.Before(dTo) {
 			nDt := nextIntervalStart(dt)
-			workerThread(nil, &ctx, seriesSet, intervalAbbr, desc, values, dt, nDt)
+			workerThread(nil, &ctx, seriesSet, intervalAbbr, desc, values, tags, dt, nDt)
 			dt = nDt
 		}
 	}
@@ -175,13 +187,17 @@ func main() {
 	if len(os.Args) < 5 {
 		lib.Printf("%s: Required args: 'series1,series2,..' from to period\n"+
 			"Example: 's1,s2,s3' 2015-08-03 2017-08-04' h|d|w|m|q|y [desc,values:value1;value2;...;valueN]\n"+
-			"Example: '/^open_(issues|prs)_sigs_milestones/' 2015-08-03 2017-08-04' h|d|w|m|q|y 'values:*'\n",
+			"Example: '/^open_(issues|prs)_sigs_milestones/' 2015-08-03 2017-08-04' h|d|w|m|q|y 'values:*'\n"+
+			"Example: 'company_issues' 2015-08-03 2017-08-04' h|d|w|m|q|y 'tags:company=google;red_hat' (tagged series)\n",
 			os.Args[0],
 		)
 		os.Exit(1)
 	}
 	desc := false
 	values := []string{}
+	tagged := false
+	tagKey := ""
+	tagValues := []string{}
 	if len(os.Args) > 5 {
 		opts := strings.Split(os.Args[5], ",")
 		optMap := make(map[string]string)
@@ -201,11 +217,21 @@ func main() {
 			sValues := d
 			values = strings.Split(sValues, ";")
 		}
+		if d, ok := optMap["tags"]; ok {
+			tagged = true
+			if d != "" {
+				ary := strings.SplitN(d, "=", 2)
+				tagKey = ary[0]
+				if len(ary) > 1 && ary[1] != "" {
+					tagValues = strings.Split(ary[1], ";")
+				}
+			}
+		}
 	}
 	if len(values) == 0 {
 		values = []string{"value"}
 	}
-	z2influx(os.Args[1], os.Args[2], os.Args[3], os.Args[4], desc, values)
+	z2influx(os.Args[1], os.Args[2], os.Args[3], os.Args[4], desc, values, tagged, tagKey, tagValues)
 	dtEnd := time.Now()
 	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
 }
@@ -47,3 +47,6 @@ const Unset string = "{{unset}}"
 
 // TimeCol - common constant string
 const TimeCol string = "time"
+
+// RepoRegexpPrefix - common constant string
+const RepoRegexpPrefix string = "regexp:"
@@ -77,10 +77,11 @@ type Ctx struct {
 	ProjectsCommits     string          // From GHA2DB_PROJECTS_COMMITS get_repos tool, set list of projects for commits analysis instead of analysing all, default "" - means all
 	ProjectsYaml        string          // From GHA2DB_PROJECTS_YAML, many tools - set main projects file, default "projects.yaml"
 	ProjectsOverride    map[string]bool // From GHA2DB_PROJECTS_OVERRIDE, get_repos and ./devstats tools - for example "-pro1,+pro2" means never sync pro1 and always sync pro2 (even if disabled in `projects.yaml`).
-	ExcludeRepos        map[string]bool // From GHA2DB_EXCLUDE_REPOS, gha2db tool, default "" - comma separated list of repos to exclude, example: "theupdateframework/notary,theupdateframework/other"
+	ExcludeRepos        map[string]bool // From GHA2DB_EXCLUDE_REPOS, gha2db tool, default "" - comma separated list of repos to exclude, example: "theupdateframework/notary,theupdateframework/other", glob and "regexp:" patterns are supported
 	InputDBs            []string        // From GHA2DB_INPUT_DBS, merge_pdbs tool - list of input databases to merge, order matters - first one will insert on a clean DB, next will do insert ignore (to avoid constraints failure due to common data)
 	OutputDB            string          // From GHA2DB_OUTPUT_DB, merge_pdbs tool - output database to merge into
 	TmOffset            int             // From GHA2DB_TMOFFSET, gha2db_sync tool - uses time offset to decide when to calculate various metrics, default offset is 0 which means UTC, good offset for USA is -6, and for Poland is 1 or 2
+	TmZone              *time.Location  // From GHA2DB_TMZONE, gha2db_sync and z2influx tools - time zone (IANA name like "America/New_York") used to decide when to calculate various metrics and where day and longer metrics periods start, DST aware, overrides GHA2DB_TMOFFSET, default "" (not set), set from project's "timezone"
 	DefaultHostname     string          // "devstats.cncf.io"
 	RecentRange         string          // From GHA2DB_RECENT_RANGE, ghapi2db tool, default '2 hours'. This is a recent period to check open issues/PR to fix their labels and milestones.
 	MinGHAPIPoints      int             // From GHA2DB_MIN_GHAPI_POINTS, ghapi2db tool, minimum GitHub API points, before waiting for reset.
@@ -89,6 +90,40 @@ type Ctx struct {
 	SkipGetRepos        bool            // From GHA2DB_GETREPOSSKIP, get_repos tool, if set then tool does nothing
 	OnlyIssues          []int64         // From GHA2DB_ONLY_ISSUES, ghapi2db tool, process a user provided list of issues "issue_id1,issue_id2,...,issue_idN", default "". This is for debugging.
 	IDBDrop             bool            // From GHA2DB_IDB_DROP_SERIES all Influx related tools, if set "drop " series statement will be executed before adding new data, it is sometimes very very very slow on Influx v1.5.1
+	ArchiveURL          string          // From GHA2DB_ARCHIVE_URL, gha2db and gha_mirror tools, remote GH Archive URL, default "http://data.gharchive.org/"
+	ArchiveDir          string          // From GHA2DB_ARCHIVE_DIR, gha2db and gha_mirror tools, local GH Archive mirror directory (can be "/path" or "file:///path") with YYYY-MM-DD-H.json.gz files, default "" - no local mirror
+	ArchiveOffline      bool            // From GHA2DB_ARCHIVE_OFFLINE, gha2db tool, if set then only local GH Archive mirror is used (requires GHA2DB_ARCHIVE_DIR), default false
+	LedgerList          bool            // From GHA2DB_LEDGER_LIST, gha2db and gha2db_sync tools, only list hours that are not imported (missing or failed in gha_ingest_hours ingestion ledger) and exit, default false
+	LedgerRetry         bool            // From GHA2DB_LEDGER_RETRY, gha2db tool, only process hours from a given range that are not imported (missing or failed in gha_ingest_hours), default false
+	BatchRows           int             // From GHA2DB_BATCH_ROWS, gha2db tool, if > 0 then rows are written using multi row inserts, in batches of at least that many rows, default 0 - insert row by row
+	GapAudit            bool            // From GHA2DB_GAP_AUDIT, gha2db tool, only report hours from a given range with no imported events and no successful ledger entry and exit, default false
+	GapAuditMark        bool            // From GHA2DB_GAP_AUDIT_MARK, gha2db tool, when in gap audit mode: record missing hours in ingestion ledger, so next gha2db_sync run retries them, default false
+	SyncGapAudit        bool            // From GHA2DB_SYNC_GAP_AUDIT, gha2db_sync tool, audit all hours since GHA2DB_STARTDT, mark missing ones in ingestion ledger and retry them before importing new data, default false
+	Sinks               []string        // From GHA2DB_SINKS, gha2db tool, comma separated list of event sinks: postgres, ndjson, parquet, default "postgres", GHA2DB_NODB removes postgres sink
+	SinkDir             string          // From GHA2DB_SINK_DIR, gha2db tool, output directory for ndjson and parquet sinks (files are partitioned by day), required when any of them is used, default ""
+	EventTypes          map[string]bool // From GHA2DB_EVENT_TYPES, gha2db tool, default "" (all event types) - comma separated list of event types to import, example: "PushEvent,PullRequestEvent,IssuesEvent"
+	ExcludeEventTypes   map[string]bool // From GHA2DB_EXCLUDE_EVENT_TYPES, gha2db tool, default "" - comma separated list of event types to skip, example: "WatchEvent,GollumEvent"
+	MatchRepoIDs        bool            // From GHA2DB_MATCH_REPO_IDS, gha2db tool, also match repositories by ID: all repositories that have any name (in gha_repo_names or gha_repos) matching org/repo criteria are imported under all their names, default false
+	SyncYaml            string          // From GHA2DB_SYNC_YAML gha2db_sync tool, set other sync.yaml file (sync steps overrides), default is "metrics/{{project}}/sync.yaml", it is optional
+	ExecDeadline        time.Time       // default zero (no deadline), set this manually to kill commands run by lib.ExecCommand that are still running after this time
+	SyncProjectsN       int             // From GHA2DB_SYNC_PROJECTS, devstats tool, number of projects synced in parallel, default 1
+	SyncBudget          int             // From GHA2DB_SYNC_BUDGET, devstats tool, total number of workers (CPUs and DB connections) used by all projects synced in parallel, default 0 (which means number of CPUs, see GetThreadsNum)
+	LockFile            string          // From GHA2DB_LOCK_FILE, devstats tool, lock file (flock(2) locked while running, contains PID, host and lock time for reporting), default "/tmp/devstats.pid"
+	PgLock              bool            // From GHA2DB_PG_LOCK, devstats tool, also use Postgres advisory lock (hosts using the same database cannot sync at the same time), default false
+	SkipSyncRuns        bool            // From GHA2DB_SKIP_SYNC_RUNS, gha2db_sync and devstats tools, do not save sync run records (project, step, start, end, status, rows, points, error) in `devstats`.`gha_sync_runs` table, default false
+	MaxSyncAge          time.Duration   // From GHA2DB_MAX_SYNC_AGE, devstats tool report command, project is reported as stale when its last successful sync is older, default "3h"
+	ExporterAddr        string          // From GHA2DB_EXPORTER_ADDR, exporter tool, address to serve Prometheus metrics on, default ":9292"
+	ExporterPath        string          // From GHA2DB_EXPORTER_PATH, exporter tool, metrics endpoint path, default "/metrics"
+	SyncOnlySteps       map[string]bool // From GHA2DB_SYNC_STEPS, gha2db_sync tool, comma separated list of steps to run (other steps are skipped), default "" - all steps
+	SyncDaily           bool            // From GHA2DB_SYNC_DAILY, gha2db_sync tool, always run steps that are normally only run once a day (at hour 0): idb_tags, annotations, default false
+	DaemonYaml          string          // From GHA2DB_DAEMON_YAML, devstats tool daemon mode, jobs schedule file, default "daemon.yaml"
+	DaemonAddr          string          // From GHA2DB_DAEMON_ADDR, devstats tool daemon mode, address to listen on for triggers and status, default "127.0.0.1:1983"
+	SyncPlan            bool            // From GHA2DB_SYNC_PLAN, gha2db_sync tool, only print what sync would do (date ranges, steps, commands, metrics, histograms and gaps to fill) without executing it, default false
+	SkipWatermarks      bool            // From GHA2DB_SKIP_WATERMARKS, gha2db_sync tool, do not use per metric and period watermarks (`gha_metric_watermarks` table), all metrics are calculated from the last GHA2DB_LASTSERIES point, default false
+	SeriesStore         string          // From GHA2DB_SERIES_STORE, all tools writing or reading time series, series store backend: "influx" (uses IDB_* variables) or "postgres" (uses project's PG_DB), default "influx"
+	PromExportURL       string          // From GHA2DB_PROM_EXPORT_URL, all tools writing time series, also export all written points (db2influx results and others) to Prometheus compatible storage at this URL, default "" - no export
+	PromExportFormat    string          // From GHA2DB_PROM_EXPORT_FORMAT, all tools writing time series, export format: "remote_write" (snappy compressed protobuf) or "openmetrics" (OpenMetrics text with timestamps), default "remote_write"
+	PromExportMaxAge    time.Duration   // From GHA2DB_PROM_EXPORT_MAX_AGE, all tools writing time series, only export points not older than this (receiver must accept out-of-order samples that old), older points (historical recalculations) are skipped, "0" - no limit, default "168h"
 }
 
 // Init - get context from environment variables
@@ -235,6 +270,11 @@ func (ctx *Ctx) Init() {
 		FatalNoLog(err)
 		ctx.TmOffset = off
 	}
+	if os.Getenv("GHA2DB_TMZONE") != "" {
+		loc, err := time.LoadLocation(os.Getenv("GHA2DB_TMZONE"))
+		FatalNoLog(err)
+		ctx.TmZone = loc
+	}
 
 	// Default start date
 	if os.Getenv("GHA2DB_STARTDT") != "" {
@@ -296,6 +336,7 @@ func (ctx *Ctx) Init() {
 	ctx.TagsYaml = os.Getenv("GHA2DB_TAGS_YAML")
 	ctx.IVarsYaml = os.Getenv("GHA2DB_IVARS_YAML")
 	ctx.PVarsYaml = os.Getenv("GHA2DB_PVARS_YAML")
+	ctx.SyncYaml = os.Getenv("GHA2DB_SYNC_YAML")
 	if ctx.MetricsYaml == "" {
 		ctx.MetricsYaml = "metrics/" + proj + "metrics.yaml"
 	}
@@ -311,6 +352,9 @@ func (ctx *Ctx) Init() {
 	if ctx.PVarsYaml == "" {
 		ctx.PVarsYaml = "metrics/" + proj + "pdb_vars.yaml"
 	}
+	if ctx.SyncYaml == "" {
+		ctx.SyncYaml = "metrics/" + proj + "sync.yaml"
+	}
 
 	// GitHub OAuth
 	ctx.GitHubOAuth = os.Getenv("GHA2DB_GITHUB_OAUTH")
@@ -462,6 +506,188 @@ func (ctx *Ctx) Init() {
 		ctx.RecentRange = "2 hours"
 	}
 
+	// GH Archive: remote URL, local mirror and offline mode
+	ctx.ArchiveURL = os.Getenv("GHA2DB_ARCHIVE_URL")
+	if ctx.ArchiveURL == "" {
+		ctx.ArchiveURL = "http://data.gharchive.org/"
+	}
+	if ctx.ArchiveURL[len(ctx.ArchiveURL)-1:] != "/" {
+		ctx.ArchiveURL += "/"
+	}
+	ctx.ArchiveDir = os.Getenv("GHA2DB_ARCHIVE_DIR")
+	if ctx.ArchiveDir != "" && ctx.ArchiveDir[len(ctx.ArchiveDir)-1:] != "/" {
+		ctx.ArchiveDir += "/"
+	}
+	ctx.ArchiveOffline = os.Getenv("GHA2DB_ARCHIVE_OFFLINE") != ""
+	if ctx.ArchiveOffline && ctx.ArchiveDir == "" {
+		FatalNoLog(fmt.Errorf("GHA2DB_ARCHIVE_OFFLINE requires GHA2DB_ARCHIVE_DIR"))
+	}
+
+	// Ingestion ledger modes
+	ctx.LedgerList = os.Getenv("GHA2DB_LEDGER_LIST") != ""
+	ctx.LedgerRetry = os.Getenv("GHA2DB_LEDGER_RETRY") != ""
+
+	// Gap audit mode
+	ctx.GapAudit = os.Getenv("GHA2DB_GAP_AUDIT") != ""
+	ctx.GapAuditMark = os.Getenv("GHA2DB_GAP_AUDIT_MARK") != ""
+	ctx.SyncGapAudit = os.Getenv("GHA2DB_SYNC_GAP_AUDIT") != ""
+
+	// Event sinks, GHA2DB_NODB removes Postgres sink
+	sinks := os.Getenv("GHA2DB_SINKS")
+	if sinks == "" {
+		sinks = SinkPostgres
+	}
+	ctx.Sinks = []string{}
+	fileSinks := false
+	for _, sink := range strings.Split(sinks, ",") {
+		sink = strings.TrimSpace(sink)
+		if !ValidSink(sink) {
+			FatalNoLog(fmt.Errorf("unknown sink: '%s'", sink))
+		}
+		if sink == SinkPostgres {
+			if !ctx.DBOut {
+				continue
+			}
+		} else {
+			fileSinks = true
+		}
+		ctx.Sinks = append(ctx.Sinks, sink)
+	}
+	ctx.DBOut = false
+	for _, sink := range ctx.Sinks {
+		if sink == SinkPostgres {
+			ctx.DBOut = true
+		}
+	}
+	ctx.SinkDir = os.Getenv("GHA2DB_SINK_DIR")
+	if fileSinks && ctx.SinkDir == "" {
+		FatalNoLog(fmt.Errorf("GHA2DB_SINKS: ndjson and parquet sinks require GHA2DB_SINK_DIR"))
+	}
+
+	// Event types to import/skip
+	eventTypes := os.Getenv("GHA2DB_EVENT_TYPES")
+	ctx.EventTypes = make(map[string]bool)
+	if eventTypes != "" {
+		for _, eventType := range strings.Split(eventTypes, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if eventType != "" {
+				ctx.EventTypes[eventType] = true
+			}
+		}
+	}
+	excludeEventTypes := os.Getenv("GHA2DB_EXCLUDE_EVENT_TYPES")
+	ctx.ExcludeEventTypes = make(map[string]bool)
+	if excludeEventTypes != "" {
+		for _, eventType := range strings.Split(excludeEventTypes, ",") {
+			eventType = strings.TrimSpace(eventType)
+			if eventType != "" {
+				ctx.ExcludeEventTypes[eventType] = true
+			}
+		}
+	}
+
+	// Match repositories by ID
+	ctx.MatchRepoIDs = os.Getenv("GHA2DB_MATCH_REPO_IDS") != ""
+
+	// Parallel projects sync
+	ctx.SyncProjectsN = 1
+	if os.Getenv("GHA2DB_SYNC_PROJECTS") != "" {
+		syncProjectsN, err := strconv.Atoi(os.Getenv("GHA2DB_SYNC_PROJECTS"))
+		FatalNoLog(err)
+		if syncProjectsN > 0 {
+			ctx.SyncProjectsN = syncProjectsN
+		}
+	}
+	if os.Getenv("GHA2DB_SYNC_BUDGET") != "" {
+		syncBudget, err := strconv.Atoi(os.Getenv("GHA2DB_SYNC_BUDGET"))
+		FatalNoLog(err)
+		if syncBudget > 0 {
+			ctx.SyncBudget = syncBudget
+		}
+	}
+
+	// Sync locks
+	ctx.LockFile = os.Getenv("GHA2DB_LOCK_FILE")
+	if ctx.LockFile == "" {
+		ctx.LockFile = "/tmp/devstats.pid"
+	}
+	ctx.PgLock = os.Getenv("GHA2DB_PG_LOCK") != ""
+
+	// Sync runs
+	ctx.SkipSyncRuns = os.Getenv("GHA2DB_SKIP_SYNC_RUNS") != ""
+	ctx.MaxSyncAge = 3 * time.Hour
+	if os.Getenv("GHA2DB_MAX_SYNC_AGE") != "" {
+		maxSyncAge, err := time.ParseDuration(os.Getenv("GHA2DB_MAX_SYNC_AGE"))
+		FatalNoLog(err)
+		if maxSyncAge > 0 {
+			ctx.MaxSyncAge = maxSyncAge
+		}
+	}
+
+	// Prometheus exporter
+	ctx.ExporterAddr = os.Getenv("GHA2DB_EXPORTER_ADDR")
+	if ctx.ExporterAddr == "" {
+		ctx.ExporterAddr = ":9292"
+	}
+	ctx.ExporterPath = os.Getenv("GHA2DB_EXPORTER_PATH")
+	if ctx.ExporterPath == "" {
+		ctx.ExporterPath = "/metrics"
+	}
+
+	// Daemon mode and scheduled sync steps
+	ctx.SyncOnlySteps = make(map[string]bool)
+	for _, step := range strings.Split(os.Getenv("GHA2DB_SYNC_STEPS"), ",") {
+		step = strings.TrimSpace(step)
+		if step != "" {
+			ctx.SyncOnlySteps[step] = true
+		}
+	}
+	ctx.SyncDaily = os.Getenv("GHA2DB_SYNC_DAILY") != ""
+	ctx.DaemonYaml = os.Getenv("GHA2DB_DAEMON_YAML")
+	if ctx.DaemonYaml == "" {
+		ctx.DaemonYaml = "daemon.yaml"
+	}
+	ctx.DaemonAddr = os.Getenv("GHA2DB_DAEMON_ADDR")
+	if ctx.DaemonAddr == "" {
+		ctx.DaemonAddr = "127.0.0.1:1983"
+	}
+
+	// Sync plan (dry run) mode
+	ctx.SyncPlan = os.Getenv("GHA2DB_SYNC_PLAN") != ""
+
+	// Metrics watermarks
+	ctx.SkipWatermarks = os.Getenv("GHA2DB_SKIP_WATERMARKS") != ""
+
+	// Time series store
+	ctx.SeriesStore = os.Getenv("GHA2DB_SERIES_STORE")
+	if ctx.SeriesStore == "" {
+		ctx.SeriesStore = "influx"
+	}
+
+	// Prometheus export
+	ctx.PromExportURL = os.Getenv("GHA2DB_PROM_EXPORT_URL")
+	ctx.PromExportFormat = os.Getenv("GHA2DB_PROM_EXPORT_FORMAT")
+	if ctx.PromExportFormat == "" {
+		ctx.PromExportFormat = "remote_write"
+	}
+	ctx.PromExportMaxAge = 168 * time.Hour
+	if os.Getenv("GHA2DB_PROM_EXPORT_MAX_AGE") != "" {
+		maxAge, err := time.ParseDuration(os.Getenv("GHA2DB_PROM_EXPORT_MAX_AGE"))
+		FatalNoLog(err)
+		ctx.PromExportMaxAge = maxAge
+	}
+
+	// Batch inserts
+	if os.Getenv("GHA2DB_BATCH_ROWS") == "" {
+		ctx.BatchRows = 0
+	} else {
+		batchRows, err := strconv.Atoi(os.Getenv("GHA2DB_BATCH_ROWS"))
+		FatalNoLog(err)
+		if batchRows > 0 {
+			ctx.BatchRows = batchRows
+		}
+	}
+
 	issues := os.Getenv("GHA2DB_ONLY_ISSUES")
 	if issues == "" {
 		ctx.OnlyIssues = []int64{}
@@ -90,8 +90,43 @@ func copyContext(in *lib.Ctx) *lib.Ctx {
 		InputDBs:            in.InputDBs,
 		OutputDB:            in.OutputDB,
 		TmOffset:            in.TmOffset,
+		TmZone:              in.TmZone,
 		RecentRange:         in.RecentRange,
 		OnlyIssues:          in.OnlyIssues,
+		ArchiveURL:          in.ArchiveURL,
+		ArchiveDir:          in.ArchiveDir,
+		ArchiveOffline:      in.ArchiveOffline,
+		BatchRows:           in.BatchRows,
+		LedgerList:          in.LedgerList,
+		LedgerRetry:         in.LedgerRetry,
+		GapAudit:            in.GapAudit,
+		GapAuditMark:        in.GapAuditMark,
+		Sinks:               in.Sinks,
+		SinkDir:             in.SinkDir,
+		EventTypes:          in.EventTypes,
+		ExcludeEventTypes:   in.ExcludeEventTypes,
+		MatchRepoIDs:        in.MatchRepoIDs,
+		SyncYaml:            in.SyncYaml,
+		ExecDeadline:        in.ExecDeadline,
+		SyncProjectsN:       in.SyncProjectsN,
+		SyncBudget:          in.SyncBudget,
+		LockFile:            in.LockFile,
+		PgLock:              in.PgLock,
+		SkipSyncRuns:        in.SkipSyncRuns,
+		MaxSyncAge:          in.MaxSyncAge,
+		ExporterAddr:        in.ExporterAddr,
+		ExporterPath:        in.ExporterPath,
+		SyncOnlySteps:       in.SyncOnlySteps,
+		SyncDaily:           in.SyncDaily,
+		DaemonYaml:          in.DaemonYaml,
+		DaemonAddr:          in.DaemonAddr,
+		SyncPlan:            in.SyncPlan,
+		SkipWatermarks:      in.SkipWatermarks,
+		SeriesStore:         in.SeriesStore,
+		PromExportURL:       in.PromExportURL,
+		PromExportFormat:    in.PromExportFormat,
+		PromExportMaxAge:    in.PromExportMaxAge,
+		SyncGapAudit:        in.SyncGapAudit,
 	}
 	return &out
 }
@@ -148,6 +183,22 @@ func dynamicSetFields(t *testing.T, ctx *lib.Ctx, fields map[string]interface{})
 				return ctx
 			}
 			field.Set(reflect.ValueOf(fieldValue))
+		case time.Duration:
+			// Check if types match
+			fieldType := field.Type()
+			if fieldType != reflect.TypeOf(time.Duration(0)) {
+				t.Errorf("trying to set value %v, type %T for field \"%s\", type %v", interfaceValue, interfaceValue, fieldName, fieldKind)
+				return ctx
+			}
+			field.Set(reflect.ValueOf(fieldValue))
+		case *time.Location:
+			// Check if types match
+			fieldType := field.Type()
+			if fieldType != reflect.TypeOf(time.UTC) {
+				t.Errorf("trying to set value %v, type %T for field \"%s\", type %v", interfaceValue, interfaceValue, fieldName, fieldKind)
+				return ctx
+			}
+			field.Set(reflect.ValueOf(fieldValue))
 		case []int:
 			// Check if types match
 			fieldType := field.Type()
@@ -269,8 +320,49 @@ func TestInit(t *testing.T) {
 		InputDBs:            []string{},
 		OutputDB:            "",
 		TmOffset:            0,
+		TmZone:              nil,
 		RecentRange:         "2 hours",
 		OnlyIssues:          []int64{},
+		ArchiveURL:          "http://data.gharchive.org/",
+		ArchiveDir:          "",
+		ArchiveOffline:      false,
+		BatchRows:           0,
+		LedgerList:          false,
+		LedgerRetry:         false,
+		GapAudit:            false,
+		GapAuditMark:        false,
+		Sinks:               []string{"postgres"},
+		SinkDir:             "",
+		EventTypes:          map[string]bool{},
+		ExcludeEventTypes:   map[string]bool{},
+		MatchRepoIDs:        false,
+		SyncYaml:            "metrics/sync.yaml",
+		ExecDeadline:        time.Time{},
+		SyncProjectsN:       1,
+		SyncBudget:          0,
+		LockFile:            "/tmp/devstats.pid",
+		PgLock:              false,
+		SkipSyncRuns:        false,
+		MaxSyncAge:          3 * time.Hour,
+		ExporterAddr:        ":9292",
+		ExporterPath:        "/metrics",
+		SyncOnlySteps:       map[string]bool{},
+		SyncDaily:           false,
+		DaemonYaml:          "daemon.yaml",
+		DaemonAddr:          "127.0.0.1:1983",
+		SyncPlan:            false,
+		SkipWatermarks:      false,
+		SeriesStore:         "influx",
+		PromExportURL:       "",
+		PromExportFormat:    "remote_write",
+		PromExportMaxAge:    168 * time.Hour,
+		SyncGapAudit:        false,
+	}
+
+	// Time zone used in tests
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatalf("cannot load time zone: %v", err)
 	}
 
 	// Test cases
@@ -371,7 +463,7 @@ func TestInit(t *testing.T) {
 			dynamicSetFields(
 				t,
 				copyContext(&defaultContext),
-				map[string]interface{}{"JSONOut": true, "DBOut": false},
+				map[string]interface{}{"JSONOut": true, "DBOut": false, "Sinks": []string{}},
 			),
 		},
 		{
@@ -392,6 +484,15 @@ func TestInit(t *testing.T) {
 				map[string]interface{}{"TmOffset": 5},
 			),
 		},
+		{
+			"Setting TmZone",
+			map[string]string{"GHA2DB_TMZONE": "Europe/Warsaw", "GHA2DB_TMOFFSET": "-6"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"TmZone": warsaw, "TmOffset": -6},
+			),
+		},
 		{
 			"Setting Postgres parameters",
 			map[string]string{
@@ -638,6 +739,7 @@ func TestInit(t *testing.T) {
 				"GHA2DB_TAGS_YAML":    "/t/g/s.yml",
 				"GHA2DB_IVARS_YAML":   "/vari.yml",
 				"GHA2DB_PVARS_YAML":   "/varp.yml",
+				"GHA2DB_SYNC_YAML":    "/sync.yml",
 			},
 			dynamicSetFields(
 				t,
@@ -648,6 +750,7 @@ func TestInit(t *testing.T) {
 					"TagsYaml":    "/t/g/s.yml",
 					"IVarsYaml":   "/vari.yml",
 					"PVarsYaml":   "/varp.yml",
+					"SyncYaml":    "/sync.yml",
 				},
 			),
 		},
@@ -773,6 +876,7 @@ func TestInit(t *testing.T) {
 					"TagsYaml":    "metrics/prometheus/idb_tags.yaml",
 					"IVarsYaml":   "metrics/prometheus/idb_vars.yaml",
 					"PVarsYaml":   "metrics/prometheus/pdb_vars.yaml",
+					"SyncYaml":    "metrics/prometheus/sync.yaml",
 				},
 			),
 		},
@@ -792,6 +896,7 @@ func TestInit(t *testing.T) {
 					"TagsYaml":    "metrics/prometheus/idb_tags.yaml",
 					"IVarsYaml":   "metrics/prometheus/idb_vars.yaml",
 					"PVarsYaml":   "metrics/prometheus/pdb_vars.yaml",
+					"SyncYaml":    "metrics/prometheus/sync.yaml",
 				},
 			),
 		},
@@ -1007,6 +1112,275 @@ func TestInit(t *testing.T) {
 				},
 			),
 		},
+		{
+			"Setting GH Archive URL, local mirror and offline mode",
+			map[string]string{
+				"GHA2DB_ARCHIVE_URL":     "https://mirror.example.com/gha",
+				"GHA2DB_ARCHIVE_DIR":     "file:///data/gha",
+				"GHA2DB_ARCHIVE_OFFLINE": "1",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"ArchiveURL":     "https://mirror.example.com/gha/",
+					"ArchiveDir":     "file:///data/gha/",
+					"ArchiveOffline": true,
+				},
+			),
+		},
+		{
+			"Setting batch rows",
+			map[string]string{"GHA2DB_BATCH_ROWS": "1000"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"BatchRows": 1000},
+			),
+		},
+		{
+			"Setting negative batch rows",
+			map[string]string{"GHA2DB_BATCH_ROWS": "-1"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"BatchRows": 0},
+			),
+		},
+		{
+			"Setting ingestion ledger list & retry modes",
+			map[string]string{
+				"GHA2DB_LEDGER_LIST":  "1",
+				"GHA2DB_LEDGER_RETRY": "y",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"LedgerList":  true,
+					"LedgerRetry": true,
+				},
+			),
+		},
+		{
+			"Setting gap audit mode",
+			map[string]string{
+				"GHA2DB_GAP_AUDIT":      "1",
+				"GHA2DB_GAP_AUDIT_MARK": "1",
+				"GHA2DB_SYNC_GAP_AUDIT": "1",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"GapAudit":     true,
+					"GapAuditMark": true,
+					"SyncGapAudit": true,
+				},
+			),
+		},
+		{
+			"Setting event sinks",
+			map[string]string{
+				"GHA2DB_SINKS":    "postgres, ndjson,parquet",
+				"GHA2DB_SINK_DIR": "/data/events",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"Sinks":   []string{"postgres", "ndjson", "parquet"},
+					"SinkDir": "/data/events",
+				},
+			),
+		},
+		{
+			"Setting event sinks without Postgres",
+			map[string]string{
+				"GHA2DB_SINKS":    "postgres,ndjson",
+				"GHA2DB_SINK_DIR": "/data/events",
+				"GHA2DB_NODB":     "1",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"Sinks":   []string{"ndjson"},
+					"SinkDir": "/data/events",
+					"DBOut":   false,
+				},
+			),
+		},
+		{
+			"Setting event types include and exclude lists",
+			map[string]string{
+				"GHA2DB_EVENT_TYPES":         "PushEvent, PullRequestEvent,,IssuesEvent",
+				"GHA2DB_EXCLUDE_EVENT_TYPES": "WatchEvent,GollumEvent",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"EventTypes": map[string]bool{
+						"PushEvent":        true,
+						"PullRequestEvent": true,
+						"IssuesEvent":      true,
+					},
+					"ExcludeEventTypes": map[string]bool{
+						"WatchEvent":  true,
+						"GollumEvent": true,
+					},
+				},
+			),
+		},
+		{
+			"Setting match repo IDs mode",
+			map[string]string{"GHA2DB_MATCH_REPO_IDS": "1"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"MatchRepoIDs": true},
+			),
+		},
+		{
+			"Setting parallel projects sync",
+			map[string]string{
+				"GHA2DB_SYNC_PROJECTS": "3",
+				"GHA2DB_SYNC_BUDGET":   "12",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"SyncProjectsN": 3,
+					"SyncBudget":    12,
+				},
+			),
+		},
+		{
+			"Setting sync locks",
+			map[string]string{
+				"GHA2DB_LOCK_FILE": "/var/run/devstats.lock",
+				"GHA2DB_PG_LOCK":   "1",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"LockFile": "/var/run/devstats.lock",
+					"PgLock":   true,
+				},
+			),
+		},
+		{
+			"Setting sync runs",
+			map[string]string{
+				"GHA2DB_SKIP_SYNC_RUNS": "1",
+				"GHA2DB_MAX_SYNC_AGE":   "90m",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"SkipSyncRuns": true,
+					"MaxSyncAge":   90 * time.Minute,
+				},
+			),
+		},
+		{
+			"Setting Prometheus exporter",
+			map[string]string{
+				"GHA2DB_EXPORTER_ADDR": "127.0.0.1:9000",
+				"GHA2DB_EXPORTER_PATH": "/prom",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"ExporterAddr": "127.0.0.1:9000",
+					"ExporterPath": "/prom",
+				},
+			),
+		},
+		{
+			"Setting daemon mode",
+			map[string]string{
+				"GHA2DB_SYNC_STEPS":  "gha2db, metrics,,",
+				"GHA2DB_SYNC_DAILY":  "1",
+				"GHA2DB_DAEMON_YAML": "jobs.yaml",
+				"GHA2DB_DAEMON_ADDR": ":1999",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"SyncOnlySteps": map[string]bool{"gha2db": true, "metrics": true},
+					"SyncDaily":     true,
+					"DaemonYaml":    "jobs.yaml",
+					"DaemonAddr":    ":1999",
+				},
+			),
+		},
+		{
+			"Setting sync plan mode",
+			map[string]string{"GHA2DB_SYNC_PLAN": "1"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"SyncPlan": true},
+			),
+		},
+		{
+			"Setting skip watermarks",
+			map[string]string{"GHA2DB_SKIP_WATERMARKS": "1"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"SkipWatermarks": true},
+			),
+		},
+		{
+			"Setting series store",
+			map[string]string{"GHA2DB_SERIES_STORE": "custom"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"SeriesStore": "custom"},
+			),
+		},
+		{
+			"Setting Prometheus export",
+			map[string]string{
+				"GHA2DB_PROM_EXPORT_URL":    "http://localhost:9201/write",
+				"GHA2DB_PROM_EXPORT_FORMAT": "openmetrics",
+			},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{
+					"PromExportURL":    "http://localhost:9201/write",
+					"PromExportFormat": "openmetrics",
+				},
+			),
+		},
+		{
+			"Setting Prometheus export max age",
+			map[string]string{"GHA2DB_PROM_EXPORT_MAX_AGE": "2h"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"PromExportMaxAge": 2 * time.Hour},
+			),
+		},
+		{
+			"Disabling Prometheus export max age",
+			map[string]string{"GHA2DB_PROM_EXPORT_MAX_AGE": "0"},
+			dynamicSetFields(
+				t,
+				copyContext(&defaultContext),
+				map[string]interface{}{"PromExportMaxAge": time.Duration(0)},
+			),
+		},
 	}
 
 	// Context Init() is verbose when called with CtxDebug
@@ -1060,6 +1434,12 @@ func TestInit(t *testing.T) {
 		testlib.MakeComparableMap(&test.expectedContext.ProjectsOverride)
 		testlib.MakeComparableMap(&gotContext.ExcludeRepos)
 		testlib.MakeComparableMap(&test.expectedContext.ExcludeRepos)
+		testlib.MakeComparableMap(&gotContext.EventTypes)
+		testlib.MakeComparableMap(&test.expectedContext.EventTypes)
+		testlib.MakeComparableMap(&gotContext.ExcludeEventTypes)
+		testlib.MakeComparableMap(&test.expectedContext.ExcludeEventTypes)
+		testlib.MakeComparableMap(&gotContext.SyncOnlySteps)
+		testlib.MakeComparableMap(&test.expectedContext.SyncOnlySteps)
 
 		// Check if we got expected context
 		got := fmt.Sprintf("%+v", gotContext)
@@ -0,0 +1,24 @@
+#!/bin/bash
+if [ -z "$ONLY" ]
+then
+  host=`hostname`
+  if [ $host = "cncftest.io" ]
+  then
+    all=`cat ./devel/all_test_dbs.txt`
+  else
+    all=`cat ./devel/all_prod_dbs.txt`
+  fi
+else
+  all=$ONLY
+fi
+for proj in $all
+do
+  exists=`sudo -u postgres psql "$proj" -tAc "select to_regclass('gha_ingest_hours') is not null"`
+  if [ "$exists" = "t" ]
+  then
+    sudo -u postgres psql "$proj" < ./util_sql/ingest_hours_attempts.sql || exit 1
+  else
+    sudo -u postgres psql "$proj" < ./util_sql/ingest_hours_table.sql || exit 1
+  fi
+done
+echo 'OK'
@@ -0,0 +1,18 @@
+#!/bin/bash
+if [ -z "$ONLY" ]
+then
+  host=`hostname`
+  if [ $host = "cncftest.io" ]
+  then
+    all=`cat ./devel/all_test_dbs.txt`
+  else
+    all=`cat ./devel/all_prod_dbs.txt`
+  fi
+else
+  all=$ONLY
+fi
+for proj in $all
+do
+  sudo -u postgres psql "$proj" < ./util_sql/metric_watermarks_table.sql || exit 1
+done
+echo 'OK'
@@ -0,0 +1,3 @@
+#!/bin/bash
+sudo -u postgres psql devstats < ./util_sql/devstats_sync_runs_table.sql || exit 1
+echo 'OK'
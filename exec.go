@@ -2,6 +2,7 @@ package devstats
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -44,7 +45,15 @@ func ExecCommand(ctx *Ctx, cmdAndArgs []string, env map[string]string) (string,
 		}
 		Printf("%s\n", strings.Join(args, " "))
 	}
-	cmd := exec.Command(command, arguments...)
+	// Kill command if it is still running after deadline (if set)
+	var cmd *exec.Cmd
+	if ctx.ExecDeadline.IsZero() {
+		cmd = exec.Command(command, arguments...)
+	} else {
+		cctx, cancel := context.WithDeadline(context.Background(), ctx.ExecDeadline)
+		defer cancel()
+		cmd = exec.CommandContext(cctx, command, arguments...)
+	}
 
 	// Environment setup (if any)
 	if len(env) > 0 {
@@ -124,6 +133,9 @@ func ExecCommand(ctx *Ctx, cmdAndArgs []string, env map[string]string) (string,
 	}
 	// Wait for command to finish
 	err := cmd.Wait()
+	if err != nil && !ctx.ExecDeadline.IsZero() && time.Now().After(ctx.ExecDeadline) {
+		err = fmt.Errorf("%s: deadline %v exceeded: %v", command, ctx.ExecDeadline, err)
+	}
 
 	// If error - then output STDOUT, STDERR and error info
 	if err != nil {
@@ -2,8 +2,11 @@ package devstats
 
 import (
 	"fmt"
+	"path"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -32,6 +35,9 @@ type Project struct {
 	JoinDate         *time.Time        `yaml:"join_date"`
 	FilesSkipPattern string            `yaml:"files_skip_pattern"`
 	Env              map[string]string `yaml:"env"`
+	Priority         int               `yaml:"priority"`
+	CPUs             int               `yaml:"cpus"`
+	Timezone         string            `yaml:"timezone"`
 }
 
 // AnyArray - holds array of interface{} - just a shortcut
@@ -84,6 +90,7 @@ type Payload struct {
 	Commits      *[]Commit    `json:"commits"`
 	Pages        *[]Page      `json:"pages"`
 	PullRequest  *PullRequest `json:"pull_request"`
+	Review       *Review      `json:"review"`
 }
 
 // PayloadOld - GHA Payload structure (from before 2015)
@@ -316,6 +323,18 @@ type Comment struct {
 	Line                *int      `json:"line"`
 }
 
+// Review - GHA PR Review structure (from PullRequestReviewEvent)
+// State is one of: approved, changes_requested, commented, dismissed
+type Review struct {
+	ID                int        `json:"id"`
+	User              Actor      `json:"user"`
+	Body              *string    `json:"body"`
+	CommitID          *string    `json:"commit_id"`
+	SubmittedAt       *time.Time `json:"submitted_at"`
+	State             string     `json:"state"`
+	AuthorAssociation *string    `json:"author_association"`
+}
+
 // Commit - GHA Commit structure
 type Commit struct {
 	SHA      string `json:"sha"`
@@ -381,15 +400,108 @@ func MakeOldRepoName(repo *ForkeeOld) string {
 	return fmt.Sprintf("%s/%s", *repo.Organization, repo.Name)
 }
 
+// EventTypeHit - are we interested in this event type?
+// Event type must be in ctx.EventTypes (if it is not empty) and cannot be in ctx.ExcludeEventTypes
+func EventTypeHit(ctx *Ctx, eventType string) bool {
+	if ctx.ExcludeEventTypes[eventType] {
+		return false
+	}
+	if len(ctx.EventTypes) > 0 && !ctx.EventTypes[eventType] {
+		return false
+	}
+	return true
+}
+
+// repoRegexps - compiled repository regexp patterns cache
+var repoRegexps sync.Map
+
+// IsRepoPattern - is a given repo/org specification a pattern (regexp or glob) instead of a name
+// "regexp:expr" is a regular expression, anything containing "*", "?" or "[" is a glob
+func IsRepoPattern(spec string) bool {
+	return strings.HasPrefix(spec, RepoRegexpPrefix) || strings.ContainsAny(spec, "*?[")
+}
+
+// RepoPatternMatch - does repository full name match a given pattern
+// Regexp patterns are matched against full name "org/repo" (use ^...$ to match the whole name)
+// Glob patterns use path.Match syntax ("*" doesn't match "/"), pattern containing "/" is matched against
+// full name, pattern without "/" is matched against org name (or against name for pre-2015 names without org)
+func RepoPatternMatch(pattern, fullName string) bool {
+	if strings.HasPrefix(pattern, RepoRegexpPrefix) {
+		re, ok := repoRegexps.Load(pattern)
+		if !ok {
+			compiled, err := regexp.Compile(pattern[len(RepoRegexpPrefix):])
+			FatalOnError(err)
+			re, _ = repoRegexps.LoadOrStore(pattern, compiled)
+		}
+		return re.(*regexp.Regexp).MatchString(fullName)
+	}
+	name := fullName
+	if !strings.Contains(pattern, "/") {
+		name = strings.Split(fullName, "/")[0]
+	}
+	match, err := path.Match(pattern, name)
+	FatalOnError(err)
+	return match
+}
+
+// RepoExcluded - is given repo excluded by GHA2DB_EXCLUDE_REPOS or by "!" items in org list
+func RepoExcluded(ctx *Ctx, fullName string, forg map[string]struct{}) bool {
+	// If given repo full name is in the exclude list, it is excluded
+	_, ok := ctx.ExcludeRepos[fullName]
+	if ok {
+		return true
+	}
+	// Check exclude patterns
+	for exclude := range ctx.ExcludeRepos {
+		if IsRepoPattern(exclude) && RepoPatternMatch(exclude, fullName) {
+			return true
+		}
+	}
+	// Check exclusions given in org list
+	for spec := range forg {
+		if strings.HasPrefix(spec, "!") {
+			exclude := spec[1:]
+			if exclude == fullName || (IsRepoPattern(exclude) && RepoPatternMatch(exclude, fullName)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // RepoHit - are we interested in this org/repo ?
+// forg can also contain regexp and glob patterns (see IsRepoPattern) and exclusions: "!org/repo" or "!pattern"
+// ctx.ExcludeRepos can contain full repo names and patterns
 func RepoHit(ctx *Ctx, fullName string, forg, frepo map[string]struct{}) bool {
 	// Return false if no repo name
 	if fullName == "" {
 		return false
 	}
-	// If given repo full name is in the exclude list, signal no hit
-	_, ok := ctx.ExcludeRepos[fullName]
-	if ok {
+	// Check GHA2DB_EXCLUDE_REPOS and exclusions given in org list
+	if RepoExcluded(ctx, fullName, forg) {
+		return false
+	}
+	// Check include patterns given in org list
+	nOrgs, nPatterns := 0, 0
+	patternHit := false
+	for spec := range forg {
+		if strings.HasPrefix(spec, "!") {
+			continue
+		}
+		if IsRepoPattern(spec) {
+			nPatterns++
+			if RepoPatternMatch(spec, fullName) {
+				patternHit = true
+			}
+			continue
+		}
+		nOrgs++
+	}
+	if patternHit {
+		return true
+	}
+	// Org list only contains patterns (and none matched)
+	if nOrgs == 0 && nPatterns > 0 {
 		return false
 	}
 	exact := ctx.Exact
@@ -401,7 +513,7 @@ func RepoHit(ctx *Ctx, fullName string, forg, frepo map[string]struct{}) bool {
 		org, repo = res[0], res[1]
 	}
 	// Now check for full name hit in org (one can provide full repo name org/repo)
-	_, ok = forg[fullName]
+	_, ok := forg[fullName]
 	// If we hit then we can have two cases
 	// We hit a full name with "/" - this is a direct hit, return true
 	// We hit old repo name format but special flag GHA2DB_EXACT is used
@@ -410,7 +522,7 @@ func RepoHit(ctx *Ctx, fullName string, forg, frepo map[string]struct{}) bool {
 		return ok
 	}
 	// Now if org list given and different org, return false
-	if len(forg) > 0 {
+	if nOrgs > 0 {
 		if _, ok := forg[org]; !ok {
 			return false
 		}
@@ -283,6 +283,86 @@ func TestRepoHit(t *testing.T) {
 			excludes: map[string]bool{"abc/def": true},
 			hit:      true,
 		},
+		{
+			fullName: "kubernetes-sigs/cluster-api-provider-aws",
+			forg:     map[string]struct{}{"kubernetes-sigs/*-provider-*": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes-sigs/kubebuilder",
+			forg:     map[string]struct{}{"kubernetes-sigs/*-provider-*": {}},
+			frepo:    map[string]struct{}{},
+		},
+		{
+			fullName: "kubernetes/kubernetes",
+			forg:     map[string]struct{}{"kubernetes-sigs/*-provider-*": {}, "kubernetes": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes-incubator/kube-aws",
+			forg:     map[string]struct{}{"kubernetes-*": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes/kubernetes",
+			forg:     map[string]struct{}{"kubernetes-*": {}},
+			frepo:    map[string]struct{}{},
+		},
+		{
+			fullName: "kubernetes-sigs/cluster-api-provider-gcp",
+			forg:     map[string]struct{}{"regexp:^kubernetes-sigs/.*-provider-.*$": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes-sigs/provider-gcp",
+			forg:     map[string]struct{}{"regexp:^kubernetes-sigs/.*-provider-.*$": {}},
+			frepo:    map[string]struct{}{},
+		},
+		{
+			fullName: "kubernetes/api",
+			forg:     map[string]struct{}{"kubernetes": {}, "!kubernetes/api": {}},
+			frepo:    map[string]struct{}{},
+		},
+		{
+			fullName: "kubernetes/kubernetes",
+			forg:     map[string]struct{}{"kubernetes": {}, "!kubernetes/api": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes-sigs/cluster-api-provider-aws",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}, "!kubernetes-sigs/*-aws": {}},
+			frepo:    map[string]struct{}{},
+		},
+		{
+			fullName: "abc/def",
+			forg:     map[string]struct{}{"!abc/ghi": {}},
+			frepo:    map[string]struct{}{},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes/client-go",
+			forg:     map[string]struct{}{"kubernetes": {}},
+			frepo:    map[string]struct{}{},
+			excludes: map[string]bool{"kubernetes/client-*": true},
+		},
+		{
+			fullName: "kubernetes/kubectl",
+			forg:     map[string]struct{}{"kubernetes": {}},
+			frepo:    map[string]struct{}{},
+			excludes: map[string]bool{"regexp:^kubernetes/(api|client-go)$": true},
+			hit:      true,
+		},
+		{
+			fullName: "kubernetes/api",
+			forg:     map[string]struct{}{"kubernetes": {}},
+			frepo:    map[string]struct{}{},
+			excludes: map[string]bool{"regexp:^kubernetes/(api|client-go)$": true},
+		},
 	}
 	// Execute test cases
 	for index, test := range testCases {
@@ -299,6 +379,94 @@ func TestRepoHit(t *testing.T) {
 	}
 }
 
+func TestRepoPatternMatch(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		pattern   string
+		fullName  string
+		isPattern bool
+		match     bool
+	}{
+		{pattern: "kubernetes", fullName: "kubernetes/kubernetes", isPattern: false, match: false},
+		{pattern: "kubernetes*", fullName: "kubernetes/kubernetes", isPattern: true, match: true},
+		{pattern: "kubernetes*", fullName: "kubernetes-sigs/kind", isPattern: true, match: true},
+		{pattern: "kube*", fullName: "kubernetes", isPattern: true, match: true},
+		{pattern: "kubernetes/*", fullName: "kubernetes/kubernetes", isPattern: true, match: true},
+		{pattern: "*", fullName: "kubernetes/kubernetes", isPattern: true, match: true},
+		{pattern: "*/kubernetes", fullName: "kubernetes/kubernetes", isPattern: true, match: true},
+		{pattern: "*/kubernetes", fullName: "kubernetes/kubectl", isPattern: true, match: false},
+		{pattern: "kubernetes-sigs/*-provider-?cp", fullName: "kubernetes-sigs/cluster-api-provider-gcp", isPattern: true, match: true},
+		{pattern: "kubernetes-sigs/*-provider-[ag]*", fullName: "kubernetes-sigs/cluster-api-provider-aws", isPattern: true, match: true},
+		{pattern: "kubernetes-sigs/*-provider-[ag]*", fullName: "kubernetes-sigs/cluster-api-provider-vsphere", isPattern: true, match: false},
+		{pattern: "regexp:provider", fullName: "kubernetes-sigs/cluster-api-provider-vsphere", isPattern: true, match: true},
+		{pattern: "regexp:^provider", fullName: "kubernetes-sigs/cluster-api-provider-vsphere", isPattern: true, match: false},
+		{pattern: "regexp:(?i)^KUBERNETES/", fullName: "kubernetes/kubernetes", isPattern: true, match: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		isPattern := lib.IsRepoPattern(test.pattern)
+		if isPattern != test.isPattern {
+			t.Errorf("test number %d, expected pattern %v, got %v", index+1, test.isPattern, isPattern)
+		}
+		if !isPattern {
+			continue
+		}
+		match := lib.RepoPatternMatch(test.pattern, test.fullName)
+		if match != test.match {
+			t.Errorf("test number %d, expected %v, got %v, test case: %+v", index+1, test.match, match, test)
+		}
+	}
+}
+
+func TestEventTypeHit(t *testing.T) {
+	// Test cases
+	var ctx lib.Ctx
+	var testCases = []struct {
+		types     map[string]bool
+		excludes  map[string]bool
+		eventType string
+		hit       bool
+	}{
+		{eventType: "WatchEvent", hit: true},
+		{
+			types:     map[string]bool{"PushEvent": true, "PullRequestEvent": true},
+			eventType: "PushEvent",
+			hit:       true,
+		},
+		{
+			types:     map[string]bool{"PushEvent": true, "PullRequestEvent": true},
+			eventType: "WatchEvent",
+		},
+		{
+			excludes:  map[string]bool{"WatchEvent": true, "GollumEvent": true},
+			eventType: "GollumEvent",
+		},
+		{
+			excludes:  map[string]bool{"WatchEvent": true, "GollumEvent": true},
+			eventType: "IssuesEvent",
+			hit:       true,
+		},
+		{
+			types:     map[string]bool{"PushEvent": true, "WatchEvent": true},
+			excludes:  map[string]bool{"WatchEvent": true},
+			eventType: "WatchEvent",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		expected := test.hit
+		ctx.EventTypes = test.types
+		ctx.ExcludeEventTypes = test.excludes
+		got := lib.EventTypeHit(&ctx, test.eventType)
+		if got != expected {
+			t.Errorf(
+				"test number %d, expected '%v', got '%v', test case: %+v",
+				index+1, expected, got, test,
+			)
+		}
+	}
+}
+
 func TestOrgIDOrNil(t *testing.T) {
 	result := lib.OrgIDOrNil(nil)
 	if result != nil {
@@ -12,6 +12,12 @@ type IDBBatchPointsN struct {
 	Points      *client.BatchPoints
 	fullBatches []*client.BatchPoints
 	NPoints     int
+	total       int
+}
+
+// Total - number of points added to the batch (including already cached full batches)
+func (points *IDBBatchPointsN) Total() int {
+	return points.total
 }
 
 // IDBAddPointNWithDB - adds point to the batch, eventually auto flushing
@@ -19,6 +25,7 @@ func IDBAddPointNWithDB(ctx *Ctx, con *client.Client, points *IDBBatchPointsN, p
 	bp := *(points.Points)
 	bp.AddPoint(pt)
 	points.NPoints++
+	points.total++
 	if points.NPoints >= ctx.IDBMaxBatchPoints {
 		if ctx.Debug > 0 {
 			Printf("Caching %d points (maximum batch size reached)\n", points.NPoints)
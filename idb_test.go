@@ -110,3 +110,57 @@ func TestInfluxDB(t *testing.T) {
 		t.Errorf("expected first series value %v, got %v", expected, value)
 	}
 }
+
+func TestInfluxStoreSeriesFields(t *testing.T) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Do not allow to run tests in "gha" database
+	if ctx.IDBDB != "dbtest" {
+		t.Errorf("tests can only be run on \"dbtest\" database")
+		return
+	}
+
+	// Connect to InfluxDB
+	con := lib.IDBConn(&ctx)
+	lib.QueryIDB(con, &ctx, "drop database "+ctx.IDBDB)
+	lib.QueryIDB(con, &ctx, "create database "+ctx.IDBDB)
+	store := lib.NewInfluxStore(&ctx)
+
+	// Drop database and close connections at the end
+	defer func() {
+		lib.QueryIDB(con, &ctx, "drop database "+ctx.IDBDB)
+		lib.FatalOnError(store.Close())
+		lib.FatalOnError(con.Close())
+	}()
+
+	// Each point has only one of the series fields
+	dt := lib.HourStart(time.Now().Add(-time.Hour))
+	err := store.WritePoints(
+		[]lib.SeriesPoint{
+			{Name: "test", Fields: map[string]interface{}{"a": 1.0}, Time: dt},
+			{Name: "test", Fields: map[string]interface{}{"b": 2.0}, Time: dt.Add(time.Hour)},
+		},
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// Point has no value for "b", but series has both fields
+	point, err := store.PointAt("test", dt)
+	if err != nil || point == nil {
+		t.Fatalf("expected point at %v, got %v, error %v", dt, point, err)
+	}
+	if len(point.Fields) != 1 || point.Fields["a"] == nil {
+		t.Errorf("expected only 'a' field, got %v", point.Fields)
+	}
+	fields, err := store.SeriesFields("test")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	expected := fmt.Sprintf("%v", []string{"a", "b"})
+	if fmt.Sprintf("%v", fields) != expected {
+		t.Errorf("expected series fields %v, got %v", expected, fields)
+	}
+}
@@ -0,0 +1,269 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Ingestion ledger statuses (gha_ingest_hours.status)
+const (
+	LedgerRunning = "running"
+	LedgerOK      = "ok"
+	LedgerNoData  = "no_data"
+	LedgerFailed  = "failed"
+	LedgerMissing = "missing" // Hour that has no ledger entry or was marked by the gap audit
+)
+
+// Hours that GH Archive never published stay "no_data" forever, they're only retried
+// until LedgerNoDataAttempts attempts were made or until they're older than LedgerNoDataMaxAge
+const (
+	LedgerNoDataAttempts = 24
+	LedgerNoDataMaxAge   = 7 * 24 * time.Hour
+)
+
+// LedgerEntry - single GHA hour ingestion status
+type LedgerEntry struct {
+	Hour     time.Time
+	Status   string
+	JSONs    int
+	Found    int
+	Events   int
+	Checksum string
+	Duration float64
+	Error    string
+	Attempts int
+}
+
+// LedgerAvailable - check if ingestion ledger table (with attempts column) exists
+// Databases created before the ledger was introduced need `./devel/create_ingest_hours_tables.sh`
+func LedgerAvailable(con *sql.DB, ctx *Ctx) bool {
+	n := 0
+	FatalOnError(
+		QueryRowSQL(
+			con,
+			ctx,
+			"select count(*) from information_schema.columns "+
+				"where table_schema = current_schema() and table_name = 'gha_ingest_hours' and column_name = 'attempts'",
+		).Scan(&n),
+	)
+	return n > 0
+}
+
+// LedgerUnavailableMessage - explains how to enable ingestion ledger when LedgerAvailable is false
+const LedgerUnavailableMessage = "gha_ingest_hours table (or its attempts column) not found, " +
+	"ingestion ledger is disabled, use ./devel/create_ingest_hours_tables.sh to create it"
+
+// LedgerStart - mark given hour as being processed, this counts as a next attempt
+// If process crashes, hour stays in "running" state and is treated as failed
+func LedgerStart(con *sql.DB, ctx *Ctx, dt time.Time) {
+	LedgerFinish(con, ctx, &LedgerEntry{Hour: dt, Status: LedgerRunning})
+}
+
+// LedgerFinish - save final status of a given hour
+func LedgerFinish(con *sql.DB, ctx *Ctx, entry *LedgerEntry) {
+	ExecSQLWithErr(
+		con,
+		ctx,
+		"insert into gha_ingest_hours("+
+			"hour, status, jsons, found, events, checksum, duration, error, updated_at, attempts"+
+			") "+NValues(10)+" on conflict(hour) do update set "+
+			"status = excluded.status, jsons = excluded.jsons, found = excluded.found, "+
+			"events = excluded.events, checksum = excluded.checksum, duration = excluded.duration, "+
+			"error = excluded.error, updated_at = excluded.updated_at, attempts = gha_ingest_hours.attempts + "+
+			"case excluded.status when '"+LedgerRunning+"' then 1 else 0 end",
+		AnyArray{
+			HourStart(entry.Hour),
+			entry.Status,
+			entry.JSONs,
+			entry.Found,
+			entry.Events,
+			entry.Checksum,
+			entry.Duration,
+			entry.Error,
+			time.Now(),
+			1,
+		}...,
+	)
+}
+
+// ledgerEntries - return all ledger entries from [from, to] range
+func ledgerEntries(con *sql.DB, ctx *Ctx, from, to time.Time) map[time.Time]LedgerEntry {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select hour, status, jsons, found, events, checksum, duration, error, attempts "+
+			"from gha_ingest_hours where hour >= $1 and hour <= $2 order by hour asc",
+		from,
+		to,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	known := make(map[time.Time]LedgerEntry)
+	for rows.Next() {
+		var entry LedgerEntry
+		FatalOnError(
+			rows.Scan(
+				&entry.Hour,
+				&entry.Status,
+				&entry.JSONs,
+				&entry.Found,
+				&entry.Events,
+				&entry.Checksum,
+				&entry.Duration,
+				&entry.Error,
+				&entry.Attempts,
+			),
+		)
+		entry.Hour = entry.Hour.UTC()
+		known[entry.Hour] = entry
+	}
+	FatalOnError(rows.Err())
+	return known
+}
+
+// LedgerEventsSince - return number of events written by gha2db runs that finished processing their hours since a given date
+func LedgerEventsSince(con *sql.DB, ctx *Ctx, dt time.Time) (n int64, err error) {
+	err = QueryRowSQL(
+		con,
+		ctx,
+		"select coalesce(sum(events), 0) from gha_ingest_hours where updated_at >= $1 and status <> $2",
+		dt,
+		LedgerRunning,
+	).Scan(&n)
+	return
+}
+
+// LedgerRetryable - should a given ledger entry be retried at a given date
+// All not imported hours are retried, except "no_data" hours that were already tried
+// LedgerNoDataAttempts times or that are older than LedgerNoDataMaxAge (GH Archive will never publish them)
+func LedgerRetryable(entry *LedgerEntry, now time.Time) bool {
+	switch entry.Status {
+	case LedgerOK:
+		return false
+	case LedgerNoData:
+		return entry.Attempts < LedgerNoDataAttempts && !entry.Hour.Before(now.Add(-LedgerNoDataMaxAge))
+	}
+	return true
+}
+
+// LedgerPending - return hours from [from, to] range that were not successfully imported and should be retried (see LedgerRetryable)
+// Hours that have no ledger entry are only returned when missing is set
+func LedgerPending(con *sql.DB, ctx *Ctx, from, to time.Time, missing bool) []LedgerEntry {
+	from = HourStart(from)
+	to = HourStart(to)
+	return LedgerPendingEntries(from, to, ledgerEntries(con, ctx, from, to), time.Now(), missing)
+}
+
+// LedgerPendingEntries - return hours from [from, to] range that should be retried at now, given ledger entries
+func LedgerPendingEntries(from, to time.Time, known map[time.Time]LedgerEntry, now time.Time, missing bool) (entries []LedgerEntry) {
+	for dt := from; !dt.After(to); dt = dt.Add(time.Hour) {
+		entry, ok := known[dt]
+		if !ok {
+			if missing {
+				entries = append(entries, LedgerEntry{Hour: dt, Status: LedgerMissing})
+			}
+			continue
+		}
+		if LedgerRetryable(&entry, now) {
+			entries = append(entries, entry)
+		}
+	}
+	return
+}
+
+// LedgerGaps - return hours from [from, to] range that are not imported
+// events is the number of GHA events imported for each hour, known are ledger entries
+// Hour is a gap when its ledger status is not "ok" or when it has no ledger entry and no imported events
+func LedgerGaps(from, to time.Time, events map[time.Time]int, known map[time.Time]LedgerEntry) (gaps []LedgerEntry) {
+	for dt := HourStart(from); !dt.After(to); dt = dt.Add(time.Hour) {
+		entry, ok := known[dt]
+		if ok {
+			if entry.Status != LedgerOK {
+				gaps = append(gaps, entry)
+			}
+			continue
+		}
+		if events[dt] == 0 {
+			gaps = append(gaps, LedgerEntry{Hour: dt, Status: LedgerMissing})
+		}
+	}
+	return
+}
+
+// LedgerAudit - compare each hour from [from, to] range with imported GHA events and ingestion ledger
+// Returns hours that are missing (see LedgerGaps), artificial events (created by ghapi2db) are not counted
+func LedgerAudit(con *sql.DB, ctx *Ctx, from, to time.Time) []LedgerEntry {
+	from = HourStart(from)
+	to = HourStart(to)
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select date_trunc('hour', created_at), count(*) from gha_events "+
+			"where created_at >= $1 and created_at < $2 and id < 281474976710656 "+
+			"group by date_trunc('hour', created_at)",
+		from,
+		to.Add(time.Hour),
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	events := make(map[time.Time]int)
+	for rows.Next() {
+		var (
+			dt time.Time
+			n  int
+		)
+		FatalOnError(rows.Scan(&dt, &n))
+		events[dt.UTC()] = n
+	}
+	FatalOnError(rows.Err())
+	return LedgerGaps(from, to, events, ledgerEntries(con, ctx, from, to))
+}
+
+// LedgerMarkMissing - record gap hours that have no ledger entry as "missing"
+// They are then retried by the next gha2db_sync run (like failed hours)
+func LedgerMarkMissing(con *sql.DB, ctx *Ctx, gaps []LedgerEntry) (n int) {
+	for _, entry := range gaps {
+		if entry.Status != LedgerMissing {
+			continue
+		}
+		ExecSQLWithErr(
+			con,
+			ctx,
+			InsertIgnore("into gha_ingest_hours(hour, status, updated_at) "+NValues(3)),
+			AnyArray{entry.Hour, LedgerMissing, time.Now()}...,
+		)
+		n++
+	}
+	return
+}
+
+// HourRanges - group sorted hours into ranges of consecutive hours
+func HourRanges(hours []time.Time) (ranges [][2]time.Time) {
+	for _, dt := range hours {
+		n := len(ranges)
+		if n > 0 && ranges[n-1][1].Add(time.Hour).Equal(dt) {
+			ranges[n-1][1] = dt
+			continue
+		}
+		ranges = append(ranges, [2]time.Time{dt, dt})
+	}
+	return
+}
+
+// LedgerEntryString - return human readable ledger entry
+func LedgerEntryString(entry *LedgerEntry) string {
+	s := fmt.Sprintf("%s: %s", ToYMDHDate(entry.Hour), entry.Status)
+	if entry.Status == LedgerMissing {
+		return s
+	}
+	s += fmt.Sprintf(
+		", JSONs: %d, found: %d, events: %d, took: %.3fs",
+		entry.JSONs, entry.Found, entry.Events, entry.Duration,
+	)
+	if entry.Attempts > 1 {
+		s += fmt.Sprintf(", attempts: %d", entry.Attempts)
+	}
+	if entry.Error != "" {
+		s += ", error: " + entry.Error
+	}
+	return s
+}
@@ -0,0 +1,193 @@
+package devstats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestHourRanges(t *testing.T) {
+	ft := testlib.YMDHMS
+
+	// Test cases
+	var testCases = []struct {
+		hours    []time.Time
+		expected [][2]time.Time
+	}{
+		{
+			hours:    []time.Time{},
+			expected: [][2]time.Time{},
+		},
+		{
+			hours:    []time.Time{ft(2018, 1, 1, 5)},
+			expected: [][2]time.Time{{ft(2018, 1, 1, 5), ft(2018, 1, 1, 5)}},
+		},
+		{
+			hours:    []time.Time{ft(2018, 1, 1, 22), ft(2018, 1, 1, 23), ft(2018, 1, 2, 0)},
+			expected: [][2]time.Time{{ft(2018, 1, 1, 22), ft(2018, 1, 2, 0)}},
+		},
+		{
+			hours: []time.Time{ft(2018, 1, 1, 1), ft(2018, 1, 1, 2), ft(2018, 1, 1, 4), ft(2018, 2, 1), ft(2018, 2, 1, 1)},
+			expected: [][2]time.Time{
+				{ft(2018, 1, 1, 1), ft(2018, 1, 1, 2)},
+				{ft(2018, 1, 1, 4), ft(2018, 1, 1, 4)},
+				{ft(2018, 2, 1), ft(2018, 2, 1, 1)},
+			},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.HourRanges(test.hours)
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestLedgerEntryString(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		entry    lib.LedgerEntry
+		expected string
+	}{
+		{
+			entry:    lib.LedgerEntry{Hour: testlib.YMDHMS(2018, 3, 4, 5), Status: lib.LedgerMissing},
+			expected: "2018-03-04 5: missing",
+		},
+		{
+			entry:    lib.LedgerEntry{Hour: testlib.YMDHMS(2018, 3, 4, 15), Status: lib.LedgerRunning},
+			expected: "2018-03-04 15: running, JSONs: 0, found: 0, events: 0, took: 0.000s",
+		},
+		{
+			entry: lib.LedgerEntry{
+				Hour:     testlib.YMDHMS(2018, 3, 4),
+				Status:   lib.LedgerFailed,
+				JSONs:    30000,
+				Found:    20,
+				Events:   19,
+				Duration: 12.5,
+				Error:    "unexpected EOF",
+			},
+			expected: "2018-03-04 0: failed, JSONs: 30000, found: 20, events: 19, took: 12.500s, error: unexpected EOF",
+		},
+		{
+			entry:    lib.LedgerEntry{Hour: testlib.YMDHMS(2018, 3, 4, 1), Status: lib.LedgerNoData, Attempts: 3},
+			expected: "2018-03-04 1: no_data, JSONs: 0, found: 0, events: 0, took: 0.000s, attempts: 3",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.LedgerEntryString(&test.entry)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestLedgerGaps(t *testing.T) {
+	ft := testlib.YMDHMS
+
+	// Test cases
+	var testCases = []struct {
+		from     time.Time
+		to       time.Time
+		events   map[time.Time]int
+		known    map[time.Time]lib.LedgerEntry
+		expected []string
+	}{
+		{
+			from:     ft(2018, 1, 1, 0),
+			to:       ft(2018, 1, 1, 2),
+			events:   map[time.Time]int{ft(2018, 1, 1, 0): 10, ft(2018, 1, 1, 1): 3, ft(2018, 1, 1, 2): 1},
+			known:    map[time.Time]lib.LedgerEntry{},
+			expected: []string{},
+		},
+		{
+			from:     ft(2018, 1, 1, 0),
+			to:       ft(2018, 1, 1, 3),
+			events:   map[time.Time]int{ft(2018, 1, 1, 0): 10, ft(2018, 1, 1, 3): 1},
+			known:    map[time.Time]lib.LedgerEntry{},
+			expected: []string{"2018-01-01 1: missing", "2018-01-01 2: missing"},
+		},
+		{
+			from:   ft(2018, 1, 1, 0),
+			to:     ft(2018, 1, 1, 3),
+			events: map[time.Time]int{ft(2018, 1, 1, 1): 5},
+			known: map[time.Time]lib.LedgerEntry{
+				ft(2018, 1, 1, 0): {Hour: ft(2018, 1, 1, 0), Status: lib.LedgerOK},
+				ft(2018, 1, 1, 1): {Hour: ft(2018, 1, 1, 1), Status: lib.LedgerFailed},
+				ft(2018, 1, 1, 2): {Hour: ft(2018, 1, 1, 2), Status: lib.LedgerNoData},
+			},
+			expected: []string{
+				"2018-01-01 1: failed, JSONs: 0, found: 0, events: 0, took: 0.000s",
+				"2018-01-01 2: no_data, JSONs: 0, found: 0, events: 0, took: 0.000s",
+				"2018-01-01 3: missing",
+			},
+		},
+		{
+			from:   ft(2018, 1, 1, 0, 30),
+			to:     ft(2018, 1, 1, 1),
+			events: map[time.Time]int{},
+			known: map[time.Time]lib.LedgerEntry{
+				ft(2018, 1, 1, 0): {Hour: ft(2018, 1, 1, 0), Status: lib.LedgerMissing},
+			},
+			expected: []string{"2018-01-01 0: missing", "2018-01-01 1: missing"},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := []string{}
+		for _, entry := range lib.LedgerGaps(test.from, test.to, test.events, test.known) {
+			got = append(got, lib.LedgerEntryString(&entry))
+		}
+		if !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestLedgerPendingEntries(t *testing.T) {
+	ft := testlib.YMDHMS
+	now := ft(2018, 1, 10, 0)
+	known := map[time.Time]lib.LedgerEntry{
+		ft(2018, 1, 1, 0): {Hour: ft(2018, 1, 1, 0), Status: lib.LedgerNoData, Attempts: 1},
+		ft(2018, 1, 9, 0): {Hour: ft(2018, 1, 9, 0), Status: lib.LedgerOK, Attempts: 1},
+		ft(2018, 1, 9, 1): {Hour: ft(2018, 1, 9, 1), Status: lib.LedgerNoData, Attempts: 2},
+		ft(2018, 1, 9, 2): {Hour: ft(2018, 1, 9, 2), Status: lib.LedgerNoData, Attempts: lib.LedgerNoDataAttempts},
+		ft(2018, 1, 9, 3): {Hour: ft(2018, 1, 9, 3), Status: lib.LedgerFailed, Attempts: 100},
+		ft(2018, 1, 9, 4): {Hour: ft(2018, 1, 9, 4), Status: lib.LedgerMissing},
+	}
+
+	// Test cases
+	var testCases = []struct {
+		from     time.Time
+		to       time.Time
+		missing  bool
+		expected []time.Time
+	}{
+		{
+			from:     ft(2018, 1, 1, 0),
+			to:       ft(2018, 1, 9, 4),
+			expected: []time.Time{ft(2018, 1, 9, 1), ft(2018, 1, 9, 3), ft(2018, 1, 9, 4)},
+		},
+		{
+			from:     ft(2018, 1, 9, 2),
+			to:       ft(2018, 1, 9, 6),
+			missing:  true,
+			expected: []time.Time{ft(2018, 1, 9, 3), ft(2018, 1, 9, 4), ft(2018, 1, 9, 5), ft(2018, 1, 9, 6)},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := []time.Time{}
+		for _, entry := range lib.LedgerPendingEntries(test.from, test.to, known, now, test.missing) {
+			got = append(got, entry.Hour)
+		}
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package devstats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LockInfo - lock holder: PID, host name and time when the lock was acquired
+// Stale is set when lock file still contains holder data, but its holder no longer holds the lock (crashed)
+type LockInfo struct {
+	PID   int
+	Host  string
+	Since time.Time
+	Stale bool
+}
+
+// String - lock holder description
+func (li *LockInfo) String() string {
+	s := fmt.Sprintf("PID %d on %s, held since %s (%v)", li.PID, li.Host, ToYMDHMSDate(li.Since), time.Now().Sub(li.Since))
+	if li.Stale {
+		s += ", stale"
+	}
+	return s
+}
+
+// FileLock - exclusive flock(2) lock on a lock file, held until Release (or until the holder process exits)
+type FileLock struct {
+	Path string
+	Info LockInfo
+	file *os.File
+}
+
+// parseFileLock - parse lock file contents: PID host unix_timestamp
+func parseFileLock(path string, data []byte) (*LockInfo, error) {
+	var (
+		li  LockInfo
+		err error
+	)
+	ary := strings.Fields(string(data))
+	if len(ary) > 0 {
+		li.PID, err = strconv.Atoi(ary[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid lock file '%s': %v", path, err)
+		}
+	}
+	if len(ary) > 2 {
+		li.Host = ary[1]
+		ts, err := strconv.ParseInt(ary[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lock file '%s': %v", path, err)
+		}
+		li.Since = time.Unix(ts, 0)
+	} else {
+		// Old format (PID only), use file modification time
+		host, _ := os.Hostname()
+		li.Host = host
+		info, err := os.Stat(path)
+		if err == nil {
+			li.Since = info.ModTime()
+		}
+	}
+	return &li, nil
+}
+
+// ReadFileLock - read lock file, returns nil if the lock is not held (and lock file has no holder data)
+// Lock file contains: PID host unix_timestamp, it is only used for reporting, lock itself is flock(2) on that file
+func ReadFileLock(path string) (*LockInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	// If we can get a shared lock then nobody holds the exclusive lock
+	held := false
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		held = true
+	} else if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		if !held {
+			return nil, nil
+		}
+		// Holder is just writing its data
+		return &LockInfo{}, nil
+	}
+	li, err := parseFileLock(path, data)
+	if err != nil {
+		return nil, err
+	}
+	li.Stale = !held
+	return li, nil
+}
+
+// AcquireFileLock - take exclusive flock(2) lock on a lock file and write current PID, host name and time into it
+// When lock is held by another process it returns nil lock and the holder
+// Lock left by a crashed process is released by the kernel, so there is no need to remove stale lock files
+func AcquireFileLock(path string) (*FileLock, *LockInfo, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		_ = file.Close()
+		if err != syscall.EWOULDBLOCK {
+			return nil, nil, err
+		}
+		holder, err := ReadFileLock(path)
+		return nil, holder, err
+	}
+	host, _ := os.Hostname()
+	lock := &FileLock{Path: path, Info: LockInfo{PID: os.Getpid(), Host: host, Since: time.Now()}, file: file}
+	err = file.Truncate(0)
+	if err == nil {
+		_, err = file.WriteAt([]byte(fmt.Sprintf("%d %s %d", lock.Info.PID, lock.Info.Host, lock.Info.Since.Unix())), 0)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return lock, nil, nil
+}
+
+// Release - clear holder data and release the lock
+// Lock file is not removed: removing it would allow another process to lock a new file while the old one is still locked
+func (l *FileLock) Release() error {
+	err := l.file.Truncate(0)
+	if err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// PgLockKey - Postgres advisory lock key for a given lock name
+func PgLockKey(name string) int64 {
+	return int64(HashStrings([]string{"devstats lock", name}))
+}
+
+// PgLock - Postgres advisory lock, held by a dedicated DB connection (session level lock)
+type PgLock struct {
+	Name string
+	conn *sql.Conn
+}
+
+// AcquirePgLock - try to acquire Postgres advisory lock with a given name (without waiting)
+// Returns nil if lock is already held by another session
+// Connection's application_name is set to "devstats PID@host" so holder can be found in pg_stat_activity
+func AcquirePgLock(con *sql.DB, name string) (*PgLock, error) {
+	bg := context.Background()
+	conn, err := con.Conn(bg)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	_, err = conn.ExecContext(bg, fmt.Sprintf("set application_name = 'devstats %d@%s'", os.Getpid(), host))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	locked := false
+	err = conn.QueryRowContext(bg, "select pg_try_advisory_lock($1)", PgLockKey(name)).Scan(&locked)
+	if err != nil || !locked {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &PgLock{Name: name, conn: conn}, nil
+}
+
+// Release - release Postgres advisory lock and its connection
+func (pl *PgLock) Release() error {
+	bg := context.Background()
+	_, err := pl.conn.ExecContext(bg, "select pg_advisory_unlock($1)", PgLockKey(pl.Name))
+	cerr := pl.conn.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// PgLockHolder - return Postgres advisory lock holder: application name, client address and time when session started
+// Returns empty string if lock is not held
+func PgLockHolder(con *sql.DB, name string) (string, error) {
+	key := PgLockKey(name)
+	rows, err := con.Query(
+		"select coalesce(a.application_name, ''), coalesce(host(a.client_addr), 'local'), a.backend_start "+
+			"from pg_locks l, pg_stat_activity a where l.pid = a.pid and l.locktype = 'advisory' "+
+			"and l.granted and l.classid = $1 and l.objid = $2 and l.objsubid = 1",
+		uint32(uint64(key)>>32),
+		uint32(uint64(key)),
+	)
+	if err != nil {
+		return "", err
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	holder := ""
+	for rows.Next() {
+		var (
+			app    string
+			client string
+			start  time.Time
+		)
+		err = rows.Scan(&app, &client, &start)
+		if err != nil {
+			return "", err
+		}
+		holder = fmt.Sprintf("%s from %s, session started %s (%v)", app, client, ToYMDHMSDate(start), time.Now().Sub(start))
+	}
+	return holder, rows.Err()
+}
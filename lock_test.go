@@ -0,0 +1,122 @@
+package devstats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devstats_lock")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	host, _ := os.Hostname()
+	now := time.Now().Unix()
+
+	// Test cases: lock file contents left before acquiring the lock
+	var testCases = []struct {
+		create  bool
+		content string
+		stale   bool
+		holder  int
+	}{
+		{create: false},
+		{create: true, content: ""},
+		{create: true, content: fmt.Sprintf("%d %s %d", os.Getppid(), host, now), stale: true, holder: os.Getppid()},
+		{create: true, content: fmt.Sprintf("%d other.host %d", os.Getppid(), now), stale: true, holder: os.Getppid()},
+		{create: true, content: fmt.Sprintf("%d", os.Getppid()), stale: true, holder: os.Getppid()},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		path := fmt.Sprintf("%s/%d.pid", dir, index)
+		if test.create {
+			err = ioutil.WriteFile(path, []byte(test.content), 0600)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		before, err := lib.ReadFileLock(path)
+		if err != nil || (before != nil) != test.stale || (before != nil && (!before.Stale || before.PID != test.holder)) {
+			t.Errorf("test number %d, expected stale %v holder %d, got %+v, error %v", index+1, test.stale, test.holder, before, err)
+		}
+		lock, holder, err := lib.AcquireFileLock(path)
+		if err != nil || lock == nil || holder != nil {
+			t.Errorf("test number %d, expected to acquire lock, got %+v, %+v, error %v", index+1, lock, holder, err)
+			continue
+		}
+		if lock.Info.PID != os.Getpid() || lock.Info.Host != host {
+			t.Errorf("test number %d, expected to be the holder, got %+v", index+1, lock.Info)
+		}
+		// Second acquire must fail and report current process as the holder
+		again, holder, err := lib.AcquireFileLock(path)
+		if err != nil || again != nil || holder == nil || holder.PID != os.Getpid() || holder.Stale {
+			t.Errorf("test number %d, expected lock held by current process, got %+v, %+v, error %v", index+1, again, holder, err)
+		}
+		current, err := lib.ReadFileLock(path)
+		if err != nil || current == nil || current.PID != os.Getpid() || current.Stale {
+			t.Errorf("test number %d, expected current process as the holder, got %+v, error %v", index+1, current, err)
+		}
+		err = lock.Release()
+		if err != nil {
+			t.Errorf("test number %d, release error %v", index+1, err)
+		}
+		after, err := lib.ReadFileLock(path)
+		if err != nil || after != nil {
+			t.Errorf("test number %d, expected no lock after release, got %+v, error %v", index+1, after, err)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("test number %d, lock file should not be removed, error %v", index+1, err)
+		}
+	}
+}
+
+func TestFileLockConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devstats_lock")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := dir + "/devstats.pid"
+	err = ioutil.WriteFile(path, []byte("1 other.host 0"), 0600)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// All instances try to take over the stale lock at the same time, only one can hold it
+	n := 16
+	locks := make(chan *lib.FileLock, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, _, err := lib.AcquireFileLock(path)
+			if err != nil {
+				t.Errorf(err.Error())
+			}
+			if lock != nil {
+				locks <- lock
+			}
+		}()
+	}
+	wg.Wait()
+	close(locks)
+	got := 0
+	for lock := range locks {
+		got++
+		err = lock.Release()
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+	}
+	if got != 1 {
+		t.Errorf("expected exactly 1 lock holder, got %d", got)
+	}
+}
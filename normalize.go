@@ -0,0 +1,222 @@
+package devstats
+
+import (
+	"fmt"
+	"time"
+)
+
+// NormEvent - canonical GHA event
+// Both current (Event) and pre-2015 (EventOld) GHA formats are converted into it before storage
+// Pre-2015 events have no actor ID (it is 0) and their repository is also stored as a forkee (RepositoryOld)
+// Pre-2015 organization not found in DB has a hash of its login as ID (OrgHashID), see EventOrgID
+type NormEvent struct {
+	ID            string
+	Type          string
+	Public        bool
+	CreatedAt     time.Time
+	Actor         Actor
+	Repo          Repo
+	Org           *Org
+	OrgHashID     bool
+	RepositoryOld *ForkeeOld
+	Payload       *NormPayload
+}
+
+// NormPayload - canonical GHA event payload
+// IssueID and CommentID are set from Issue and Comment (if present) or from pre-2015 issue_id and comment_id
+// Pre-2015 pull request events have an artificial issue (with negative ID) created from the pull request
+// Such issue has ArtificialIssue set, its actors and milestone are stored with the pull request
+type NormPayload struct {
+	PushID          *int
+	Size            *int
+	Ref             *string
+	Head            *string
+	Before          *string
+	Action          *string
+	IssueID         *int
+	CommentID       *int
+	RefType         *string
+	MasterBranch    *string
+	Commit          *string
+	Description     *string
+	Number          *int
+	Forkee          *Forkee
+	Release         *Release
+	Member          *Actor
+	Issue           *Issue
+	ArtificialIssue bool
+	Comment         *Comment
+	Commits         []Commit
+	Pages           *[]Page
+	PullRequest     *PullRequest
+	Review          *Review
+	Team            *Team
+}
+
+// RepoFullName - return repository full name "org/repo"
+// Pre-2015 repository name is stored without org, see MakeOldRepoName
+func (ev *NormEvent) RepoFullName() string {
+	if ev.RepositoryOld != nil {
+		return MakeOldRepoName(ev.RepositoryOld)
+	}
+	return ev.Repo.Name
+}
+
+// EventOrgID - return event's organization ID (stored as gha_events.org_id) or nil
+// Organization ID that is only a hash of its login is used for gha_orgs and gha_repos, but event has no organization ID then
+func (ev *NormEvent) EventOrgID() interface{} {
+	if ev.Org == nil || ev.OrgHashID {
+		return nil
+	}
+	return ev.Org.ID
+}
+
+// NormalizeEvent - convert GHA event into canonical form
+func NormalizeEvent(ev *Event) *NormEvent {
+	pl := ev.Payload
+	nev := NormEvent{
+		ID:        ev.ID,
+		Type:      ev.Type,
+		Public:    ev.Public,
+		CreatedAt: ev.CreatedAt,
+		Actor:     ev.Actor,
+		Repo:      ev.Repo,
+		Org:       ev.Org,
+		Payload: &NormPayload{
+			PushID:       pl.PushID,
+			Size:         pl.Size,
+			Ref:          pl.Ref,
+			Head:         pl.Head,
+			Before:       pl.Before,
+			Action:       pl.Action,
+			RefType:      pl.RefType,
+			MasterBranch: pl.MasterBranch,
+			Description:  pl.Description,
+			Number:       pl.Number,
+			Forkee:       pl.Forkee,
+			Release:      pl.Release,
+			Member:       pl.Member,
+			Issue:        pl.Issue,
+			Comment:      pl.Comment,
+			Commits:      []Commit{},
+			Pages:        pl.Pages,
+			PullRequest:  pl.PullRequest,
+			Review:       pl.Review,
+		},
+	}
+	if pl.Issue != nil {
+		iid := pl.Issue.ID
+		nev.Payload.IssueID = &iid
+	}
+	if pl.Comment != nil {
+		cid := pl.Comment.ID
+		nev.Payload.CommentID = &cid
+	}
+	if pl.Commits != nil {
+		nev.Payload.Commits = *pl.Commits
+	}
+	return &nev
+}
+
+// NormalizeEventOld - convert pre-2015 GHA event with a given ID into canonical form
+// Actor ID is 0, organization ID is a hash of its login, they can be resolved later (for example using DB lookups)
+func NormalizeEventOld(eventID string, ev *EventOld) (*NormEvent, error) {
+	repository := ev.Repository
+	nev := NormEvent{
+		ID:            eventID,
+		Type:          ev.Type,
+		Public:        ev.Public,
+		CreatedAt:     ev.CreatedAt,
+		Actor:         Actor{Login: ev.Actor},
+		Repo:          Repo{ID: repository.ID, Name: repository.Name},
+		RepositoryOld: &repository,
+	}
+	if repository.Organization != nil {
+		nev.Org = &Org{ID: HashStrings([]string{*repository.Organization}), Login: *repository.Organization}
+		nev.OrgHashID = true
+	}
+	pl := ev.Payload
+	if pl == nil {
+		return &nev, nil
+	}
+	nev.Payload = &NormPayload{
+		Size:         pl.Size,
+		Ref:          pl.Ref,
+		Head:         pl.Head,
+		Action:       pl.Action,
+		IssueID:      pl.Issue,
+		CommentID:    pl.CommentID,
+		RefType:      pl.RefType,
+		MasterBranch: pl.MasterBranch,
+		Commit:       pl.Commit,
+		Description:  pl.Description,
+		Number:       pl.Number,
+		Forkee:       pl.Repository,
+		Release:      pl.Release,
+		Member:       pl.Member,
+		Comment:      pl.Comment,
+		Commits:      []Commit{},
+		Pages:        pl.Pages,
+		PullRequest:  pl.PullRequest,
+		Team:         pl.Team,
+	}
+	if nev.Payload.IssueID == nil {
+		nev.Payload.IssueID = pl.IssueID
+	}
+	if pl.Comment != nil {
+		cid := pl.Comment.ID
+		nev.Payload.CommentID = &cid
+	}
+
+	// SHAs - commits: [sha, author email, message, author name, distinct]
+	if pl.SHAs != nil {
+		for _, comm := range *pl.SHAs {
+			commit, ok := comm.([]interface{})
+			if !ok || len(commit) < 5 {
+				return nil, fmt.Errorf("%s: commit is not [sha, email, message, name, distinct]: %+v", eventID, comm)
+			}
+			sha, ok1 := commit[0].(string)
+			message, ok2 := commit[2].(string)
+			name, ok3 := commit[3].(string)
+			distinct, ok4 := commit[4].(bool)
+			if !ok1 || !ok2 || !ok3 || !ok4 {
+				return nil, fmt.Errorf("%s: unexpected commit data types: %+v", eventID, comm)
+			}
+			nev.Payload.Commits = append(
+				nev.Payload.Commits,
+				Commit{SHA: sha, Author: Author{Name: name}, Message: message, Distinct: distinct},
+			)
+		}
+	}
+
+	// Artificial issue from pull request
+	if pl.PullRequest != nil {
+		pr := pl.PullRequest
+		issue := Issue{
+			ID:          -pr.ID,
+			Number:      pr.Number,
+			Title:       pr.Title,
+			State:       pr.State,
+			Body:        pr.Body,
+			User:        pr.User,
+			Assignee:    pr.Assignee,
+			Milestone:   pr.Milestone,
+			CreatedAt:   pr.CreatedAt,
+			UpdatedAt:   pr.UpdatedAt,
+			ClosedAt:    pr.ClosedAt,
+			PullRequest: &Dummy{},
+		}
+		if pr.Comments != nil {
+			issue.Comments = *pr.Comments
+		}
+		if pr.Locked != nil {
+			issue.Locked = *pr.Locked
+		}
+		if pr.Assignees != nil {
+			issue.Assignees = *pr.Assignees
+		}
+		nev.Payload.Issue = &issue
+		nev.Payload.ArtificialIssue = true
+	}
+	return &nev, nil
+}
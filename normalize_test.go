@@ -0,0 +1,201 @@
+package devstats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	lib "devstats"
+)
+
+// loadAnalysisEvent - load GHA event sample from analysis/ directory
+// Samples are dumped by Ruby, so integers are stored as floats ("id": 123.0), they're converted back to integers
+func loadAnalysisEvent(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile("analysis/" + name + ".json")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return regexp.MustCompile(`(\d)\.0([,\s}\]])`).ReplaceAll(data, []byte("$1$2"))
+}
+
+func TestNormalizeEvent(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		file            string
+		old             bool
+		eventType       string
+		actor           string
+		repo            string
+		org             string
+		issueID         int
+		commentID       int
+		commits         int
+		forkee          bool
+		artificialIssue bool
+	}{
+		{file: "new_0", eventType: "PushEvent", actor: "jmarrec", repo: "jmarrec/OpenStudio", commits: 1},
+		{
+			file:      "new_payload_1",
+			eventType: "IssueCommentEvent",
+			actor:     "juniorbird",
+			repo:      "team-jwt/pleated-slacks",
+			org:       "team-jwt",
+			issueID:   158201659,
+			commentID: 223371748,
+		},
+		{file: "new_payload_7", eventType: "ForkEvent", actor: "stsievert", repo: "kivy/kivy-ios", org: "kivy", forkee: true},
+		{file: "new_payload_9", eventType: "CommitCommentEvent", actor: "nrel-bot-2", repo: "NREL/EnergyPlus", org: "NREL", commentID: 17718737},
+		{file: "old_0", old: true, eventType: "CommitCommentEvent", actor: "K-Be", repo: "EasyMapping", commentID: 6626710},
+		{
+			file:            "old_payload_2",
+			old:             true,
+			eventType:       "PullRequestEvent",
+			actor:           "lintianzhi",
+			repo:            "qiniu/developer.qiniu.com",
+			org:             "qiniu",
+			artificialIssue: true,
+		},
+		{file: "old_payload_3", old: true, eventType: "PushEvent", actor: "armon", repo: "hashicorp/consul", org: "hashicorp", commits: 2},
+		{
+			file:      "old_payload_7",
+			old:       true,
+			eventType: "IssueCommentEvent",
+			actor:     "sorah",
+			repo:      "aws/aws-sdk-core-ruby",
+			org:       "aws",
+			issueID:   35445651,
+			commentID: 45695799,
+		},
+		{file: "old_payload_11", old: true, eventType: "TeamAddEvent", actor: "mistengine", repo: "mistengine/test", org: "mistengine", forkee: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		data := loadAnalysisEvent(t, test.file)
+		var ev *lib.NormEvent
+		if test.old {
+			var h lib.EventOld
+			err := json.Unmarshal(data, &h)
+			if err != nil {
+				t.Fatalf("test number %d: %v", index+1, err)
+			}
+			ev, err = lib.NormalizeEventOld("1", &h)
+			if err != nil {
+				t.Fatalf("test number %d: %v", index+1, err)
+			}
+			if ev.Actor.ID != 0 || ev.RepositoryOld == nil {
+				t.Errorf("test number %d, pre 2015 event should have no actor ID and should have repository, got %+v", index+1, ev)
+			}
+		} else {
+			var h lib.Event
+			err := json.Unmarshal(data, &h)
+			if err != nil {
+				t.Fatalf("test number %d: %v", index+1, err)
+			}
+			ev = lib.NormalizeEvent(&h)
+			if ev.Actor.ID == 0 || ev.RepositoryOld != nil {
+				t.Errorf("test number %d, event should have actor ID and no pre 2015 repository, got %+v", index+1, ev)
+			}
+		}
+		org := ""
+		if ev.Org != nil {
+			org = ev.Org.Login
+		}
+		if ev.Type != test.eventType || ev.Actor.Login != test.actor || ev.RepoFullName() != test.repo || org != test.org {
+			t.Errorf(
+				"test number %d, expected %v %v %v %v, got %v %v %v %v",
+				index+1, test.eventType, test.actor, test.repo, test.org, ev.Type, ev.Actor.Login, ev.RepoFullName(), org,
+			)
+		}
+		pl := ev.Payload
+		if pl == nil {
+			t.Errorf("test number %d, expected payload, got nil", index+1)
+			continue
+		}
+		issueID, commentID := 0, 0
+		if pl.IssueID != nil {
+			issueID = *pl.IssueID
+		}
+		if pl.CommentID != nil {
+			commentID = *pl.CommentID
+		}
+		if issueID != test.issueID || commentID != test.commentID {
+			t.Errorf("test number %d, expected issue %d, comment %d, got %d, %d", index+1, test.issueID, test.commentID, issueID, commentID)
+		}
+		if len(pl.Commits) != test.commits || (pl.Forkee != nil) != test.forkee || pl.ArtificialIssue != test.artificialIssue {
+			t.Errorf(
+				"test number %d, expected commits %d, forkee %v, artificial issue %v, got %d, %v, %v",
+				index+1, test.commits, test.forkee, test.artificialIssue, len(pl.Commits), pl.Forkee != nil, pl.ArtificialIssue,
+			)
+		}
+		if pl.ArtificialIssue && (pl.Issue == nil || pl.PullRequest == nil || pl.Issue.ID != -pl.PullRequest.ID || pl.Issue.PullRequest == nil) {
+			t.Errorf("test number %d, expected artificial issue for pull request, got %+v", index+1, pl.Issue)
+		}
+	}
+}
+
+func TestNormEventOrgID(t *testing.T) {
+	org := "cncf"
+	resolved := lib.NormEvent{Org: &lib.Org{ID: 4, Login: org}, RepositoryOld: &lib.ForkeeOld{Name: "devstats"}}
+	newEvent := lib.NormalizeEvent(&lib.Event{Type: "WatchEvent", Org: &lib.Org{ID: 3, Login: org}})
+	oldEvent, err := lib.NormalizeEventOld(
+		"1",
+		&lib.EventOld{Type: "WatchEvent", Repository: lib.ForkeeOld{Name: "devstats", Organization: &org}},
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	noOrg, err := lib.NormalizeEventOld("2", &lib.EventOld{Type: "WatchEvent", Repository: lib.ForkeeOld{Name: "devstats"}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Test cases
+	var testCases = []struct {
+		ev       *lib.NormEvent
+		orgID    int
+		expected interface{}
+	}{
+		{ev: newEvent, orgID: 3, expected: 3},
+		{ev: oldEvent, orgID: lib.HashStrings([]string{org}), expected: nil},
+		{ev: &resolved, orgID: 4, expected: 4},
+		{ev: noOrg, expected: nil},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := test.ev.EventOrgID()
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+		orgID := 0
+		if test.ev.Org != nil {
+			orgID = test.ev.Org.ID
+		}
+		if orgID != test.orgID {
+			t.Errorf("test number %d, expected org ID %v, got %v", index+1, test.orgID, orgID)
+		}
+	}
+}
+
+func TestNormalizeEventReview(t *testing.T) {
+	data := []byte(
+		`{"id":"7","type":"PullRequestReviewEvent","actor":{"id":1,"login":"reviewer"},` +
+			`"repo":{"id":2,"name":"cncf/devstats"},"created_at":"2020-08-07T10:00:00Z",` +
+			`"payload":{"action":"created","review":{"id":3,"user":{"id":1,"login":"reviewer"},` +
+			`"commit_id":"abc","submitted_at":"2020-08-07T09:59:59Z","state":"changes_requested"},` +
+			`"pull_request":{"id":4,"number":5}}}`,
+	)
+	var h lib.Event
+	err := json.Unmarshal(data, &h)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	pl := lib.NormalizeEvent(&h).Payload
+	if pl.Review == nil || pl.PullRequest == nil {
+		t.Fatalf("expected review and pull request, got %+v", pl)
+	}
+	review := pl.Review
+	if review.ID != 3 || review.User.Login != "reviewer" || review.State != "changes_requested" ||
+		review.SubmittedAt == nil || review.SubmittedAt.Second() != 59 || pl.PullRequest.Number != 5 {
+		t.Errorf("unexpected review %+v", review)
+	}
+}
@@ -221,6 +221,28 @@ func NValues(n int) string {
 	return s[:len(s)-2] + ")"
 }
 
+// NValuesRows will return values($1, $2, .., $nCols), ..., (.., $nRows*nCols) - for multi row inserts
+func NValuesRows(nRows, nCols int) string {
+	var b strings.Builder
+	b.WriteString("values")
+	i := 1
+	for r := 0; r < nRows; r++ {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for c := 0; c < nCols; c++ {
+			if c > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString("$" + strconv.Itoa(i))
+			i++
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
 // NValue will return $n
 func NValue(index int) string {
 	return fmt.Sprintf("$%d", index)
@@ -0,0 +1,342 @@
+package devstats
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PgStore - Postgres series store, points are stored in project's database (PG_DB)
+// All series points are in a single `gha_series_points` table, its primary key (series, time, tags) is also used to query series by time
+// Series names are in `gha_series`, tags values are in `gha_series_tags`, writing and dropping series doesn't run any DDL
+// Like in InfluxDB, point is identified by series, exact time and tags, writing the same point again
+// overwrites fields given in the new point
+// Time is not bucketed (metrics points are already written at their period start), Postgres precision is a microsecond
+type PgStore struct {
+	ctx *Ctx
+	con *sql.DB
+}
+
+// NewPgStore - connect to project's Postgres database
+func NewPgStore(ctx *Ctx) *PgStore {
+	return &PgStore{ctx: ctx, con: PgConn(ctx)}
+}
+
+// pgSeriesRow - point prepared for insert: JSON encoded tags and fields
+type pgSeriesRow struct {
+	series string
+	dt     time.Time
+	tags   string
+	fields map[string]interface{}
+}
+
+// pgSeriesTime - return point time as stored in gha_series_points: UTC with microsecond precision
+func pgSeriesTime(dt time.Time) time.Time {
+	return dt.UTC().Truncate(time.Microsecond)
+}
+
+// WritePoints - upsert points, points with the same series, time and tags are merged (fields of later points win)
+func (ps *PgStore) WritePoints(points []SeriesPoint) error {
+	rows := []*pgSeriesRow{}
+	keys := make(map[string]*pgSeriesRow)
+	tags := make(map[[3]string]struct{})
+	for _, point := range points {
+		if len(point.Fields) == 0 {
+			return fmt.Errorf("series '%s': point without fields", point.Name)
+		}
+		pTags := point.Tags
+		if pTags == nil {
+			pTags = map[string]string{}
+		}
+		jTags, err := json.Marshal(pTags)
+		if err != nil {
+			return err
+		}
+		row := &pgSeriesRow{series: point.Name, dt: pgSeriesTime(point.Time), tags: string(jTags), fields: make(map[string]interface{})}
+		key := row.series + "\n" + row.dt.Format(time.RFC3339Nano) + "\n" + row.tags
+		if prev, ok := keys[key]; ok {
+			row = prev
+		} else {
+			keys[key] = row
+			rows = append(rows, row)
+		}
+		for k, v := range point.Fields {
+			row.fields[k] = v
+		}
+		for k, v := range pTags {
+			tags[[3]string{point.Name, k, v}] = struct{}{}
+		}
+	}
+	// Always insert rows in the same order, so concurrent writes cannot deadlock
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.series != b.series {
+			return a.series < b.series
+		}
+		if !a.dt.Equal(b.dt) {
+			return a.dt.Before(b.dt)
+		}
+		return a.tags < b.tags
+	})
+	tx, err := ps.con.Begin()
+	if err != nil {
+		return err
+	}
+	err = ps.writeRows(tx, rows, tags)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if ps.ctx.Debug > 0 {
+		Printf("Written %d points (%d rows)\n", len(points), len(rows))
+	}
+	return tx.Commit()
+}
+
+// writeRows - insert series, points and tags rows using multi row inserts
+func (ps *PgStore) writeRows(tx *sql.Tx, rows []*pgSeriesRow, tags map[[3]string]struct{}) error {
+	// Rows are sorted by series
+	series := []interface{}{}
+	for _, row := range rows {
+		if len(series) == 0 || series[len(series)-1] != row.series {
+			series = append(series, row.series)
+		}
+	}
+	for from := 0; from < len(series); from += MaxPgParams {
+		to := from + MaxPgParams
+		if to > len(series) {
+			to = len(series)
+		}
+		_, err := ExecSQLTx(
+			tx,
+			ps.ctx,
+			"insert into gha_series(series) "+NValuesRows(to-from, 1)+" on conflict do nothing",
+			series[from:to]...,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	maxRows := MaxPgParams / 4
+	for from := 0; from < len(rows); from += maxRows {
+		to := from + maxRows
+		if to > len(rows) {
+			to = len(rows)
+		}
+		args := []interface{}{}
+		for _, row := range rows[from:to] {
+			jFields, err := json.Marshal(row.fields)
+			if err != nil {
+				return err
+			}
+			args = append(args, row.series, row.dt, row.tags, string(jFields))
+		}
+		_, err := ExecSQLTx(
+			tx,
+			ps.ctx,
+			"insert into gha_series_points(series, time, tags, fields) "+NValuesRows(to-from, 4)+
+				" on conflict(series, time, tags) do update set fields = gha_series_points.fields || excluded.fields",
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	sTags := [][3]string{}
+	for tag := range tags {
+		sTags = append(sTags, tag)
+	}
+	sort.Slice(sTags, func(i, j int) bool {
+		a, b := sTags[i], sTags[j]
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	args := []interface{}{}
+	for _, tag := range sTags {
+		args = append(args, tag[0], tag[1], tag[2])
+	}
+	maxArgs := (MaxPgParams / 3) * 3
+	for from := 0; from < len(args); from += maxArgs {
+		to := from + maxArgs
+		if to > len(args) {
+			to = len(args)
+		}
+		_, err := ExecSQLTx(
+			tx,
+			ps.ctx,
+			"insert into gha_series_tags(series, key, value) "+NValuesRows((to-from)/3, 3)+" on conflict do nothing",
+			args[from:to]...,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// onePoint - return the first point returned by query (selecting time, tags and fields) or nil
+func (ps *PgStore) onePoint(series, query string, args ...interface{}) (*SeriesPoint, error) {
+	var (
+		dt      time.Time
+		jTags   []byte
+		jFields []byte
+	)
+	err := QueryRowSQL(ps.con, ps.ctx, query, args...).Scan(&dt, &jTags, &jFields)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pt := SeriesPoint{Name: series, Time: dt}
+	err = json.Unmarshal(jTags, &pt.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if len(pt.Tags) == 0 {
+		pt.Tags = nil
+	}
+	err = json.Unmarshal(jFields, &pt.Fields)
+	if err != nil {
+		return nil, err
+	}
+	return &pt, nil
+}
+
+// LastPoint - return the newest series point
+func (ps *PgStore) LastPoint(series string) (*SeriesPoint, error) {
+	return ps.onePoint(
+		series,
+		"select time, tags, fields from gha_series_points where series = $1 order by time desc limit 1",
+		series,
+	)
+}
+
+// PointAt - return series point at a given time
+func (ps *PgStore) PointAt(series string, dt time.Time) (*SeriesPoint, error) {
+	return ps.onePoint(
+		series,
+		"select time, tags, fields from gha_series_points where series = $1 and time = $2 limit 1",
+		series,
+		pgSeriesTime(dt),
+	)
+}
+
+// SeriesFields - return all field keys used by any series point
+func (ps *PgStore) SeriesFields(series string) (fields []string, err error) {
+	rows, err := QuerySQL(
+		ps.con,
+		ps.ctx,
+		"select distinct jsonb_object_keys(fields) as field from gha_series_points where series = $1 order by field",
+		series,
+	)
+	if err != nil {
+		return
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	field := ""
+	for rows.Next() {
+		err = rows.Scan(&field)
+		if err != nil {
+			return
+		}
+		fields = append(fields, field)
+	}
+	err = rows.Err()
+	return
+}
+
+// HasPoint - check if series has any point with given tags values
+func (ps *PgStore) HasPoint(series string, tags map[string]string) (bool, error) {
+	if tags == nil {
+		tags = map[string]string{}
+	}
+	jTags, err := json.Marshal(tags)
+	if err != nil {
+		return false, err
+	}
+	var n int
+	err = QueryRowSQL(
+		ps.con,
+		ps.ctx,
+		"select 1 from gha_series_points where series = $1 and tags @> $2 limit 1",
+		series,
+		string(jTags),
+	).Scan(&n)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MatchingSeries - return names of series matching given regexp (InfluxDB style /regexp/)
+func (ps *PgStore) MatchingSeries(re string) (names []string, err error) {
+	re = strings.TrimSuffix(strings.TrimPrefix(re, "/"), "/")
+	rows, err := QuerySQL(ps.con, ps.ctx, "select series from gha_series where series ~ $1 order by series", re)
+	if err != nil {
+		return
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	name := ""
+	for rows.Next() {
+		err = rows.Scan(&name)
+		if err != nil {
+			return
+		}
+		names = append(names, name)
+	}
+	err = rows.Err()
+	return
+}
+
+// DropSeries - delete series points and tags
+func (ps *PgStore) DropSeries(series string) error {
+	tx, err := ps.con.Begin()
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"delete from gha_series_points where series = $1",
+		"delete from gha_series_tags where series = $1",
+		"delete from gha_series where series = $1",
+	} {
+		_, err = ExecSQLTx(tx, ps.ctx, query, series)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// TagValues - return all values of a given tag key
+func (ps *PgStore) TagValues(key string) (values []string, err error) {
+	rows, err := QuerySQL(ps.con, ps.ctx, "select distinct value from gha_series_tags where key = $1 order by value", key)
+	if err != nil {
+		return
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	value := ""
+	for rows.Next() {
+		err = rows.Scan(&value)
+		if err != nil {
+			return
+		}
+		values = append(values, value)
+	}
+	err = rows.Err()
+	return
+}
+
+// Close - close Postgres connection
+func (ps *PgStore) Close() error {
+	return ps.con.Close()
+}
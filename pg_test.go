@@ -361,3 +361,338 @@ func getInts(c *sql.DB, ctx *lib.Ctx) []int {
 	lib.FatalOnError(rows.Err())
 	return arr
 }
+
+func TestNValuesRows(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		rows     int
+		cols     int
+		expected string
+	}{
+		{rows: 1, cols: 1, expected: "values($1)"},
+		{rows: 1, cols: 3, expected: "values($1, $2, $3)"},
+		{rows: 2, cols: 2, expected: "values($1, $2), ($3, $4)"},
+		{rows: 3, cols: 1, expected: "values($1), ($2), ($3)"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.NValuesRows(test.rows, test.cols)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestPgWriter(t *testing.T) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Do not allow to run tests in "gha" database
+	if ctx.PgDB != "dbtest" {
+		t.Errorf("tests can only be run on \"dbtest\" database")
+		return
+	}
+
+	// Drop database if exists
+	lib.DropDatabaseIfExists(&ctx)
+
+	// Create database if needed
+	createdDatabase := lib.CreateDatabaseIfNeeded(&ctx)
+	if !createdDatabase {
+		t.Errorf("failed to create database \"%s\"", ctx.PgDB)
+	}
+
+	// Drop database after tests
+	defer func() {
+		// Drop database after tests
+		lib.DropDatabaseIfExists(&ctx)
+	}()
+
+	// Connect to Postgres DB
+	c := lib.PgConn(&ctx)
+	defer func() { lib.FatalOnError(c.Close()) }()
+
+	// Create example table
+	lib.ExecSQLWithErr(
+		c,
+		&ctx,
+		lib.CreateTable(
+			"test(an_int int, a_string text, a_dt {{ts}}, primary key(an_int))",
+		),
+	)
+
+	// Batch mode, flush when 3 rows are queued
+	ctx.BatchRows = 3
+	w := lib.NewPgWriter(c, &ctx)
+	w.Insert(&ctx, false, "into test(an_int, a_string, a_dt)", 1, "string", time.Now())
+	w.Insert(&ctx, true, "into test(an_int, a_string, a_dt)", 1, "conflicting key", time.Now())
+	w.Commit(&ctx)
+
+	// Nothing should be written yet
+	gotArr := getInts(c, &ctx)
+	if len(gotArr) != 0 {
+		t.Errorf("expected no rows before flush, got %v", gotArr)
+	}
+	if !w.Pending("test") {
+		t.Errorf("expected pending rows for table test")
+	}
+
+	// This will reach batch size
+	w.Insert(&ctx, false, "into test(an_int, a_string, a_dt)", 11, "another string", time.Now())
+	w.Commit(&ctx)
+	gotArr = getInts(c, &ctx)
+	expectedArr := []int{1, 11}
+	if !testlib.CompareIntSlices(gotArr, expectedArr) {
+		t.Errorf("expected %v after batch commit, got %v", expectedArr, gotArr)
+	}
+	if w.Pending("test") {
+		t.Errorf("expected no pending rows after flush")
+	}
+
+	// Final flush
+	w.Insert(&ctx, true, "into test(an_int, a_string, a_dt)", 21, "flushed", time.Now())
+	w.FlushIfPending(&ctx, "other")
+	w.FlushIfPending(&ctx, "test")
+	gotArr = getInts(c, &ctx)
+	expectedArr = []int{1, 11, 21}
+	if !testlib.CompareIntSlices(gotArr, expectedArr) {
+		t.Errorf("expected %v after flush, got %v", expectedArr, gotArr)
+	}
+
+	// Event rows are not flushed in the middle of an event
+	w.Insert(&ctx, false, "into test(an_int, a_string, a_dt)", 22, "previous event", time.Now())
+	w.BeginEvent()
+	w.AddKey("event")
+	w.Insert(&ctx, false, "into test(an_int, a_string, a_dt)", 23, "event", time.Now())
+	w.FlushIfPending(&ctx, "test")
+	gotArr = getInts(c, &ctx)
+	expectedArr = []int{1, 11, 21, 22}
+	if !testlib.CompareIntSlices(gotArr, expectedArr) {
+		t.Errorf("expected %v after flush inside event, got %v", expectedArr, gotArr)
+	}
+	if !w.HasKey("event") || w.Pending("test") {
+		t.Errorf("expected current event key and no pending rows")
+	}
+	w.EndEvent(&ctx)
+	w.Flush(&ctx)
+	gotArr = getInts(c, &ctx)
+	expectedArr = []int{1, 11, 21, 22, 23}
+	if !testlib.CompareIntSlices(gotArr, expectedArr) {
+		t.Errorf("expected %v after event end, got %v", expectedArr, gotArr)
+	}
+
+	// Row mode inside transaction
+	ctx.BatchRows = 0
+	w = lib.NewPgWriter(c, &ctx)
+	w.Begin()
+	w.Insert(&ctx, false, "into test(an_int, a_string, a_dt)", 31, "row mode", time.Now())
+	w.Commit(&ctx)
+	gotArr = getInts(c, &ctx)
+	expectedArr = []int{1, 11, 21, 31}
+	if !testlib.CompareIntSlices(gotArr, expectedArr) {
+		t.Errorf("expected %v after row mode commit, got %v", expectedArr, gotArr)
+	}
+}
+
+// benchmarkPgWriter - inserts b.N rows into a test table using given batch size (0 - row by row)
+func benchmarkPgWriter(b *testing.B, batchRows int) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Do not allow to run benchmarks in "gha" database
+	if ctx.PgDB != "dbtest" {
+		b.Errorf("benchmarks can only be run on \"dbtest\" database")
+		return
+	}
+	lib.DropDatabaseIfExists(&ctx)
+	if !lib.CreateDatabaseIfNeeded(&ctx) {
+		b.Errorf("failed to create database \"%s\"", ctx.PgDB)
+	}
+	defer func() { lib.DropDatabaseIfExists(&ctx) }()
+	c := lib.PgConn(&ctx)
+	defer func() { lib.FatalOnError(c.Close()) }()
+	lib.ExecSQLWithErr(
+		c,
+		&ctx,
+		lib.CreateTable(
+			"test(an_int int, a_string text, a_dt {{ts}}, primary key(an_int))",
+		),
+	)
+
+	// Each "event" writes 10 rows in a transaction, just like gha2db does
+	ctx.BatchRows = batchRows
+	w := lib.NewPgWriter(c, &ctx)
+	dt := time.Now()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%10 == 0 {
+			w.Begin()
+		}
+		w.Insert(&ctx, true, "into test(an_int, a_string, a_dt)", i, "benchmark string", dt)
+		if i%10 == 9 {
+			w.Commit(&ctx)
+		}
+	}
+	w.Commit(&ctx)
+	w.Flush(&ctx)
+}
+
+func BenchmarkPgWriterRows(b *testing.B) {
+	benchmarkPgWriter(b, 0)
+}
+
+func BenchmarkPgWriterBatch100(b *testing.B) {
+	benchmarkPgWriter(b, 100)
+}
+
+func BenchmarkPgWriterBatch1000(b *testing.B) {
+	benchmarkPgWriter(b, 1000)
+}
+
+func TestPgStore(t *testing.T) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Do not allow to run tests in "gha" database
+	if ctx.PgDB != "dbtest" {
+		t.Errorf("tests can only be run on \"dbtest\" database")
+		return
+	}
+
+	// Drop database if exists
+	lib.DropDatabaseIfExists(&ctx)
+
+	// Create database if needed
+	createdDatabase := lib.CreateDatabaseIfNeeded(&ctx)
+	if !createdDatabase {
+		t.Errorf("failed to create database \"%s\"", ctx.PgDB)
+	}
+
+	// Drop database after tests
+	defer func() {
+		// Drop database after tests
+		lib.DropDatabaseIfExists(&ctx)
+	}()
+
+	// Create DB structure (with series tables) and connect series store
+	ctx.Table = true
+	lib.Structure(&ctx)
+	store := lib.NewPgStore(&ctx)
+	defer func() { lib.FatalOnError(store.Close()) }()
+
+	// Points: two annotations in the same hour, untagged point written twice in the same batch, tagged points
+	ft := testlib.YMDHMS
+	dt := ft(2018, 1, 2)
+	anno1 := ft(2018, 1, 2, 3, 10)
+	anno2 := ft(2018, 1, 2, 3, 40, 15)
+	err := store.WritePoints(
+		[]lib.SeriesPoint{
+			{Name: "s1", Fields: map[string]interface{}{"a": 1.0}, Time: dt},
+			{Name: "s1", Fields: map[string]interface{}{"b": 2.0}, Time: dt},
+			{Name: "s1", Fields: map[string]interface{}{"title": "v1.0"}, Time: anno1},
+			{Name: "s1", Fields: map[string]interface{}{"title": "v1.1"}, Time: anno2},
+			{Name: "s2", Tags: map[string]string{"period": "d", "name": "x"}, Fields: map[string]interface{}{"value": 1.0}, Time: dt},
+			{Name: "s2", Tags: map[string]string{"period": "d", "name": "y"}, Fields: map[string]interface{}{"value": 2.0}, Time: dt},
+		},
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+
+	// Upsert merges fields with already stored point
+	err = store.WritePoints([]lib.SeriesPoint{{Name: "s1", Fields: map[string]interface{}{"a": 3.0}, Time: dt}})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	point, err := store.PointAt("s1", dt)
+	if err != nil || point == nil {
+		t.Fatalf("expected point at %v, got %v, error %v", dt, point, err)
+	}
+	if len(point.Fields) != 2 || point.Fields["a"] != 3.0 || point.Fields["b"] != 2.0 {
+		t.Errorf("expected merged fields a=3, b=2, got %v", point.Fields)
+	}
+
+	// Points are stored with exact time, so annotations from the same hour are not merged
+	for _, test := range []struct {
+		dt    time.Time
+		title interface{}
+	}{{dt: anno1, title: "v1.0"}, {dt: anno2, title: "v1.1"}, {dt: ft(2018, 1, 2, 3)}} {
+		point, err := store.PointAt("s1", test.dt)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if test.title == nil {
+			if point != nil {
+				t.Errorf("expected no point at %v, got %v", test.dt, point)
+			}
+			continue
+		}
+		if point == nil || !point.Time.Equal(test.dt) || point.Fields["title"] != test.title {
+			t.Errorf("expected point at %v with title %v, got %v", test.dt, test.title, point)
+		}
+	}
+	point, err = store.LastPoint("s1")
+	if err != nil || point == nil || !point.Time.Equal(anno2) {
+		t.Errorf("expected last point at %v, got %v, error %v", anno2, point, err)
+	}
+	fields, err := store.SeriesFields("s1")
+	if err != nil || !testlib.CompareStringSlices(fields, []string{"a", "b", "title"}) {
+		t.Errorf("expected series fields [a b title], got %v, error %v", fields, err)
+	}
+
+	// Tags
+	for _, test := range []struct {
+		series   string
+		tags     map[string]string
+		expected bool
+	}{
+		{series: "s2", tags: map[string]string{"name": "x"}, expected: true},
+		{series: "s2", tags: map[string]string{"period": "d", "name": "y"}, expected: true},
+		{series: "s2", tags: map[string]string{"name": "z"}},
+		{series: "s2", expected: true},
+		{series: "s1", expected: true},
+		{series: "s3"},
+	} {
+		got, err := store.HasPoint(test.series, test.tags)
+		if err != nil || got != test.expected {
+			t.Errorf("expected %v for series %s tags %v, got %v, error %v", test.expected, test.series, test.tags, got, err)
+		}
+	}
+	values, err := store.TagValues("name")
+	if err != nil || !testlib.CompareStringSlices(values, []string{"x", "y"}) {
+		t.Errorf("expected tag values [x y], got %v, error %v", values, err)
+	}
+	names, err := store.MatchingSeries("/^s/")
+	if err != nil || !testlib.CompareStringSlices(names, []string{"s1", "s2"}) {
+		t.Errorf("expected series [s1 s2], got %v, error %v", names, err)
+	}
+
+	// Drop series with its points and tags, dropping unknown series is not an error
+	for _, series := range []string{"s2", "s3"} {
+		err = store.DropSeries(series)
+		if err != nil {
+			t.Errorf("unexpected error dropping %s: %v", series, err)
+		}
+	}
+	has, err := store.HasPoint("s2", nil)
+	if err != nil || has {
+		t.Errorf("expected no points after drop, got %v, error %v", has, err)
+	}
+	values, err = store.TagValues("name")
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected no tag values after drop, got %v, error %v", values, err)
+	}
+	names, err = store.MatchingSeries("/^s/")
+	if err != nil || !testlib.CompareStringSlices(names, []string{"s1"}) {
+		t.Errorf("expected series [s1], got %v, error %v", names, err)
+	}
+
+	// Series can be written again after drop
+	err = store.WritePoints([]lib.SeriesPoint{{Name: "s2", Fields: map[string]interface{}{"value": 3.0}, Time: dt}})
+	if err != nil {
+		t.Errorf("unexpected error writing dropped series: %v", err)
+	}
+}
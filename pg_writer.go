@@ -0,0 +1,254 @@
+package devstats
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// MaxPgParams - maximum number of bind parameters in a single Postgres statement
+const MaxPgParams = 65535
+
+// pgTableRows - rows queued for a single "into table(columns)" insert
+type pgTableRows struct {
+	into   string
+	ignore bool
+	nCols  int
+	args   []interface{}
+}
+
+// pgBatch - rows queued for multiple tables, keys (for example event IDs) of queued rows
+type pgBatch struct {
+	nRows  int
+	order  []string
+	tables map[string]*pgTableRows
+	keys   map[string]struct{}
+}
+
+// newPgBatch - returns empty batch
+func newPgBatch() *pgBatch {
+	return &pgBatch{tables: make(map[string]*pgTableRows), keys: make(map[string]struct{})}
+}
+
+// add - queue a single row
+func (b *pgBatch) add(ignore bool, into string, args []interface{}) {
+	key := into
+	if ignore {
+		key = "ignore " + into
+	}
+	rows, ok := b.tables[key]
+	if !ok {
+		rows = &pgTableRows{into: into, ignore: ignore, nCols: len(args)}
+		b.tables[key] = rows
+		b.order = append(b.order, key)
+	}
+	if len(args) != rows.nCols {
+		Fatalf("%s: expected %d values, got %d", into, rows.nCols, len(args))
+	}
+	rows.args = append(rows.args, args...)
+	b.nRows++
+}
+
+// merge - move all rows and keys of other batch to this batch
+func (b *pgBatch) merge(other *pgBatch) {
+	for _, key := range other.order {
+		rows := other.tables[key]
+		nCols := rows.nCols
+		for i := 0; i < len(rows.args); i += nCols {
+			b.add(rows.ignore, rows.into, rows.args[i:i+nCols])
+		}
+	}
+	for key := range other.keys {
+		b.keys[key] = struct{}{}
+	}
+}
+
+// PgWriter - writes rows into Postgres either one by one (default) or in multi row batches
+// Batch mode is enabled when ctx.BatchRows > 0, rows are then queued and written
+// (using a single transaction) when at least ctx.BatchRows rows are queued or when Flush() is called.
+// In batch mode rows inserted between BeginEvent and EndEvent are only queued on EndEvent, so a flush
+// (also a flush before querying a table using FlushIfPending) never writes a part of an event.
+// In row mode Begin/Commit start and commit transaction, all inserts between them use that transaction.
+type PgWriter struct {
+	DB    *sql.DB
+	Tx    *sql.Tx
+	Batch bool
+	NRows int
+	batch *pgBatch
+	event *pgBatch
+}
+
+// NewPgWriter - returns writer for a given Postgres connection, batch mode is taken from ctx.BatchRows
+func NewPgWriter(db *sql.DB, ctx *Ctx) *PgWriter {
+	return &PgWriter{
+		DB:    db,
+		Batch: ctx.BatchRows > 0,
+		batch: newPgBatch(),
+	}
+}
+
+// tableName - return table name from "into table(columns)"
+func tableName(into string) string {
+	name := strings.TrimSpace(strings.TrimPrefix(into, "into "))
+	i := strings.Index(name, "(")
+	if i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSpace(name)
+}
+
+// Insert - insert a single row, into is "into table(col1, col2, ..., colN)", args are N column values
+// ignore means "on conflict do nothing"
+func (w *PgWriter) Insert(ctx *Ctx, ignore bool, into string, args ...interface{}) {
+	if !w.Batch {
+		query := into + " " + NValues(len(args))
+		if ignore {
+			query = InsertIgnore(query)
+		} else {
+			query = "insert " + query
+		}
+		if w.Tx != nil {
+			ExecSQLTxWithErr(w.Tx, ctx, query, args...)
+		} else {
+			ExecSQLWithErr(w.DB, ctx, query, args...)
+		}
+		return
+	}
+	if w.event != nil {
+		w.event.add(ignore, into, args)
+		return
+	}
+	w.batch.add(ignore, into, args)
+	w.NRows = w.batch.nRows
+}
+
+// BeginEvent - in batch mode start queuing rows of a single event (see EndEvent), no-op in row mode
+func (w *PgWriter) BeginEvent() {
+	if w.Batch {
+		w.event = newPgBatch()
+	}
+}
+
+// EndEvent - in batch mode queue all rows of the current event, they're flushed when there are at least ctx.BatchRows rows queued
+func (w *PgWriter) EndEvent(ctx *Ctx) {
+	if w.event == nil {
+		return
+	}
+	w.batch.merge(w.event)
+	w.NRows = w.batch.nRows
+	w.event = nil
+	if w.NRows >= ctx.BatchRows {
+		w.Flush(ctx)
+	}
+}
+
+// Begin - start transaction in row mode, no-op in batch mode
+func (w *PgWriter) Begin() {
+	if w.Batch {
+		return
+	}
+	tx, err := w.DB.Begin()
+	FatalOnError(err)
+	w.Tx = tx
+}
+
+// Commit - commit transaction in row mode, in batch mode it flushes queued rows when there are at least ctx.BatchRows of them
+func (w *PgWriter) Commit(ctx *Ctx) {
+	if w.Batch {
+		if w.NRows >= ctx.BatchRows {
+			w.Flush(ctx)
+		}
+		return
+	}
+	if w.Tx == nil {
+		return
+	}
+	FatalOnError(w.Tx.Commit())
+	w.Tx = nil
+}
+
+// Pending - is there any queued (not yet written) row for a given table
+// Rows of the current event (see BeginEvent) are not written by Flush, so they're not reported
+func (w *PgWriter) Pending(table string) bool {
+	if w.NRows == 0 {
+		return false
+	}
+	for _, key := range w.batch.order {
+		if tableName(w.batch.tables[key].into) == table {
+			return true
+		}
+	}
+	return false
+}
+
+// FlushIfPending - flush queued rows if any of them is for a given table
+// Call it before querying a table that might have queued rows
+func (w *PgWriter) FlushIfPending(ctx *Ctx, table string) {
+	if w.Pending(table) {
+		w.Flush(ctx)
+	}
+}
+
+// AddKey - mark a given key as queued (for example event ID), keys are cleared on flush
+func (w *PgWriter) AddKey(key string) {
+	if !w.Batch {
+		return
+	}
+	if w.event != nil {
+		w.event.keys[key] = struct{}{}
+		return
+	}
+	w.batch.keys[key] = struct{}{}
+}
+
+// HasKey - was a given key queued since last flush (or in the current event)
+func (w *PgWriter) HasKey(key string) bool {
+	if w.event != nil {
+		if _, ok := w.event.keys[key]; ok {
+			return true
+		}
+	}
+	_, ok := w.batch.keys[key]
+	return ok
+}
+
+// Query - run query using transaction (if started) or DB connection
+func (w *PgWriter) Query(ctx *Ctx, query string, args ...interface{}) *sql.Rows {
+	if w.Tx != nil {
+		return QuerySQLTxWithErr(w.Tx, ctx, query, args...)
+	}
+	return QuerySQLWithErr(w.DB, ctx, query, args...)
+}
+
+// Flush - write all queued rows using multi row inserts in a single transaction
+// Tables are written in order of their first use, rows of the current event are not written
+func (w *PgWriter) Flush(ctx *Ctx) {
+	if w.NRows == 0 {
+		return
+	}
+	tx, err := w.DB.Begin()
+	FatalOnError(err)
+	for _, key := range w.batch.order {
+		rows := w.batch.tables[key]
+		maxRows := MaxPgParams / rows.nCols
+		nRows := len(rows.args) / rows.nCols
+		for from := 0; from < nRows; from += maxRows {
+			to := from + maxRows
+			if to > nRows {
+				to = nRows
+			}
+			query := rows.into + " " + NValuesRows(to-from, rows.nCols)
+			if rows.ignore {
+				query = InsertIgnore(query)
+			} else {
+				query = "insert " + query
+			}
+			ExecSQLTxWithErr(tx, ctx, query, rows.args[from*rows.nCols:to*rows.nCols]...)
+		}
+	}
+	FatalOnError(tx.Commit())
+	if ctx.Debug > 0 {
+		Printf("Flushed %d rows into %d tables\n", w.NRows, len(w.batch.order))
+	}
+	w.NRows = 0
+	w.batch = newPgBatch()
+}
@@ -0,0 +1,118 @@
+package devstats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProjectSync - project synced by devstats tool
+// Projects with higher Priority are started first, projects with the same priority are started by Order
+// CPUs - number of workers (CPUs and DB connections) project's sync can use, 0 means an equal share of the budget
+type ProjectSync struct {
+	Name     string
+	Order    int
+	Priority int
+	CPUs     int
+}
+
+// ProjectSyncResult - result of a single project sync: workers used, start time, duration and error (if any)
+type ProjectSyncResult struct {
+	Name  string
+	CPUs  int
+	Start time.Time
+	Time  time.Duration
+	Err   error
+}
+
+// SortProjectsSync - sort projects by priority (descending), then by order, then by name
+func SortProjectsSync(projects []ProjectSync) {
+	sort.SliceStable(projects, func(i, j int) bool {
+		pi, pj := projects[i], projects[j]
+		if pi.Priority != pj.Priority {
+			return pi.Priority > pj.Priority
+		}
+		if pi.Order != pj.Order {
+			return pi.Order < pj.Order
+		}
+		return pi.Name < pj.Name
+	})
+}
+
+// projectSyncCPUs - return number of workers given project sync can use
+func projectSyncCPUs(proj *ProjectSync, n, budget int) int {
+	cpus := proj.CPUs
+	if cpus <= 0 {
+		cpus = budget / n
+	}
+	if cpus > budget {
+		cpus = budget
+	}
+	if cpus < 1 {
+		cpus = 1
+	}
+	return cpus
+}
+
+// SyncProjects - call run for all projects (in SortProjectsSync order), at most n of them at once
+// Total number of workers used by running projects never exceeds budget (each project uses at least one)
+// Projects are started strictly in order, so a project waiting for free workers is not overtaken by next ones
+// Returns results in the start order
+func SyncProjects(projects []ProjectSync, n, budget int, run func(proj *ProjectSync, cpus int) error) []ProjectSyncResult {
+	if n < 1 {
+		n = 1
+	}
+	if budget < 1 {
+		budget = 1
+	}
+	sorted := append([]ProjectSync{}, projects...)
+	SortProjectsSync(sorted)
+	results := make([]ProjectSyncResult, len(sorted))
+	done := make(chan int)
+	running, free := 0, budget
+	for i := range sorted {
+		cpus := projectSyncCPUs(&sorted[i], n, budget)
+		for running >= n || free < cpus {
+			j := <-done
+			running--
+			free += results[j].CPUs
+		}
+		running++
+		free -= cpus
+		results[i] = ProjectSyncResult{Name: sorted[i].Name, CPUs: cpus, Start: time.Now()}
+		go func(i int) {
+			err := run(&sorted[i], results[i].CPUs)
+			results[i].Time = time.Now().Sub(results[i].Start)
+			results[i].Err = err
+			done <- i
+		}(i)
+	}
+	for running > 0 {
+		<-done
+		running--
+	}
+	return results
+}
+
+// SyncProjectsSummary - return projects sync status table (one line per project) and number of failed projects
+func SyncProjectsSummary(results []ProjectSyncResult) (string, int) {
+	failed := 0
+	lines := []string{fmt.Sprintf("%-20s %-8s %4s %-19s %s", "project", "status", "cpus", "start", "time")}
+	for _, result := range results {
+		status := "ok"
+		if result.Err != nil {
+			status = "failed"
+			failed++
+		}
+		line := fmt.Sprintf(
+			"%-20s %-8s %4d %-19s %v",
+			result.Name, status, result.CPUs, ToYMDHMSDate(result.Start), result.Time,
+		)
+		if result.Err != nil {
+			line += ", " + result.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n", failed
+}
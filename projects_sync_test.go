@@ -0,0 +1,159 @@
+package devstats
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestSortProjectsSync(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		projects []lib.ProjectSync
+		expected []string
+	}{
+		{projects: []lib.ProjectSync{}, expected: []string{}},
+		{
+			projects: []lib.ProjectSync{{Name: "c", Order: 3}, {Name: "a", Order: 1}, {Name: "b", Order: 2}},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			projects: []lib.ProjectSync{{Name: "kubernetes", Order: 1}, {Name: "cni", Order: 9, Priority: 1}, {Name: "envoy", Order: 8}},
+			expected: []string{"cni", "kubernetes", "envoy"},
+		},
+		{
+			projects: []lib.ProjectSync{{Name: "y"}, {Name: "x"}, {Name: "z", Priority: -1}},
+			expected: []string{"x", "y", "z"},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		lib.SortProjectsSync(test.projects)
+		got := []string{}
+		for _, proj := range test.projects {
+			got = append(got, proj.Name)
+		}
+		if !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSyncProjects(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		projects    []lib.ProjectSync
+		n           int
+		budget      int
+		expected    []string
+		cpus        []int
+		maxRunning  int
+		maxUsedCPUs int
+	}{
+		{
+			projects:    []lib.ProjectSync{{Name: "b", Order: 2}, {Name: "a", Order: 1}, {Name: "c", Order: 3}},
+			n:           1,
+			budget:      4,
+			expected:    []string{"a", "b", "c"},
+			cpus:        []int{4, 4, 4},
+			maxRunning:  1,
+			maxUsedCPUs: 4,
+		},
+		{
+			projects:    []lib.ProjectSync{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}},
+			n:           2,
+			budget:      8,
+			expected:    []string{"a", "b", "c", "d", "e"},
+			cpus:        []int{4, 4, 4, 4, 4},
+			maxRunning:  2,
+			maxUsedCPUs: 8,
+		},
+		{
+			projects: []lib.ProjectSync{
+				{Name: "kubernetes", Order: 1, CPUs: 6},
+				{Name: "prometheus", Order: 2},
+				{Name: "cni", Order: 3, Priority: 1},
+				{Name: "envoy", Order: 4, CPUs: 100},
+			},
+			n:           3,
+			budget:      8,
+			expected:    []string{"cni", "kubernetes", "prometheus", "envoy"},
+			cpus:        []int{2, 6, 2, 8},
+			maxRunning:  2,
+			maxUsedCPUs: 8,
+		},
+		{
+			projects:    []lib.ProjectSync{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			n:           4,
+			budget:      2,
+			expected:    []string{"a", "b", "c"},
+			cpus:        []int{1, 1, 1},
+			maxRunning:  2,
+			maxUsedCPUs: 2,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var mtx sync.Mutex
+		running, usedCPUs, maxRunning, maxUsedCPUs := 0, 0, 0, 0
+		results := lib.SyncProjects(
+			test.projects,
+			test.n,
+			test.budget,
+			func(proj *lib.ProjectSync, cpus int) error {
+				mtx.Lock()
+				running++
+				usedCPUs += cpus
+				if running > maxRunning {
+					maxRunning = running
+				}
+				if usedCPUs > maxUsedCPUs {
+					maxUsedCPUs = usedCPUs
+				}
+				mtx.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mtx.Lock()
+				running--
+				usedCPUs -= cpus
+				mtx.Unlock()
+				if proj.Name == "c" {
+					return fmt.Errorf("%s failed", proj.Name)
+				}
+				return nil
+			},
+		)
+		got := []string{}
+		cpus := []int{}
+		for _, result := range results {
+			got = append(got, result.Name)
+			cpus = append(cpus, result.CPUs)
+			if (result.Err != nil) != (result.Name == "c") || result.Time < 10*time.Millisecond {
+				t.Errorf("test number %d, unexpected result %+v", index+1, result)
+			}
+		}
+		if !testlib.CompareStringSlices(got, test.expected) || !testlib.CompareIntSlices(cpus, test.cpus) {
+			t.Errorf("test number %d, expected %v %v, got %v %v", index+1, test.expected, test.cpus, got, cpus)
+		}
+		if maxRunning != test.maxRunning || maxUsedCPUs != test.maxUsedCPUs {
+			t.Errorf(
+				"test number %d, expected max running %d, max cpus %d, got %d, %d",
+				index+1, test.maxRunning, test.maxUsedCPUs, maxRunning, maxUsedCPUs,
+			)
+		}
+		summary, failed := lib.SyncProjectsSummary(results)
+		expectedFailed := 0
+		for _, name := range test.expected {
+			if name == "c" {
+				expectedFailed++
+			}
+		}
+		if failed != expectedFailed || strings.Count(summary, "\n") != len(results)+1 {
+			t.Errorf("test number %d, unexpected summary (%d failed):\n%s", index+1, failed, summary)
+		}
+	}
+}
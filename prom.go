@@ -0,0 +1,295 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PromSample - single Prometheus sample: labels and value
+type PromSample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// PromMetric - Prometheus metric family: name, help, type (gauge or counter) and samples
+type PromMetric struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []PromSample
+}
+
+// Add - add sample with labels given as name, value pairs
+func (pm *PromMetric) Add(value float64, labels ...string) {
+	sample := PromSample{Labels: make(map[string]string), Value: value}
+	for i := 0; i+1 < len(labels); i += 2 {
+		sample.Labels[labels[i]] = labels[i+1]
+	}
+	pm.Samples = append(pm.Samples, sample)
+}
+
+// promEscape - escape label value (or help text when help is set)
+func promEscape(s string, help bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if !help {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+// promValue - format sample value
+func promValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// WritePromMetrics - write metrics in Prometheus text exposition format (version 0.0.4)
+// Labels are written sorted by name, so output is stable
+func WritePromMetrics(w io.Writer, metrics []PromMetric) error {
+	for _, metric := range metrics {
+		if len(metric.Samples) == 0 {
+			continue
+		}
+		lines := []string{
+			fmt.Sprintf("# HELP %s %s", metric.Name, promEscape(metric.Help, true)),
+			fmt.Sprintf("# TYPE %s %s", metric.Name, metric.Type),
+		}
+		for _, sample := range metric.Samples {
+			names := []string{}
+			for name := range sample.Labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			labels := []string{}
+			for _, name := range names {
+				labels = append(labels, fmt.Sprintf(`%s="%s"`, name, promEscape(sample.Labels[name], false)))
+			}
+			line := metric.Name
+			if len(labels) > 0 {
+				line += "{" + strings.Join(labels, ",") + "}"
+			}
+			lines = append(lines, line+" "+promValue(sample.Value))
+		}
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// promCollect - call collecting function, fatal errors from library functions are returned as errors
+func promCollect(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return f()
+}
+
+// promTimestamp - convert time into Unix timestamp in seconds (0 for no time)
+func promTimestamp(dt *time.Time) float64 {
+	if dt == nil || dt.IsZero() {
+		return 0
+	}
+	return float64(dt.UnixNano()) / 1e9
+}
+
+// CollectPromMetrics - collect pipeline health metrics of all enabled projects
+// Last GHA event time (project's Postgres database), last series store point time (GHA2DB_LASTSERIES series),
+// last sync steps durations, statuses and failures (`devstats`.`gha_sync_runs`), GitHub API points
+// Sources that cannot be queried are reported by devstats_collect_errors, other metrics are still returned
+func CollectPromMetrics(ctx *Ctx, projects *AllProjects) []PromMetric {
+	lastEvent := PromMetric{Name: "devstats_last_event_timestamp_seconds", Help: "Newest GHA event time in project's database.", Type: "gauge"}
+	lastPoint := PromMetric{Name: "devstats_last_point_timestamp_seconds", Help: "Newest point time of the last series (GHA2DB_LASTSERIES) in project's series store.", Type: "gauge"}
+	stepDuration := PromMetric{Name: "devstats_sync_step_duration_seconds", Help: "Duration of the most recent run of a sync step.", Type: "gauge"}
+	stepStatus := PromMetric{Name: "devstats_sync_step_status", Help: "Status of the most recent run of a sync step (1 for the current status).", Type: "gauge"}
+	stepFinished := PromMetric{Name: "devstats_sync_step_finished_timestamp_seconds", Help: "End time of the most recent run of a sync step.", Type: "gauge"}
+	stepFailures := PromMetric{Name: "devstats_sync_step_failures_total", Help: "Number of failed sync step runs.", Type: "counter"}
+	lastSuccess := PromMetric{Name: "devstats_sync_last_success_timestamp_seconds", Help: "End time of the last successful project sync.", Type: "gauge"}
+	apiLimit := PromMetric{Name: "devstats_github_api_points_limit", Help: "GitHub API points limit.", Type: "gauge"}
+	apiRemaining := PromMetric{Name: "devstats_github_api_points_remaining", Help: "GitHub API points remaining.", Type: "gauge"}
+	apiReset := PromMetric{Name: "devstats_github_api_reset_seconds", Help: "Time left to GitHub API points reset.", Type: "gauge"}
+	collectErrors := PromMetric{Name: "devstats_collect_errors", Help: "Errors collecting metrics from a given source in the last scrape.", Type: "gauge"}
+	reportError := func(source, project string, err error) {
+		Printf("Error collecting %s metrics for '%s': %v\n", source, project, err)
+		collectErrors.Add(1, "source", source, "project", project)
+	}
+
+	names := []string{}
+	for name, proj := range projects.Projects {
+		if !IsProjectDisabled(ctx, name, proj.Disabled) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		proj := projects.Projects[name]
+
+		// Last GHA event
+		err := promCollect(func() error {
+			con := PgConnDB(ctx, proj.PDB)
+			defer func() { _ = con.Close() }()
+			var dt *time.Time
+			err := QueryRowSQL(con, ctx, "select max(created_at) from gha_events").Scan(&dt)
+			if err == nil {
+				lastEvent.Add(promTimestamp(dt), "project", name)
+			}
+			return err
+		})
+		if err != nil {
+			reportError("postgres", name, err)
+		}
+
+		// Last series point
+		err = promCollect(func() error {
+			ictx := *ctx
+			ictx.IDBDB = proj.IDB
+			ictx.PgDB = proj.PDB
+			lastSeries := ctx.LastSeries
+			if series, ok := proj.Env["GHA2DB_LASTSERIES"]; ok {
+				lastSeries = series
+			}
+			store := NewSeriesStore(&ictx)
+			defer func() { _ = store.Close() }()
+			point, err := store.LastPoint(lastSeries)
+			if err != nil {
+				return err
+			}
+			var dt *time.Time
+			if point != nil {
+				dt = &point.Time
+			}
+			lastPoint.Add(promTimestamp(dt), "project", name)
+			return nil
+		})
+		if err != nil {
+			reportError("series_store", name, err)
+		}
+	}
+
+	// Sync runs
+	if !ctx.SkipSyncRuns {
+		err := promCollect(func() error {
+			dctx := *ctx
+			dctx.PgDB = Devstats
+			con := PgConn(&dctx)
+			defer func() { _ = con.Close() }()
+			return collectSyncRunsMetrics(con, &dctx, names, &stepDuration, &stepStatus, &stepFinished, &stepFailures, &lastSuccess)
+		})
+		if err != nil {
+			reportError("sync_runs", "", err)
+		}
+	}
+
+	// GitHub API points
+	err := promCollect(func() error {
+		gctx, gc := GHClient(ctx)
+		_, _, err := gc.RateLimits(gctx)
+		if err != nil {
+			return err
+		}
+		limit, remaining, reset := GetRateLimits(gctx, gc, true)
+		apiLimit.Add(float64(limit))
+		apiRemaining.Add(float64(remaining))
+		apiReset.Add(reset.Seconds())
+		return nil
+	})
+	if err != nil {
+		reportError("github", "", err)
+	}
+	return []PromMetric{
+		lastEvent, lastPoint, stepDuration, stepStatus, stepFinished, stepFailures, lastSuccess,
+		apiLimit, apiRemaining, apiReset, collectErrors,
+	}
+}
+
+// collectSyncRunsMetrics - add sync steps metrics from `gha_sync_runs` table for given projects
+func collectSyncRunsMetrics(con *sql.DB, ctx *Ctx, projects []string, duration, status, finished, failures, success *PromMetric) error {
+	enabled := make(map[string]bool)
+	for _, project := range projects {
+		enabled[project] = true
+	}
+	rows, err := QuerySQL(
+		con,
+		ctx,
+		"select distinct on (proj, step) proj, step, status, started_at, finished_at from gha_sync_runs "+
+			"order by proj, step, finished_at desc",
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var (
+			proj, step, stStatus string
+			start, end           time.Time
+		)
+		err = rows.Scan(&proj, &step, &stStatus, &start, &end)
+		if err != nil {
+			return err
+		}
+		if !enabled[proj] {
+			continue
+		}
+		duration.Add(end.Sub(start).Seconds(), "project", proj, "step", step)
+		finished.Add(promTimestamp(&end), "project", proj, "step", step)
+		for _, st := range []string{SyncStepOK, SyncStepFailed, SyncStepSkipped} {
+			value := 0.0
+			if st == stStatus {
+				value = 1.0
+			}
+			status.Add(value, "project", proj, "step", step, "status", st)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	rows2, err := QuerySQL(
+		con,
+		ctx,
+		"select proj, step, count(*) filter (where status = $1), max(finished_at) filter (where status = $2) "+
+			"from gha_sync_runs group by proj, step order by proj, step",
+		SyncStepFailed,
+		SyncStepOK,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { FatalOnError(rows2.Close()) }()
+	for rows2.Next() {
+		var (
+			proj, step string
+			failed     int64
+			lastOK     *time.Time
+		)
+		err = rows2.Scan(&proj, &step, &failed, &lastOK)
+		if err != nil {
+			return err
+		}
+		if !enabled[proj] {
+			continue
+		}
+		failures.Add(float64(failed), "project", proj, "step", step)
+		if step == SyncRunStep {
+			success.Add(promTimestamp(lastOK), "project", proj)
+		}
+	}
+	return rows2.Err()
+}
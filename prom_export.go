@@ -0,0 +1,336 @@
+package devstats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Prometheus export formats
+const (
+	PromExportRemoteWrite = "remote_write"
+	PromExportOpenMetrics = "openmetrics"
+)
+
+// PromExportPrefix - prefix of all exported metric names
+const PromExportPrefix = "devstats_"
+
+// PromPoint - single timestamped Prometheus sample
+type PromPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// PromTimeSeries - Prometheus time series: labels (metric name is in "__name__" label) and samples
+type PromTimeSeries struct {
+	Labels  map[string]string
+	Samples []PromPoint
+}
+
+// Name - return time series metric name
+func (ts *PromTimeSeries) Name() string {
+	return ts.Labels["__name__"]
+}
+
+// promNameUnsafeRe - characters not allowed in metric and label names
+var promNameUnsafeRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// PromMetricName - map series name to Prometheus metric name
+// Period the series was calculated for (metrics series name suffix like "_h", "_d7", "_anno_1_2") is removed from the metric name:
+// "prs_opened_d7", "d7" -> "devstats_prs_opened"
+func PromMetricName(series, period string) string {
+	name := series
+	if period != "" && len(name) > len(period)+1 {
+		name = strings.TrimSuffix(name, "_"+period)
+	}
+	return PromExportPrefix + promNameUnsafeRe.ReplaceAllString(name, "_")
+}
+
+// promNumber - return numeric field value
+func promNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// promAddTags - add point's tags to labels, tag colliding with existing label (with a different value) is prefixed with "exported_"
+// Tags are added in sorted order, so tags that only differ in characters not allowed in label names are also kept
+func promAddTags(labels map[string]string, tags map[string]string) {
+	for _, tag := range promLabelNames(tags) {
+		value := tags[tag]
+		name := promNameUnsafeRe.ReplaceAllString(tag, "_")
+		for {
+			current, ok := labels[name]
+			if !ok || current == value {
+				break
+			}
+			name = "exported_" + name
+		}
+		labels[name] = value
+	}
+}
+
+// PromSeriesFromPoints - convert series points into Prometheus time series
+// Each numeric field becomes a sample, field other than "value" (multi value rows) is given in "field" label,
+// point's period (metrics only) is given in "period" label, project is set from GHA2DB_PROJECT (if set), point's tags become labels
+// (tags never overwrite these labels, see promAddTags)
+// String fields (like "descr") are skipped, time series and their samples are sorted
+func PromSeriesFromPoints(ctx *Ctx, points []SeriesPoint) []PromTimeSeries {
+	all := make(map[string]*PromTimeSeries)
+	for _, point := range points {
+		name, period := PromMetricName(point.Name, point.Period), point.Period
+		for field, fValue := range point.Fields {
+			value, ok := promNumber(fValue)
+			if !ok {
+				continue
+			}
+			labels := map[string]string{"__name__": name}
+			if period != "" {
+				labels["period"] = period
+			}
+			if field != "value" {
+				labels["field"] = field
+			}
+			if ctx.Project != "" {
+				labels["project"] = ctx.Project
+			}
+			promAddTags(labels, point.Tags)
+			key := promLabelsString(labels)
+			ts, ok := all[key]
+			if !ok {
+				ts = &PromTimeSeries{Labels: labels}
+				all[key] = ts
+			}
+			ts.Samples = append(ts.Samples, PromPoint{Time: point.Time, Value: value})
+		}
+	}
+	series := []PromTimeSeries{}
+	for _, ts := range all {
+		sort.SliceStable(ts.Samples, func(i, j int) bool { return ts.Samples[i].Time.Before(ts.Samples[j].Time) })
+		series = append(series, *ts)
+	}
+	promSortSeries(series)
+	return series
+}
+
+// promSortSeries - sort time series by metric name and then by labels, so all time series of a given metric are together
+// Sorting by labels text only is not enough: "a_b{...}" sorts between "a" and "a{...}"
+func promSortSeries(series []PromTimeSeries) {
+	sort.SliceStable(series, func(i, j int) bool {
+		a, b := series[i].Name(), series[j].Name()
+		if a != b {
+			return a < b
+		}
+		return promLabelsString(series[i].Labels) < promLabelsString(series[j].Labels)
+	})
+}
+
+// promLabelNames - return label names sorted (remote write requires sorted labels)
+func promLabelNames(labels map[string]string) []string {
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// promLabelsString - return labels in text format: metric{label="value",...} ("__name__" is used as metric name)
+func promLabelsString(labels map[string]string) string {
+	items := []string{}
+	for _, name := range promLabelNames(labels) {
+		if name == "__name__" {
+			continue
+		}
+		items = append(items, fmt.Sprintf(`%s="%s"`, name, promEscape(labels[name], false)))
+	}
+	if len(items) == 0 {
+		return labels["__name__"]
+	}
+	return labels["__name__"] + "{" + strings.Join(items, ",") + "}"
+}
+
+// WriteOpenMetrics - write time series in OpenMetrics text format with timestamps (in seconds)
+// All metrics are gauges, time series are grouped by metric name (each metric has a single "# TYPE" line)
+func WriteOpenMetrics(w io.Writer, series []PromTimeSeries) error {
+	sorted := make([]PromTimeSeries, len(series))
+	copy(sorted, series)
+	promSortSeries(sorted)
+	lines := []string{}
+	lastName := ""
+	for _, ts := range sorted {
+		if ts.Name() != lastName {
+			lastName = ts.Name()
+			lines = append(lines, fmt.Sprintf("# TYPE %s gauge", lastName))
+		}
+		labels := promLabelsString(ts.Labels)
+		for _, sample := range ts.Samples {
+			lines = append(lines, fmt.Sprintf("%s %s %d", labels, promValue(sample.Value), sample.Time.Unix()))
+		}
+	}
+	lines = append(lines, "# EOF")
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// promWriteRequest - return snappy compressed Prometheus remote write WriteRequest protobuf message
+func promWriteRequest(series []PromTimeSeries) ([]byte, error) {
+	req := prompb.WriteRequest{Timeseries: make([]prompb.TimeSeries, 0, len(series))}
+	for _, ts := range series {
+		pts := prompb.TimeSeries{}
+		for _, name := range promLabelNames(ts.Labels) {
+			pts.Labels = append(pts.Labels, prompb.Label{Name: name, Value: ts.Labels[name]})
+		}
+		for _, sample := range ts.Samples {
+			pts.Samples = append(pts.Samples, prompb.Sample{Value: sample.Value, Timestamp: sample.Time.UnixNano() / int64(time.Millisecond)})
+		}
+		req.Timeseries = append(req.Timeseries, pts)
+	}
+	data, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+// PromExport - send points to GHA2DB_PROM_EXPORT_URL using GHA2DB_PROM_EXPORT_FORMAT
+// "remote_write": snappy compressed protobuf WriteRequest, "openmetrics": OpenMetrics text with timestamps
+func PromExport(ctx *Ctx, points []SeriesPoint) error {
+	series := PromSeriesFromPoints(ctx, points)
+	if len(series) == 0 {
+		return nil
+	}
+	var (
+		body    []byte
+		headers map[string]string
+	)
+	switch ctx.PromExportFormat {
+	case PromExportRemoteWrite:
+		var err error
+		body, err = promWriteRequest(series)
+		if err != nil {
+			return err
+		}
+		headers = map[string]string{
+			"Content-Type":                      "application/x-protobuf",
+			"Content-Encoding":                  "snappy",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+		}
+	case PromExportOpenMetrics:
+		var buf bytes.Buffer
+		err := WriteOpenMetrics(&buf, series)
+		if err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		headers = map[string]string{"Content-Type": "application/openmetrics-text; version=1.0.0; charset=utf-8"}
+	default:
+		return fmt.Errorf("unknown Prometheus export format '%s'", ctx.PromExportFormat)
+	}
+	req, err := http.NewRequest("POST", ctx.PromExportURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	client := http.Client{Timeout: time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("prometheus export to %s: %s: %s", ctx.PromExportURL, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if ctx.Debug > 0 {
+		Printf("Exported %d time series to %s (%s)\n", len(series), ctx.PromExportURL, ctx.PromExportFormat)
+	}
+	return nil
+}
+
+// PromExportPoints - return points that should be exported at a given time
+// Points older than GHA2DB_PROM_EXPORT_MAX_AGE (historical recalculations) are skipped, because receivers
+// only accept out-of-order samples within a limited window
+func PromExportPoints(ctx *Ctx, points []SeriesPoint, now time.Time) []SeriesPoint {
+	if ctx.PromExportMaxAge <= 0 {
+		return points
+	}
+	from := now.Add(-ctx.PromExportMaxAge)
+	export := []SeriesPoint{}
+	for _, point := range points {
+		if !point.Time.Before(from) {
+			export = append(export, point)
+		}
+	}
+	return export
+}
+
+// PromExportStore - series store that also exports written points to Prometheus compatible storage
+// Export is best effort: its failures are logged and counted, they never fail writing to the underlying store
+type PromExportStore struct {
+	SeriesStore
+	ctx      *Ctx
+	failures int64
+}
+
+// NewPromExportStore - wrap series store, so written points are also exported
+func NewPromExportStore(ctx *Ctx, store SeriesStore) *PromExportStore {
+	return &PromExportStore{SeriesStore: store, ctx: ctx}
+}
+
+// WritePoints - write points to the underlying store, then export them
+func (ps *PromExportStore) WritePoints(points []SeriesPoint) error {
+	err := ps.SeriesStore.WritePoints(points)
+	if err != nil {
+		return err
+	}
+	export := PromExportPoints(ps.ctx, points, time.Now())
+	if ps.ctx.Debug > 0 && len(export) < len(points) {
+		Printf("Skipped exporting %d points older than %v\n", len(points)-len(export), ps.ctx.PromExportMaxAge)
+	}
+	if len(export) == 0 {
+		return nil
+	}
+	err = PromExport(ps.ctx, export)
+	if err != nil {
+		n := atomic.AddInt64(&ps.failures, 1)
+		Printf("Prometheus export of %d points failed (%d failures): %v\n", len(export), n, err)
+	}
+	return nil
+}
+
+// Failures - return number of failed exports
+func (ps *PromExportStore) Failures() int64 {
+	return atomic.LoadInt64(&ps.failures)
+}
+
+// Close - report failed exports and close the underlying store
+func (ps *PromExportStore) Close() error {
+	n := ps.Failures()
+	if n > 0 {
+		Printf("Prometheus export to %s failed %d times\n", ps.ctx.PromExportURL, n)
+	}
+	return ps.SeriesStore.Close()
+}
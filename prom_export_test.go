@@ -0,0 +1,374 @@
+package devstats
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestPromMetricName(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		series, period, name string
+	}{
+		{series: "events_h", period: "h", name: "devstats_events"},
+		{series: "prs_opened_d7", period: "d7", name: "devstats_prs_opened"},
+		{series: "sig_mentions_q", period: "q", name: "devstats_sig_mentions"},
+		{series: "hist_approvers_anno_1_2", period: "anno_1_2", name: "devstats_hist_approvers"},
+		{series: "hist_approvers_anno_3_now", period: "anno_3_now", name: "devstats_hist_approvers"},
+		{series: "hist_approvers", period: "d7", name: "devstats_hist_approvers"},
+		{series: "events", period: "h", name: "devstats_events"},
+		{series: "quick_ranges", name: "devstats_quick_ranges"},
+		{series: "annotations", name: "devstats_annotations"},
+		{series: "prs_opened_d7", name: "devstats_prs_opened_d7"},
+		{series: "h", name: "devstats_h"},
+		{series: "_h", period: "h", name: "devstats__h"},
+		{series: "open-issues-sig_w2", period: "w2", name: "devstats_open_issues_sig"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		name := lib.PromMetricName(test.series, test.period)
+		if name != test.name {
+			t.Errorf("test number %d, expected %s, got %s", index+1, test.name, name)
+		}
+	}
+}
+
+// promTestPoints - points like the ones written by db2influx (single and multi value rows) and annotations
+func promTestPoints() []lib.SeriesPoint {
+	dt := testlib.YMDHMS(2018, 2, 3, 0, 0, 0)
+	return []lib.SeriesPoint{
+		{Name: "prs_opened_d", Fields: map[string]interface{}{"value": 3.0}, Time: dt.AddDate(0, 0, 1), Period: "d"},
+		{Name: "prs_opened_d", Fields: map[string]interface{}{"value": 2.0}, Time: dt, Period: "d"},
+		{Name: "sig_mentions_w", Fields: map[string]interface{}{"sig-apps": 1.5, "sig-node": 4.0, "descr": "x"}, Time: dt, Period: "w"},
+		{Name: "annotations", Fields: map[string]interface{}{"title": "v1.9", "description": "release"}, Time: dt},
+		{Name: "quick_ranges", Tags: map[string]string{"quick_ranges_suffix": "d"}, Fields: map[string]interface{}{"value": 0.0}, Time: dt},
+	}
+}
+
+func TestPromSeriesFromPoints(t *testing.T) {
+	ctx := lib.Ctx{Project: "kubernetes"}
+	got := lib.PromSeriesFromPoints(&ctx, promTestPoints())
+	var buf bytes.Buffer
+	err := lib.WriteOpenMetrics(&buf, got)
+	expected := "# TYPE devstats_prs_opened gauge\n" +
+		"devstats_prs_opened{period=\"d\",project=\"kubernetes\"} 2 1517616000\n" +
+		"devstats_prs_opened{period=\"d\",project=\"kubernetes\"} 3 1517702400\n" +
+		"# TYPE devstats_quick_ranges gauge\n" +
+		"devstats_quick_ranges{project=\"kubernetes\",quick_ranges_suffix=\"d\"} 0 1517616000\n" +
+		"# TYPE devstats_sig_mentions gauge\n" +
+		"devstats_sig_mentions{field=\"sig-apps\",period=\"w\",project=\"kubernetes\"} 1.5 1517616000\n" +
+		"devstats_sig_mentions{field=\"sig-node\",period=\"w\",project=\"kubernetes\"} 4 1517616000\n" +
+		"# EOF\n"
+	if err != nil || buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s\nerror: %v", expected, buf.String(), err)
+	}
+}
+
+func TestPromSeriesLabels(t *testing.T) {
+	dt := testlib.YMDHMS(2018, 2, 3)
+	// Test cases
+	var testCases = []struct {
+		point    lib.SeriesPoint
+		expected []map[string]string
+	}{
+		{
+			point:    lib.SeriesPoint{Name: "events_h", Fields: map[string]interface{}{"value": 1.0}, Period: "h"},
+			expected: []map[string]string{{"__name__": "devstats_events", "period": "h", "project": "kubernetes"}},
+		},
+		{
+			point: lib.SeriesPoint{
+				Name:   "issues",
+				Tags:   map[string]string{"repo_group": "Apps", "period": "d7"},
+				Fields: map[string]interface{}{"value": 1.0},
+				Period: "d7",
+			},
+			expected: []map[string]string{{"__name__": "devstats_issues", "period": "d7", "project": "kubernetes", "repo_group": "Apps"}},
+		},
+		{
+			point: lib.SeriesPoint{
+				Name:   "issues",
+				Tags:   map[string]string{"project": "other", "period": "m", "field": "x"},
+				Fields: map[string]interface{}{"value": 1.0},
+				Period: "d",
+			},
+			expected: []map[string]string{
+				{"__name__": "devstats_issues", "period": "d", "project": "kubernetes", "field": "x", "exported_period": "m", "exported_project": "other"},
+			},
+		},
+		{
+			point: lib.SeriesPoint{
+				Name:   "issues",
+				Tags:   map[string]string{"field": "x", "exported_field": "y"},
+				Fields: map[string]interface{}{"opened": 1.0},
+			},
+			expected: []map[string]string{
+				{"__name__": "devstats_issues", "project": "kubernetes", "field": "opened", "exported_field": "y", "exported_exported_field": "x"},
+			},
+		},
+		{
+			point: lib.SeriesPoint{
+				Name:   "issues",
+				Tags:   map[string]string{"sig-name": "apps", "sig_name": "node"},
+				Fields: map[string]interface{}{"value": 1.0},
+			},
+			expected: []map[string]string{
+				{"__name__": "devstats_issues", "project": "kubernetes", "sig_name": "apps", "exported_sig_name": "node"},
+			},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx := lib.Ctx{Project: "kubernetes"}
+		test.point.Time = dt
+		got := []map[string]string{}
+		for _, ts := range lib.PromSeriesFromPoints(&ctx, []lib.SeriesPoint{test.point}) {
+			got = append(got, ts.Labels)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	dt := testlib.YMDHMS(2018, 2, 3)
+	sample := []lib.PromPoint{{Time: dt, Value: 1}}
+	// Series sorted by labels text, metric "devstats_a" is split by "devstats_a_b"
+	series := []lib.PromTimeSeries{
+		{Labels: map[string]string{"__name__": "devstats_a"}, Samples: sample},
+		{Labels: map[string]string{"__name__": "devstats_a_b", "period": "d"}, Samples: sample},
+		{Labels: map[string]string{"__name__": "devstats_a", "period": "d"}, Samples: sample},
+	}
+	var buf bytes.Buffer
+	err := lib.WriteOpenMetrics(&buf, series)
+	expected := "# TYPE devstats_a gauge\n" +
+		"devstats_a 1 1517616000\n" +
+		"devstats_a{period=\"d\"} 1 1517616000\n" +
+		"# TYPE devstats_a_b gauge\n" +
+		"devstats_a_b{period=\"d\"} 1 1517616000\n" +
+		"# EOF\n"
+	if err != nil || buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s\nerror: %v", expected, buf.String(), err)
+	}
+	// Input is not modified
+	if series[1].Name() != "devstats_a_b" {
+		t.Errorf("input series were reordered: %+v", series)
+	}
+	// Time series returned by PromSeriesFromPoints are grouped by metric name too
+	points := []lib.SeriesPoint{
+		{Name: "a", Fields: map[string]interface{}{"value": 1.0}, Time: dt},
+		{Name: "a_b", Tags: map[string]string{"period": "d"}, Fields: map[string]interface{}{"value": 1.0}, Time: dt},
+		{Name: "a", Tags: map[string]string{"period": "d"}, Fields: map[string]interface{}{"value": 1.0}, Time: dt},
+	}
+	names := []string{}
+	for _, ts := range lib.PromSeriesFromPoints(&lib.Ctx{}, points) {
+		names = append(names, ts.Name())
+	}
+	if !testlib.CompareStringSlices(names, []string{"devstats_a", "devstats_a", "devstats_a_b"}) {
+		t.Errorf("expected time series grouped by metric name, got %v", names)
+	}
+}
+
+// promDecodeWriteRequest - decode remote write request body using Prometheus libraries
+func promDecodeWriteRequest(t *testing.T, body []byte) (series []lib.PromTimeSeries, size int) {
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("remote write body: %v", err)
+	}
+	var req prompb.WriteRequest
+	err = req.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("remote write body: %v", err)
+	}
+	for _, ts := range req.Timeseries {
+		pts := lib.PromTimeSeries{Labels: make(map[string]string)}
+		for i, label := range ts.Labels {
+			if i > 0 && ts.Labels[i-1].Name >= label.Name {
+				t.Errorf("remote write labels are not sorted: %+v", ts.Labels)
+			}
+			pts.Labels[label.Name] = label.Value
+		}
+		for _, sample := range ts.Samples {
+			pts.Samples = append(pts.Samples, lib.PromPoint{Time: time.Unix(0, sample.Timestamp*int64(time.Millisecond)).UTC(), Value: sample.Value})
+		}
+		series = append(series, pts)
+	}
+	return series, len(data)
+}
+
+func TestPromExport(t *testing.T) {
+	// Stub receiver, remembers last request
+	var (
+		headers http.Header
+		body    []byte
+		status  = http.StatusNoContent
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	// Remote write
+	ctx := lib.Ctx{PromExportURL: receiver.URL, PromExportFormat: lib.PromExportRemoteWrite}
+	err := lib.PromExport(&ctx, promTestPoints())
+	if err != nil {
+		t.Fatalf("remote write: %v", err)
+	}
+	if headers.Get("Content-Encoding") != "snappy" || headers.Get("Content-Type") != "application/x-protobuf" {
+		t.Errorf("unexpected remote write headers %+v", headers)
+	}
+	got, _ := promDecodeWriteRequest(t, body)
+	expected := lib.PromSeriesFromPoints(&ctx, promTestPoints())
+	if len(got) != 4 || !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+
+	// Remote write body is compressed
+	points := []lib.SeriesPoint{}
+	for h := 0; h < 1000; h++ {
+		points = append(points, lib.SeriesPoint{Name: "events_h", Fields: map[string]interface{}{"value": 1.0}, Time: testlib.YMDHMS(2018, 1, 1).Add(time.Duration(h) * time.Hour)})
+	}
+	err = lib.PromExport(&ctx, points)
+	if err != nil {
+		t.Fatalf("remote write: %v", err)
+	}
+	got, size := promDecodeWriteRequest(t, body)
+	if len(got) != 1 || len(got[0].Samples) != 1000 || len(body) >= size/2 {
+		t.Errorf("expected 1 time series with 1000 samples compressed, got %d time series, %d bytes compressed to %d", len(got), size, len(body))
+	}
+
+	// OpenMetrics
+	ctx.PromExportFormat = lib.PromExportOpenMetrics
+	err = lib.PromExport(&ctx, promTestPoints())
+	if err != nil {
+		t.Fatalf("openmetrics: %v", err)
+	}
+	if !strings.HasPrefix(headers.Get("Content-Type"), "application/openmetrics-text") ||
+		!strings.HasPrefix(string(body), "# TYPE devstats_prs_opened gauge\n") || !strings.HasSuffix(string(body), "# EOF\n") {
+		t.Errorf("unexpected openmetrics request %+v:\n%s", headers, body)
+	}
+
+	// Nothing to export
+	body = nil
+	err = lib.PromExport(&ctx, promTestPoints()[3:4])
+	if err != nil || body != nil {
+		t.Errorf("expected no request, got %s, error: %v", body, err)
+	}
+
+	// Receiver errors
+	status = http.StatusBadRequest
+	err = lib.PromExport(&ctx, promTestPoints())
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected 400 error, got %v", err)
+	}
+	ctx.PromExportFormat = "unknown"
+	err = lib.PromExport(&ctx, promTestPoints())
+	if err == nil {
+		t.Errorf("expected unknown format error")
+	}
+}
+
+func TestPromExportPoints(t *testing.T) {
+	now := testlib.YMDHMS(2018, 2, 10, 12)
+	points := []lib.SeriesPoint{
+		{Name: "events_h", Fields: map[string]interface{}{"value": 1.0}, Time: now.Add(-time.Hour)},
+		{Name: "events_h", Fields: map[string]interface{}{"value": 2.0}, Time: now.Add(-48 * time.Hour)},
+		{Name: "events_y", Fields: map[string]interface{}{"value": 3.0}, Time: testlib.YMDHMS(2018)},
+	}
+	// Test cases
+	var testCases = []struct {
+		maxAge   time.Duration
+		expected []float64
+	}{
+		{maxAge: 0, expected: []float64{1, 2, 3}},
+		{maxAge: 2 * time.Hour, expected: []float64{1}},
+		{maxAge: 48 * time.Hour, expected: []float64{1, 2}},
+		{maxAge: time.Minute, expected: []float64{}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx := lib.Ctx{PromExportMaxAge: test.maxAge}
+		got := []float64{}
+		for _, point := range lib.PromExportPoints(&ctx, points, now) {
+			got = append(got, point.Fields["value"].(float64))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+// promTestStore - series store that only remembers written points
+type promTestStore struct {
+	lib.SeriesStore
+	points []lib.SeriesPoint
+	closed bool
+}
+
+func (s *promTestStore) WritePoints(points []lib.SeriesPoint) error {
+	s.points = append(s.points, points...)
+	return nil
+}
+
+func (s *promTestStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestPromExportStore(t *testing.T) {
+	// Stub receiver, counts requests
+	var (
+		requests int
+		status   = http.StatusNoContent
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+	ctx := lib.Ctx{
+		PromExportURL:    receiver.URL,
+		PromExportFormat: lib.PromExportRemoteWrite,
+		PromExportMaxAge: time.Hour,
+	}
+	backend := &promTestStore{}
+	store := lib.NewPromExportStore(&ctx, backend)
+	recent := []lib.SeriesPoint{{Name: "events_h", Fields: map[string]interface{}{"value": 1.0}, Time: time.Now()}}
+
+	// Historical points are only written to the underlying store
+	err := store.WritePoints(promTestPoints())
+	if err != nil || requests != 0 || len(backend.points) != 5 {
+		t.Errorf("expected 5 points written and not exported, got %d points, %d requests, error: %v", len(backend.points), requests, err)
+	}
+
+	// Recent points are exported
+	err = store.WritePoints(recent)
+	if err != nil || requests != 1 || store.Failures() != 0 {
+		t.Errorf("expected 1 export request, got %d, failures %d, error: %v", requests, store.Failures(), err)
+	}
+
+	// Export errors are counted, but they don't fail the write
+	status = http.StatusBadRequest
+	err = store.WritePoints(recent)
+	if err != nil || requests != 2 || store.Failures() != 1 || len(backend.points) != 7 {
+		t.Errorf("expected failed export not to fail the write, got %d requests, failures %d, error: %v", requests, store.Failures(), err)
+	}
+	err = store.Close()
+	if err != nil || !backend.closed {
+		t.Errorf("expected underlying store to be closed, error: %v", err)
+	}
+}
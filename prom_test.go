@@ -0,0 +1,96 @@
+package devstats
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestWritePromMetrics(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		metrics  []lib.PromMetric
+		expected string
+	}{
+		{metrics: []lib.PromMetric{}, expected: ""},
+		{
+			metrics:  []lib.PromMetric{{Name: "empty", Help: "No samples.", Type: "gauge"}},
+			expected: "",
+		},
+		{
+			metrics: []lib.PromMetric{
+				{
+					Name: "devstats_github_api_points_remaining",
+					Help: "GitHub API points remaining.",
+					Type: "gauge",
+					Samples: []lib.PromSample{
+						{Labels: map[string]string{}, Value: 4321},
+					},
+				},
+			},
+			expected: "# HELP devstats_github_api_points_remaining GitHub API points remaining.\n" +
+				"# TYPE devstats_github_api_points_remaining gauge\n" +
+				"devstats_github_api_points_remaining 4321\n",
+		},
+		{
+			metrics: []lib.PromMetric{
+				{
+					Name: "devstats_sync_step_duration_seconds",
+					Help: "Step\nduration \\ seconds.",
+					Type: "gauge",
+					Samples: []lib.PromSample{
+						{Labels: map[string]string{"step": "gha2db", "project": "kubernetes"}, Value: 12.5},
+						{Labels: map[string]string{"project": `a"b\c`, "step": "x"}, Value: math.Inf(1)},
+					},
+				},
+				{
+					Name: "devstats_sync_step_failures_total",
+					Help: "Failures.",
+					Type: "counter",
+					Samples: []lib.PromSample{
+						{Labels: map[string]string{"project": "cni"}, Value: 1e21},
+						{Labels: map[string]string{"project": "envoy"}, Value: math.NaN()},
+					},
+				},
+			},
+			expected: "# HELP devstats_sync_step_duration_seconds Step\\nduration \\\\ seconds.\n" +
+				"# TYPE devstats_sync_step_duration_seconds gauge\n" +
+				"devstats_sync_step_duration_seconds{project=\"kubernetes\",step=\"gha2db\"} 12.5\n" +
+				"devstats_sync_step_duration_seconds{project=\"a\\\"b\\\\c\",step=\"x\"} +Inf\n" +
+				"# HELP devstats_sync_step_failures_total Failures.\n" +
+				"# TYPE devstats_sync_step_failures_total counter\n" +
+				"devstats_sync_step_failures_total{project=\"cni\"} 1e+21\n" +
+				"devstats_sync_step_failures_total{project=\"envoy\"} NaN\n",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var buf bytes.Buffer
+		err := lib.WritePromMetrics(&buf, test.metrics)
+		got := buf.String()
+		if err != nil || got != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s\nerror: %v", index+1, test.expected, got, err)
+		}
+	}
+}
+
+func TestPromMetricAdd(t *testing.T) {
+	metric := lib.PromMetric{Name: "m", Help: "h", Type: "gauge"}
+	metric.Add(1)
+	metric.Add(2, "project", "kubernetes", "step")
+	metric.Add(3, "project", "cni", "step", "metrics")
+	if len(metric.Samples) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", metric.Samples)
+	}
+	if len(metric.Samples[0].Labels) != 0 || metric.Samples[0].Value != 1 {
+		t.Errorf("unexpected sample %+v", metric.Samples[0])
+	}
+	if len(metric.Samples[1].Labels) != 1 || metric.Samples[1].Labels["project"] != "kubernetes" {
+		t.Errorf("unexpected sample %+v", metric.Samples[1])
+	}
+	if len(metric.Samples[2].Labels) != 2 || metric.Samples[2].Labels["step"] != "metrics" || metric.Samples[2].Value != 3 {
+		t.Errorf("unexpected sample %+v", metric.Samples[2])
+	}
+}
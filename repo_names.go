@@ -0,0 +1,98 @@
+package devstats
+
+import (
+	"database/sql"
+	"time"
+)
+
+// RepoName - repository ID and one of its names
+type RepoName struct {
+	ID   int
+	Name string
+}
+
+// RepoNameSeen - first and last time when given repository ID was seen with a given name
+type RepoNameSeen struct {
+	First time.Time
+	Last  time.Time
+}
+
+// RepoNames - repository ID -> name history collected from GHA events
+type RepoNames map[RepoName]RepoNameSeen
+
+// Add - record that event for repository ID with given name was created at dt
+func (rn RepoNames) Add(id int, name string, dt time.Time) {
+	if id == 0 || name == "" {
+		return
+	}
+	key := RepoName{ID: id, Name: name}
+	seen, ok := rn[key]
+	if !ok {
+		rn[key] = RepoNameSeen{First: dt, Last: dt}
+		return
+	}
+	if dt.Before(seen.First) {
+		seen.First = dt
+	}
+	if dt.After(seen.Last) {
+		seen.Last = dt
+	}
+	rn[key] = seen
+}
+
+// Save - merge collected history into gha_repo_names table and clear it
+func (rn RepoNames) Save(con *sql.DB, ctx *Ctx) {
+	for key, seen := range rn {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			"insert into gha_repo_names(repo_id, name, first_seen, last_seen) "+NValues(4)+
+				" on conflict(repo_id, name) do update set "+
+				"first_seen = least(gha_repo_names.first_seen, excluded.first_seen), "+
+				"last_seen = greatest(gha_repo_names.last_seen, excluded.last_seen)",
+			AnyArray{key.ID, key.Name, seen.First, seen.Last}...,
+		)
+		delete(rn, key)
+	}
+}
+
+// RepoIDsMatching - return IDs of all known repositories (from gha_repo_names and gha_repos)
+// that have at least one name matching org/repo criteria (see RepoHit)
+func RepoIDsMatching(con *sql.DB, ctx *Ctx, forg, frepo map[string]struct{}) map[int]struct{} {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select repo_id, name from gha_repo_names union select id, name from gha_repos",
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	ids := make(map[int]struct{})
+	var (
+		id   int
+		name string
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&id, &name))
+		if id > 0 && RepoHit(ctx, name, forg, frepo) {
+			ids[id] = struct{}{}
+		}
+	}
+	FatalOnError(rows.Err())
+	return ids
+}
+
+// RepoIDHit - are we interested in this repo, it is when repository ID is one of repoIDs
+// (so renamed or transferred repository is matched by any of its names), otherwise see RepoHit
+// Exclusions (GHA2DB_EXCLUDE_REPOS and "!" items in org list) are checked first and always win
+// repoIDs only contains repositories already known in the database (see RepoIDsMatching), so on a fresh
+// import events with old names are only matched by the second pass, after events with new names were imported
+func RepoIDHit(ctx *Ctx, repoID int, fullName string, forg, frepo map[string]struct{}, repoIDs map[int]struct{}) bool {
+	if fullName == "" || RepoExcluded(ctx, fullName, forg) {
+		return false
+	}
+	if repoID > 0 {
+		if _, ok := repoIDs[repoID]; ok {
+			return true
+		}
+	}
+	return RepoHit(ctx, fullName, forg, frepo)
+}
@@ -0,0 +1,128 @@
+package devstats
+
+import (
+	"testing"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestRepoNamesAdd(t *testing.T) {
+	ft := testlib.YMDHMS
+	names := lib.RepoNames{}
+	names.Add(1, "kubernetes-incubator/kubespray", ft(2017, 5, 1))
+	names.Add(1, "kubernetes-incubator/kubespray", ft(2017, 3, 1))
+	names.Add(1, "kubernetes-incubator/kubespray", ft(2017, 4, 1))
+	names.Add(1, "kubernetes-sigs/kubespray", ft(2018, 9, 1))
+	names.Add(2, "kubernetes/kubernetes", ft(2018, 1, 1))
+	names.Add(0, "no/id", ft(2018, 1, 1))
+	names.Add(3, "", ft(2018, 1, 1))
+
+	// Test cases
+	var testCases = []struct {
+		key      lib.RepoName
+		expected lib.RepoNameSeen
+	}{
+		{
+			key:      lib.RepoName{ID: 1, Name: "kubernetes-incubator/kubespray"},
+			expected: lib.RepoNameSeen{First: ft(2017, 3, 1), Last: ft(2017, 5, 1)},
+		},
+		{
+			key:      lib.RepoName{ID: 1, Name: "kubernetes-sigs/kubespray"},
+			expected: lib.RepoNameSeen{First: ft(2018, 9, 1), Last: ft(2018, 9, 1)},
+		},
+		{
+			key:      lib.RepoName{ID: 2, Name: "kubernetes/kubernetes"},
+			expected: lib.RepoNameSeen{First: ft(2018, 1, 1), Last: ft(2018, 1, 1)},
+		},
+	}
+	if len(names) != len(testCases) {
+		t.Errorf("expected %d names, got %d: %+v", len(testCases), len(names), names)
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got, ok := names[test.key]
+		if !ok || got != test.expected {
+			t.Errorf("test number %d, expected %+v, got %+v (present: %v)", index+1, test.expected, got, ok)
+		}
+	}
+}
+
+func TestRepoIDHit(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		repoID   int
+		fullName string
+		forg     map[string]struct{}
+		repoIDs  map[int]struct{}
+		exclude  map[string]bool
+		hit      bool
+	}{
+		{
+			repoID:   1,
+			fullName: "kubernetes-incubator/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+			hit:      true,
+		},
+		{
+			repoID:   1,
+			fullName: "kubernetes-incubator/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+		},
+		{
+			repoID:   2,
+			fullName: "kubernetes-incubator/kube-aws",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+		},
+		{
+			repoID:   2,
+			fullName: "kubernetes-sigs/kind",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+			hit:      true,
+		},
+		{
+			repoID:   0,
+			fullName: "kubernetes",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{0: {}},
+		},
+		{
+			repoID:   1,
+			fullName: "kubernetes-incubator/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+			exclude:  map[string]bool{"kubernetes-incubator/kubespray": true},
+		},
+		{
+			repoID:   1,
+			fullName: "kubernetes-incubator/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+			exclude:  map[string]bool{"kubernetes-incubator/*": true},
+		},
+		{
+			repoID:   1,
+			fullName: "kubernetes-incubator/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}, "!kubernetes-incubator/kubespray": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+		},
+		{
+			repoID:   1,
+			fullName: "kubernetes-sigs/kubespray",
+			forg:     map[string]struct{}{"kubernetes-sigs": {}, "!kubernetes-incubator/kubespray": {}},
+			repoIDs:  map[int]struct{}{1: {}},
+			hit:      true,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx := lib.Ctx{ExcludeRepos: test.exclude}
+		got := lib.RepoIDHit(&ctx, test.repoID, test.fullName, test.forg, map[string]struct{}{}, test.repoIDs)
+		if got != test.hit {
+			t.Errorf("test number %d, expected %v, got %v, test case: %+v", index+1, test.hit, got, test)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package devstats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule - cron-like schedule: "minute hour day-of-month month day-of-week"
+// Fields support "*", "a", "a-b", lists "a,b" and steps "*/n", "a-b/n", day of week 0-7 (0 and 7 is Sunday)
+// Descriptors "@hourly", "@daily", "@weekly" and "@monthly" are also supported
+// Like in cron, when both day of month and day of week are restricted, time matches when either of them matches
+type Schedule struct {
+	Expr    string
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+// Schedule descriptors
+var scheduleDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseScheduleField - parse single schedule field into bitset of allowed values (min - max)
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	bits := uint64(0)
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rng = part[:i]
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+		}
+		from, to := min, max
+		if rng != "*" {
+			ary := strings.Split(rng, "-")
+			if len(ary) > 2 {
+				return 0, fmt.Errorf("invalid range '%s'", part)
+			}
+			var err error
+			from, err = strconv.Atoi(ary[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in '%s'", part)
+			}
+			to = from
+			if len(ary) == 2 {
+				to, err = strconv.Atoi(ary[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in '%s'", part)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// ParseSchedule - parse cron-like schedule expression
+func ParseSchedule(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if desc, ok := scheduleDescriptors[spec]; ok {
+		spec = desc
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule '%s': expected 5 fields, got %d", expr, len(fields))
+	}
+	s := Schedule{Expr: expr, domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	ranges := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	targets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		bits, err := parseScheduleField(field, ranges[i][0], ranges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule '%s': %v", expr, err)
+		}
+		*targets[i] = bits
+	}
+	// Sunday can be given as 0 or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return &s, nil
+}
+
+// dayMatches - check if day matches day of month and day of week fields
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// Matches - check if a given time (minute precision) matches schedule
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.month&(1<<uint(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+// Next - return first time matching schedule that is after a given time (in given time's location)
+// Returns zero time if there is no such time in the next 5 years (like "0 0 30 2 *")
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// DaemonJob - devstats daemon job: sync given projects (all enabled when empty) on a schedule
+// Steps - only run these gha2db_sync steps (all when empty), Env - additional gha2db_sync environment
+// GetRepos - update all projects git repos before sync
+type DaemonJob struct {
+	Name     string            `yaml:"name"`
+	Cron     string            `yaml:"cron"`
+	Projects []string          `yaml:"projects"`
+	Steps    []string          `yaml:"steps"`
+	Env      map[string]string `yaml:"env"`
+	GetRepos bool              `yaml:"get_repos"`
+	Schedule *Schedule         `yaml:"-"`
+}
+
+// DaemonConfig - devstats daemon jobs (from GHA2DB_DAEMON_YAML)
+type DaemonConfig struct {
+	Jobs []DaemonJob `yaml:"jobs"`
+}
+
+// Prepare - check jobs (names must be unique and not empty) and parse their schedules
+func (dc *DaemonConfig) Prepare() error {
+	names := make(map[string]bool)
+	for i := range dc.Jobs {
+		job := &dc.Jobs[i]
+		if job.Name == "" || names[job.Name] {
+			return fmt.Errorf("job #%d: name '%s' is empty or not unique", i+1, job.Name)
+		}
+		names[job.Name] = true
+		schedule, err := ParseSchedule(job.Cron)
+		if err != nil {
+			return fmt.Errorf("job '%s': %v", job.Name, err)
+		}
+		job.Schedule = schedule
+	}
+	return nil
+}
+
+// Job - return job with a given name or nil
+func (dc *DaemonConfig) Job(name string) *DaemonJob {
+	for i := range dc.Jobs {
+		if dc.Jobs[i].Name == name {
+			return &dc.Jobs[i]
+		}
+	}
+	return nil
+}
+
+// SyncEnv - gha2db_sync environment for a job: job's env and GHA2DB_SYNC_STEPS (when job has steps)
+func (job *DaemonJob) SyncEnv() map[string]string {
+	env := make(map[string]string)
+	for name, value := range job.Env {
+		env[name] = value
+	}
+	if len(job.Steps) > 0 {
+		env["GHA2DB_SYNC_STEPS"] = strings.Join(job.Steps, ",")
+	}
+	return env
+}
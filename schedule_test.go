@@ -0,0 +1,127 @@
+package devstats
+
+import (
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		expr string
+		err  bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "8 * * * *"},
+		{expr: "*/15 0-6,18 1,15 */2 1-5"},
+		{expr: "5/10 * * * 7"},
+		{expr: "@hourly"},
+		{expr: " @weekly "},
+		{expr: "", err: true},
+		{expr: "* * * *", err: true},
+		{expr: "* * * * * *", err: true},
+		{expr: "60 * * * *", err: true},
+		{expr: "* 24 * * *", err: true},
+		{expr: "* * 0 * *", err: true},
+		{expr: "* * * 13 *", err: true},
+		{expr: "* * * * 8", err: true},
+		{expr: "5-1 * * * *", err: true},
+		{expr: "*/0 * * * *", err: true},
+		{expr: "a * * * *", err: true},
+		{expr: "1-2-3 * * * *", err: true},
+		{expr: "@yearly", err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		_, err := lib.ParseSchedule(test.expr)
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %v", index+1, test.err, err)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{expr: "* * * * *", after: testlib.YMDHMS(2018, 2, 3, 4, 5, 6), expected: testlib.YMDHMS(2018, 2, 3, 4, 6, 0)},
+		{expr: "8 * * * *", after: testlib.YMDHMS(2018, 2, 3, 4, 5, 6), expected: testlib.YMDHMS(2018, 2, 3, 4, 8, 0)},
+		{expr: "8 * * * *", after: testlib.YMDHMS(2018, 2, 3, 4, 8, 0), expected: testlib.YMDHMS(2018, 2, 3, 5, 8, 0)},
+		{expr: "@hourly", after: testlib.YMDHMS(2018, 12, 31, 23, 0, 0), expected: testlib.YMDHMS(2019, 1, 1, 0, 0, 0)},
+		{expr: "38 0 * * *", after: testlib.YMDHMS(2018, 2, 28, 1, 0, 0), expected: testlib.YMDHMS(2018, 3, 1, 0, 38, 0)},
+		// 2018-02-03 is Saturday
+		{expr: "0 3 * * 6", after: testlib.YMDHMS(2018, 2, 3, 3, 0, 0), expected: testlib.YMDHMS(2018, 2, 10, 3, 0, 0)},
+		{expr: "@weekly", after: testlib.YMDHMS(2018, 2, 3, 3, 0, 0), expected: testlib.YMDHMS(2018, 2, 4, 0, 0, 0)},
+		{expr: "0 0 * * 7", after: testlib.YMDHMS(2018, 2, 3, 3, 0, 0), expected: testlib.YMDHMS(2018, 2, 4, 0, 0, 0)},
+		{expr: "*/20 9-17 * * 1-5", after: testlib.YMDHMS(2018, 2, 2, 17, 40, 0), expected: testlib.YMDHMS(2018, 2, 5, 9, 0, 0)},
+		// Day of month or day of week (Monday), both are restricted
+		{expr: "0 12 15 * 1", after: testlib.YMDHMS(2018, 2, 3, 0, 0, 0), expected: testlib.YMDHMS(2018, 2, 5, 12, 0, 0)},
+		{expr: "0 12 15 * 1", after: testlib.YMDHMS(2018, 2, 12, 12, 0, 0), expected: testlib.YMDHMS(2018, 2, 15, 12, 0, 0)},
+		{expr: "@monthly", after: testlib.YMDHMS(2018, 2, 3, 0, 0, 0), expected: testlib.YMDHMS(2018, 3, 1, 0, 0, 0)},
+		{expr: "0 0 29 2 *", after: testlib.YMDHMS(2018, 2, 3, 0, 0, 0), expected: testlib.YMDHMS(2020, 2, 29, 0, 0, 0)},
+		{expr: "0 0 30 2 *", after: testlib.YMDHMS(2018, 2, 3, 0, 0, 0), expected: time.Time{}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		schedule, err := lib.ParseSchedule(test.expr)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error %v", index+1, err)
+			continue
+		}
+		got := schedule.Next(test.after)
+		if !got.Equal(test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+		if !got.IsZero() && !schedule.Matches(got) {
+			t.Errorf("test number %d, %v should match '%s'", index+1, got, test.expr)
+		}
+	}
+}
+
+func TestDaemonConfig(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		jobs []lib.DaemonJob
+		err  bool
+	}{
+		{jobs: []lib.DaemonJob{}},
+		{jobs: []lib.DaemonJob{{Name: "hourly", Cron: "8 * * * *"}, {Name: "daily", Cron: "@daily"}}},
+		{jobs: []lib.DaemonJob{{Name: "hourly", Cron: "8 * * * *"}, {Name: "hourly", Cron: "@daily"}}, err: true},
+		{jobs: []lib.DaemonJob{{Cron: "8 * * * *"}}, err: true},
+		{jobs: []lib.DaemonJob{{Name: "bad", Cron: "8 * *"}}, err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		config := lib.DaemonConfig{Jobs: test.jobs}
+		err := config.Prepare()
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %v", index+1, test.err, err)
+			continue
+		}
+		if err == nil {
+			for _, job := range config.Jobs {
+				if job.Schedule == nil || config.Job(job.Name) == nil {
+					t.Errorf("test number %d, job %s not prepared", index+1, job.Name)
+				}
+			}
+		}
+	}
+	// Job environment
+	job := lib.DaemonJob{Name: "daily", Steps: []string{"idb_tags", "annotations"}, Env: map[string]string{"GHA2DB_SYNC_DAILY": "1"}}
+	env := job.SyncEnv()
+	if len(env) != 2 || env["GHA2DB_SYNC_STEPS"] != "idb_tags,annotations" || env["GHA2DB_SYNC_DAILY"] != "1" {
+		t.Errorf("unexpected job environment %+v", env)
+	}
+	if len(job.Env) != 1 {
+		t.Errorf("job environment should not be modified, got %+v", job.Env)
+	}
+	if len((&lib.DaemonJob{}).SyncEnv()) != 0 {
+		t.Errorf("expected empty environment")
+	}
+}
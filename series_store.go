@@ -0,0 +1,272 @@
+package devstats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	client "github.com/influxdata/influxdb/client/v2"
+	"github.com/influxdata/influxdb/models"
+)
+
+// SeriesPoint - single time series point: series name, tags, fields (values) and time
+// Period is set for metrics points (CalcMetricData.Period), it is not stored in the series store, only exported (see PromExportStore)
+type SeriesPoint struct {
+	Name   string
+	Tags   map[string]string
+	Fields map[string]interface{}
+	Time   time.Time
+	Period string
+}
+
+// SeriesStore - time series backend used by db2influx, z2influx, idb_tags, idb_vars, annotations and gha2db_sync
+// Backend is selected by GHA2DB_SERIES_STORE, see NewSeriesStore
+type SeriesStore interface {
+	// WritePoints - write points (backend can split them into multiple batches)
+	WritePoints(points []SeriesPoint) error
+	// LastPoint - return the newest point of a series or nil when series has no points
+	LastPoint(series string) (*SeriesPoint, error)
+	// PointAt - return series point at a given time or nil when there is no such point
+	PointAt(series string, dt time.Time) (*SeriesPoint, error)
+	// SeriesFields - return names of all series fields (columns), also those that have no value in some points
+	SeriesFields(series string) ([]string, error)
+	// HasPoint - check if series has any point with given tags values
+	HasPoint(series string, tags map[string]string) (bool, error)
+	// MatchingSeries - return names of all series matching given regexp (given as /regexp/)
+	MatchingSeries(re string) ([]string, error)
+	// DropSeries - remove series with all its points
+	DropSeries(series string) error
+	// TagValues - return all values of a given tag key
+	TagValues(key string) ([]string, error)
+	// Close - close backend connection
+	Close() error
+}
+
+// Series stores
+const (
+	SeriesStoreInflux   = "influx"
+	SeriesStorePostgres = "postgres"
+)
+
+// NewSeriesPoint - return series point, tags and fields are copied so caller can reuse them
+func NewSeriesPoint(ctx *Ctx, name string, tags map[string]string, fields map[string]interface{}, dt time.Time) SeriesPoint {
+	if ctx.Debug > 1 {
+		Printf("NewPoint: [name=%+v tags=%+v fields=%+v dt=%+v]\n", name, tags, fields, dt)
+	}
+	pt := SeriesPoint{Name: name, Fields: make(map[string]interface{}), Time: dt}
+	if len(tags) > 0 {
+		pt.Tags = make(map[string]string)
+		for k, v := range tags {
+			pt.Tags[k] = v
+		}
+	}
+	for k, v := range fields {
+		pt.Fields[k] = v
+	}
+	return pt
+}
+
+// NewSeriesStore - connect to series store selected by GHA2DB_SERIES_STORE
+// When GHA2DB_PROM_EXPORT_URL is set, written points are also exported to Prometheus compatible storage (see PromExportStore)
+func NewSeriesStore(ctx *Ctx) SeriesStore {
+	var store SeriesStore
+	switch ctx.SeriesStore {
+	case SeriesStoreInflux:
+		store = NewInfluxStore(ctx)
+	case SeriesStorePostgres:
+		store = NewPgStore(ctx)
+	default:
+		Fatalf("unknown series store '%s'", ctx.SeriesStore)
+	}
+	if ctx.PromExportURL != "" {
+		if ctx.PromExportFormat != PromExportRemoteWrite && ctx.PromExportFormat != PromExportOpenMetrics {
+			Fatalf("unknown Prometheus export format '%s'", ctx.PromExportFormat)
+		}
+		store = NewPromExportStore(ctx, store)
+	}
+	return store
+}
+
+// InfluxStore - InfluxDB series store, uses database from IDB_DB
+type InfluxStore struct {
+	ctx *Ctx
+	ic  client.Client
+}
+
+// NewInfluxStore - connect to InfluxDB
+func NewInfluxStore(ctx *Ctx) *InfluxStore {
+	return &InfluxStore{ctx: ctx, ic: IDBConn(ctx)}
+}
+
+// WritePoints - write points in batches of at most GHA2DB_IDB_MAXBATCHPOINTS points
+func (is *InfluxStore) WritePoints(points []SeriesPoint) error {
+	var pts IDBBatchPointsN
+	bp := IDBBatchPoints(is.ctx, &is.ic)
+	pts.Points = &bp
+	for _, point := range points {
+		pt, err := client.NewPoint(point.Name, point.Tags, point.Fields, point.Time)
+		if err != nil {
+			return err
+		}
+		IDBAddPointN(is.ctx, &is.ic, &pts, pt)
+	}
+	return IDBWritePointsN(is.ctx, &is.ic, &pts)
+}
+
+// query - do InfluxDB query, retry when InfluxDB engine is closed
+func (is *InfluxStore) query(query string) ([]client.Result, error) {
+	if is.ctx.QOut {
+		Printf("%s\n", query)
+	}
+	q := client.Query{
+		Command:  query,
+		Database: is.ctx.IDBDB,
+	}
+	var err error
+	for i := 1; i <= 10; i++ {
+		var response *client.Response
+		response, err = is.ic.Query(q)
+		if err == nil {
+			err = response.Error()
+		}
+		if err == nil {
+			return response.Results, nil
+		}
+		if err.Error() != EngineIsClosedError {
+			return nil, err
+		}
+		Printf("Query trial #%d: error: %s\n", i, err.Error())
+		Printf("Retrying...")
+		time.Sleep(time.Duration(i) * time.Second)
+	}
+	Printf("10 query trials failed\n.")
+	return nil, err
+}
+
+// firstRow - return first row of the first query result or nil when query returned no data
+func (is *InfluxStore) firstRow(query string) (*models.Row, error) {
+	res, err := is.query(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) < 1 || len(res[0].Series) < 1 {
+		return nil, nil
+	}
+	return &res[0].Series[0], nil
+}
+
+// IDBRowPoints - convert InfluxDB query result row into series points
+// Values must start with time column, null values are skipped
+func IDBRowPoints(row *models.Row) (points []SeriesPoint, err error) {
+	for _, values := range row.Values {
+		if len(values) != len(row.Columns) || len(values) < 1 || row.Columns[0] != TimeCol {
+			return nil, fmt.Errorf("series '%s': unexpected columns %v, values %v", row.Name, row.Columns, values)
+		}
+		sdt, ok := values[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("series '%s': unexpected time value %v", row.Name, values[0])
+		}
+		pt := SeriesPoint{Name: row.Name, Tags: row.Tags, Fields: make(map[string]interface{}), Time: TimeParseIDB(sdt)}
+		for i, column := range row.Columns[1:] {
+			if values[i+1] != nil {
+				pt.Fields[column] = values[i+1]
+			}
+		}
+		points = append(points, pt)
+	}
+	return
+}
+
+// onePoint - return the first point returned by query or nil
+func (is *InfluxStore) onePoint(query string) (*SeriesPoint, error) {
+	row, err := is.firstRow(query)
+	if err != nil || row == nil {
+		return nil, err
+	}
+	points, err := IDBRowPoints(row)
+	if err != nil || len(points) < 1 {
+		return nil, err
+	}
+	return &points[0], nil
+}
+
+// LastPoint - return the newest series point
+func (is *InfluxStore) LastPoint(series string) (*SeriesPoint, error) {
+	return is.onePoint(fmt.Sprintf("select * from \"%s\" order by time desc limit 1", series))
+}
+
+// PointAt - return series point at a given time
+func (is *InfluxStore) PointAt(series string, dt time.Time) (*SeriesPoint, error) {
+	return is.onePoint(fmt.Sprintf("select * from \"%s\" where time = '%s'", series, ToIDBDate(dt)))
+}
+
+// SeriesFields - return all series field keys (tags and time are not included)
+func (is *InfluxStore) SeriesFields(series string) (fields []string, err error) {
+	row, err := is.firstRow(fmt.Sprintf("show field keys from \"%s\"", series))
+	if err != nil || row == nil {
+		return
+	}
+	for _, val := range row.Values {
+		if len(val) < 1 {
+			continue
+		}
+		field, ok := val[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("series '%s': unexpected field key %v", series, val[0])
+		}
+		fields = append(fields, field)
+	}
+	return
+}
+
+// HasPoint - check if series has any point with given tags values
+func (is *InfluxStore) HasPoint(series string, tags map[string]string) (bool, error) {
+	query := fmt.Sprintf("select count(*) from \"%s\"", series)
+	keys := []string{}
+	for tag := range tags {
+		keys = append(keys, tag)
+	}
+	sort.Strings(keys)
+	cond := "where"
+	for _, tag := range keys {
+		query += fmt.Sprintf(" %s \"%s\" = '%s'", cond, tag, tags[tag])
+		cond = "and"
+	}
+	row, err := is.firstRow(query)
+	return row != nil, err
+}
+
+// MatchingSeries - return names of series matching given regexp by selecting their last values
+func (is *InfluxStore) MatchingSeries(re string) (names []string, err error) {
+	res, err := is.query("select last(*) from " + re)
+	if err != nil || len(res) < 1 {
+		return
+	}
+	for _, row := range res[0].Series {
+		names = append(names, row.Name)
+	}
+	return
+}
+
+// DropSeries - drop series with all its points and tags
+func (is *InfluxStore) DropSeries(series string) error {
+	_, err := is.query("drop series from \"" + series + "\"")
+	return err
+}
+
+// TagValues - return all values of a given tag key
+func (is *InfluxStore) TagValues(key string) (values []string, err error) {
+	row, err := is.firstRow("show tag values with key = " + key)
+	if err != nil || row == nil {
+		return
+	}
+	for _, val := range row.Values {
+		values = append(values, val[1].(string))
+	}
+	return
+}
+
+// Close - close InfluxDB connection
+func (is *InfluxStore) Close() error {
+	return is.ic.Close()
+}
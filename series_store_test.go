@@ -0,0 +1,106 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+
+	"github.com/influxdata/influxdb/models"
+)
+
+func TestNewSeriesPoint(t *testing.T) {
+	var ctx lib.Ctx
+	dt := testlib.YMDHMS(2018, 2, 3, 4, 0, 0)
+	tags := map[string]string{"quick_ranges_suffix": "d"}
+	fields := map[string]interface{}{"value": 0.0}
+	pt := lib.NewSeriesPoint(&ctx, "quick_ranges", tags, fields, dt)
+
+	// Caller can reuse tags and fields maps
+	tags["quick_ranges_suffix"] = "w"
+	fields["value"] = 1.0
+	expected := lib.SeriesPoint{
+		Name:   "quick_ranges",
+		Tags:   map[string]string{"quick_ranges_suffix": "d"},
+		Fields: map[string]interface{}{"value": 0.0},
+		Time:   dt,
+	}
+	if !reflect.DeepEqual(pt, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pt)
+	}
+	pt = lib.NewSeriesPoint(&ctx, "events_h", nil, fields, dt)
+	if pt.Tags != nil || pt.Fields["value"] != 1.0 {
+		t.Errorf("unexpected point %+v", pt)
+	}
+}
+
+func TestIDBRowPoints(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		row      models.Row
+		expected []lib.SeriesPoint
+		err      bool
+	}{
+		{row: models.Row{Name: "s", Columns: []string{"time", "value"}}},
+		{
+			row: models.Row{
+				Name:    "events_h",
+				Columns: []string{"time", "value"},
+				Values:  [][]interface{}{{"2018-02-03T04:00:00Z", 12.0}},
+			},
+			expected: []lib.SeriesPoint{
+				{Name: "events_h", Fields: map[string]interface{}{"value": 12.0}, Time: testlib.YMDHMS(2018, 2, 3, 4, 0, 0)},
+			},
+		},
+		{
+			row: models.Row{
+				Name:    "prs_opened_d",
+				Tags:    map[string]string{"repo": "kubernetes"},
+				Columns: []string{"time", "descr", "value"},
+				Values: [][]interface{}{
+					{"2018-02-03T00:00:00Z", "desc", 1.5},
+					{"2018-02-04T00:00:00Z", nil, 2.0},
+				},
+			},
+			expected: []lib.SeriesPoint{
+				{
+					Name:   "prs_opened_d",
+					Tags:   map[string]string{"repo": "kubernetes"},
+					Fields: map[string]interface{}{"descr": "desc", "value": 1.5},
+					Time:   testlib.YMDHMS(2018, 2, 3, 0, 0, 0),
+				},
+				{
+					Name:   "prs_opened_d",
+					Tags:   map[string]string{"repo": "kubernetes"},
+					Fields: map[string]interface{}{"value": 2.0},
+					Time:   testlib.YMDHMS(2018, 2, 4, 0, 0, 0),
+				},
+			},
+		},
+		{
+			row: models.Row{Name: "s", Columns: []string{"value", "time"}, Values: [][]interface{}{{1.0, "2018-02-03T00:00:00Z"}}},
+			err: true,
+		},
+		{
+			row: models.Row{Name: "s", Columns: []string{"time", "value"}, Values: [][]interface{}{{"2018-02-03T00:00:00Z"}}},
+			err: true,
+		},
+		{
+			row: models.Row{Name: "s", Columns: []string{"time"}, Values: [][]interface{}{{time.Now()}}},
+			err: true,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got, err := lib.IDBRowPoints(&test.row)
+		if (err != nil) != test.err {
+			t.Errorf("test number %d, expected error %v, got %v", index+1, test.err, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package devstats
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Event sinks names (GHA2DB_SINKS)
+const (
+	SinkPostgres = "postgres"
+	SinkNDJSON   = "ndjson"
+	SinkParquet  = "parquet"
+)
+
+// ParquetRowGroupRows - maximum number of events in a single Parquet row group
+// Only the current row group is kept in memory while writing
+const ParquetRowGroupRows = 100000
+
+// SinkEvent - single filtered GHA event passed to sinks
+// JSON is the raw event JSON, Event is its canonical form (for both GHA formats, see NormalizeEvent)
+type SinkEvent struct {
+	ID    string
+	JSON  []byte
+	Event *NormEvent
+}
+
+// Type - return event type
+func (ev *SinkEvent) Type() string {
+	return ev.Event.Type
+}
+
+// EventSink - destination of GHA events filtered by gha2db
+// Sinks are created for a single GHA hour by gha2db
+// WriteEvent returns number of events written (0 when event was already written before or its type is skipped)
+// Flush writes any buffered data, Close finalizes output, no events can be written after Close
+type EventSink interface {
+	WriteEvent(ctx *Ctx, dt time.Time, ev *SinkEvent) (int, error)
+	Flush(ctx *Ctx) error
+	Close(ctx *Ctx) error
+}
+
+// ValidSink - is a given sink name supported
+func ValidSink(name string) bool {
+	return name == SinkPostgres || name == SinkNDJSON || name == SinkParquet
+}
+
+// SinkPath - return output file path for a given file sink and GHA hour
+// Files are partitioned by day: ndjson has a file per hour GHA2DB_SINK_DIR/day=YYYY-MM-DD/YYYY-MM-DD-H.ndjson.gz,
+// parquet has a single file per day GHA2DB_SINK_DIR/day=YYYY-MM-DD/YYYY-MM-DD.parquet
+func SinkPath(ctx *Ctx, name string, dt time.Time) string {
+	day := ToYMDDate(dt)
+	file := fmt.Sprintf("%s-%d.ndjson.gz", day, dt.Hour())
+	if name == SinkParquet {
+		file = day + ".parquet"
+	}
+	return filepath.Join(ctx.SinkDir, "day="+day, file)
+}
+
+// NewFileSink - create a file sink (ndjson or parquet) for a given GHA hour
+// Data is written into a temporary file that is renamed to (or merged into) the final file on Close
+// So re-processing a given hour replaces its events instead of duplicating them
+func NewFileSink(ctx *Ctx, name string, dt time.Time) (EventSink, error) {
+	path := SinkPath(ctx, name, dt)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case SinkNDJSON:
+		file, err := os.Create(path + ".tmp")
+		if err != nil {
+			return nil, err
+		}
+		return &ndjsonSink{fileSink: fileSink{path: path, file: file, gz: gzip.NewWriter(file)}}, nil
+	case SinkParquet:
+		return newParquetSink(path, dt)
+	}
+	return nil, fmt.Errorf("unknown file sink: %s", name)
+}
+
+// fileSink - gzipped output file written to "path.tmp" and renamed on close
+type fileSink struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// close - close gzip stream and file and rename it to the final path
+func (fs *fileSink) close() error {
+	err := fs.gz.Close()
+	if err != nil {
+		_ = fs.file.Close()
+		return err
+	}
+	err = fs.file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(fs.path+".tmp", fs.path)
+}
+
+// ndjsonSink - writes raw event JSONs, one per line (newline delimited JSON)
+type ndjsonSink struct {
+	fileSink
+}
+
+// WriteEvent - write raw event JSON as a single line
+func (s *ndjsonSink) WriteEvent(ctx *Ctx, dt time.Time, ev *SinkEvent) (int, error) {
+	if !EventTypeHit(ctx, ev.Type()) {
+		return 0, nil
+	}
+	_, err := s.gz.Write(ev.JSON)
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.gz.Write([]byte{'\n'})
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// Flush - flush gzip stream
+func (s *ndjsonSink) Flush(ctx *Ctx) error {
+	return s.gz.Flush()
+}
+
+// Close - finalize output file
+func (s *ndjsonSink) Close(ctx *Ctx) error {
+	return s.close()
+}
+
+// EventRow - single GHA event stored in Parquet files
+// Pre 2015 events have no actor ID (it is 0), org ID is null when it is not known
+// Payload is the raw event payload JSON
+type EventRow struct {
+	ID         string    `parquet:"id"`
+	Type       string    `parquet:"type,dict"`
+	CreatedAt  time.Time `parquet:"created_at,timestamp(millisecond)"`
+	Public     bool      `parquet:"public"`
+	ActorID    int64     `parquet:"actor_id"`
+	ActorLogin string    `parquet:"actor_login"`
+	RepoID     int64     `parquet:"repo_id"`
+	RepoName   string    `parquet:"repo_name,dict"`
+	OrgID      *int64    `parquet:"org_id,optional"`
+	OrgLogin   *string   `parquet:"org_login,optional,dict"`
+	Payload    []byte    `parquet:"payload,json"`
+}
+
+// NewEventRow - return Parquet row for a given event
+func NewEventRow(ev *SinkEvent) (EventRow, error) {
+	var raw struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	err := json.Unmarshal(ev.JSON, &raw)
+	if err != nil {
+		return EventRow{}, err
+	}
+	if len(raw.Payload) == 0 {
+		raw.Payload = json.RawMessage("null")
+	}
+	e := ev.Event
+	row := EventRow{
+		ID:         ev.ID,
+		Type:       e.Type,
+		CreatedAt:  e.CreatedAt.UTC(),
+		Public:     e.Public,
+		ActorID:    int64(e.Actor.ID),
+		ActorLogin: e.Actor.Login,
+		RepoID:     int64(e.Repo.ID),
+		RepoName:   e.RepoFullName(),
+		Payload:    raw.Payload,
+	}
+	if e.Org != nil {
+		login := e.Org.Login
+		row.OrgLogin = &login
+		if id, ok := e.EventOrgID().(int); ok {
+			orgID := int64(id)
+			row.OrgID = &orgID
+		}
+	}
+	return row, nil
+}
+
+// newParquetWriter - return Parquet events writer
+func newParquetWriter(w io.Writer) *parquet.GenericWriter[EventRow] {
+	return parquet.NewGenericWriter[EventRow](
+		w,
+		parquet.Compression(&parquet.Zstd),
+		parquet.MaxRowsPerRowGroup(ParquetRowGroupRows),
+	)
+}
+
+// ReadEventRows - call fun for every event row in a given Parquet file, rows are read in batches
+func ReadEventRows(path string, fun func(*EventRow) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	pf, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	reader := parquet.NewGenericReader[EventRow](pf)
+	defer func() { _ = reader.Close() }()
+	rows := make([]EventRow, 1024)
+	for {
+		n, err := reader.Read(rows)
+		for i := 0; i < n; i++ {
+			e := fun(&rows[i])
+			if e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+// lockPath - wait for exclusive lock on "path.lock" file, lock is released when returned file is closed
+func lockPath(path string) (*os.File, error) {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// parquetSink - writes events into a single Parquet file per day
+// Hour events are streamed into a temporary Parquet file, on Close they are merged into the day file:
+// day file is rewritten (under an exclusive file lock) with its events and the hour events,
+// day file events with the same IDs as the hour events are replaced, so re-processing an hour doesn't duplicate events
+type parquetSink struct {
+	path     string
+	hourPath string
+	file     *os.File
+	writer   *parquet.GenericWriter[EventRow]
+}
+
+// newParquetSink - create Parquet sink writing into a given day file
+func newParquetSink(path string, dt time.Time) (*parquetSink, error) {
+	hourPath := fmt.Sprintf("%s.%d.tmp", path, dt.Hour())
+	file, err := os.Create(hourPath)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetSink{path: path, hourPath: hourPath, file: file, writer: newParquetWriter(file)}, nil
+}
+
+// WriteEvent - write event row, rows are written to the file in row groups
+func (s *parquetSink) WriteEvent(ctx *Ctx, dt time.Time, ev *SinkEvent) (int, error) {
+	if !EventTypeHit(ctx, ev.Type()) {
+		return 0, nil
+	}
+	row, err := NewEventRow(ev)
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.writer.Write([]EventRow{row})
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// Flush - nothing to do, full row groups are written by the writer and Parquet file is only readable after Close
+func (s *parquetSink) Flush(ctx *Ctx) error {
+	return nil
+}
+
+// Close - finalize hour file and merge it into the day file
+func (s *parquetSink) Close(ctx *Ctx) error {
+	defer func() { _ = os.Remove(s.hourPath) }()
+	err := s.writer.Close()
+	if err != nil {
+		_ = s.file.Close()
+		return err
+	}
+	err = s.file.Close()
+	if err != nil {
+		return err
+	}
+	lock, err := lockPath(s.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = lock.Close() }()
+	return s.merge()
+}
+
+// merge - rewrite day file with hour events (called with day file lock held)
+func (s *parquetSink) merge() error {
+	ids := make(map[string]struct{})
+	err := ReadEventRows(s.hourPath, func(row *EventRow) error {
+		ids[row.ID] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := newParquetWriter(file)
+	write := func(row *EventRow) error {
+		_, err := writer.Write([]EventRow{*row})
+		return err
+	}
+	_, err = os.Stat(s.path)
+	if err == nil {
+		err = ReadEventRows(s.path, func(row *EventRow) error {
+			if _, ok := ids[row.ID]; ok {
+				return nil
+			}
+			return write(row)
+		})
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err == nil {
+		err = ReadEventRows(s.hourPath, write)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
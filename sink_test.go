@@ -0,0 +1,247 @@
+package devstats
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestSinkPath(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		sink     string
+		dt       []int
+		expected string
+	}{
+		{sink: lib.SinkNDJSON, dt: []int{2018, 3, 7, 5}, expected: "/data/day=2018-03-07/2018-03-07-5.ndjson.gz"},
+		{sink: lib.SinkParquet, dt: []int{2014, 12, 31, 23}, expected: "/data/day=2014-12-31/2014-12-31.parquet"},
+		{sink: lib.SinkParquet, dt: []int{2014, 12, 31, 0}, expected: "/data/day=2014-12-31/2014-12-31.parquet"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		ctx := lib.Ctx{SinkDir: "/data"}
+		got := lib.SinkPath(&ctx, test.sink, testlib.YMDHMS(test.dt...))
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+// readGzipped - return decompressed contents of a given file
+func readGzipped(t *testing.T, path string) []byte {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = file.Close() }()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return data
+}
+
+// readEventRows - return all event rows from a given Parquet file
+func readEventRows(t *testing.T, path string) []lib.EventRow {
+	rows := []lib.EventRow{}
+	err := lib.ReadEventRows(path, func(row *lib.EventRow) error {
+		rows = append(rows, *row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	return rows
+}
+
+// rowIDs - return IDs of given event rows
+func rowIDs(rows []lib.EventRow) []string {
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	return ids
+}
+
+func TestFileSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gha_sink")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	ctx := lib.Ctx{SinkDir: dir}
+	dt := testlib.YMDHMS(2018, 1, 2, 3)
+	org := "cncf"
+	size := 1
+
+	// Events to write
+	oldEvent, err := lib.NormalizeEventOld(
+		"123",
+		&lib.EventOld{
+			Type:       "WatchEvent",
+			CreatedAt:  testlib.YMDHMS(2014, 1, 2, 3),
+			Actor:      "joe",
+			Repository: lib.ForkeeOld{ID: 5, Name: "devstats", Organization: &org},
+		},
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	events := []lib.SinkEvent{
+		{
+			ID:   "1",
+			JSON: []byte(`{"id":"1","type":"PushEvent","payload":{"size":1}}`),
+			Event: lib.NormalizeEvent(
+				&lib.Event{
+					ID:        "1",
+					Type:      "PushEvent",
+					Public:    true,
+					CreatedAt: testlib.YMDHMS(2018, 1, 2, 3, 4, 5),
+					Actor:     lib.Actor{ID: 2, Login: "lukaszgryglicki"},
+					Repo:      lib.Repo{ID: 3, Name: "cncf/devstats"},
+					Org:       &lib.Org{ID: 4, Login: "cncf"},
+					Payload:   lib.Payload{Size: &size},
+				},
+			),
+		},
+		{
+			ID:    "123",
+			JSON:  []byte(`{"type":"WatchEvent"}`),
+			Event: oldEvent,
+		},
+	}
+	for _, name := range []string{lib.SinkNDJSON, lib.SinkParquet} {
+		sink, err := lib.NewFileSink(&ctx, name, dt)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, ev := range events {
+			n, err := sink.WriteEvent(&ctx, dt, &ev)
+			if err != nil || n != 1 {
+				t.Errorf("%s: expected 1 event written, got %d, error %v", name, n, err)
+			}
+		}
+		path := lib.SinkPath(&ctx, name, dt)
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s: file %s should only be created on close", name, path)
+		}
+		err = sink.Flush(&ctx)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		err = sink.Close(&ctx)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if filepath.Dir(path) != filepath.Join(dir, "day=2018-01-02") {
+			t.Errorf("%s: unexpected partition %s", name, path)
+		}
+		switch name {
+		case lib.SinkNDJSON:
+			data := readGzipped(t, path)
+			expected := `{"id":"1","type":"PushEvent","payload":{"size":1}}` + "\n" + `{"type":"WatchEvent"}` + "\n"
+			if string(data) != expected {
+				t.Errorf("%s: expected %v, got %v", name, expected, string(data))
+			}
+		case lib.SinkParquet:
+			rows := readEventRows(t, path)
+			if len(rows) != 2 {
+				t.Fatalf("%s: expected 2 rows, got %d", name, len(rows))
+			}
+			if !testlib.CompareStringSlices(rowIDs(rows), []string{"1", "123"}) {
+				t.Errorf("%s: unexpected ids %v", name, rowIDs(rows))
+			}
+			if rows[0].RepoName != "cncf/devstats" || rows[1].RepoName != "cncf/devstats" {
+				t.Errorf("%s: unexpected repo names %v, %v", name, rows[0].RepoName, rows[1].RepoName)
+			}
+			if !rows[0].CreatedAt.Equal(testlib.YMDHMS(2018, 1, 2, 3, 4, 5)) || !rows[1].CreatedAt.Equal(testlib.YMDHMS(2014, 1, 2, 3)) {
+				t.Errorf("%s: unexpected created at %v, %v", name, rows[0].CreatedAt, rows[1].CreatedAt)
+			}
+			if rows[0].ActorID != 2 || rows[1].ActorID != 0 {
+				t.Errorf("%s: unexpected actor ids %v, %v", name, rows[0].ActorID, rows[1].ActorID)
+			}
+			if rows[0].OrgID == nil || *rows[0].OrgID != 4 || rows[1].OrgID != nil {
+				t.Errorf("%s: unexpected org ids %v, %v", name, rows[0].OrgID, rows[1].OrgID)
+			}
+			if rows[1].OrgLogin == nil || *rows[1].OrgLogin != "cncf" {
+				t.Errorf("%s: unexpected org login %v", name, rows[1].OrgLogin)
+			}
+			if string(rows[0].Payload) != `{"size":1}` || string(rows[1].Payload) != "null" {
+				t.Errorf("%s: unexpected payloads %s, %s", name, rows[0].Payload, rows[1].Payload)
+			}
+		}
+	}
+}
+
+func TestParquetDayFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gha_sink")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	ctx := lib.Ctx{SinkDir: dir}
+	writeHour := func(hour int, ids ...string) {
+		dt := testlib.YMDHMS(2018, 1, 2, hour)
+		sink, err := lib.NewFileSink(&ctx, lib.SinkParquet, dt)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		for _, id := range ids {
+			ev := lib.SinkEvent{
+				ID:    id,
+				JSON:  []byte(`{"id":"` + id + `","type":"WatchEvent"}`),
+				Event: lib.NormalizeEvent(&lib.Event{ID: id, Type: "WatchEvent", CreatedAt: dt}),
+			}
+			_, err := sink.WriteEvent(&ctx, dt, &ev)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		err = sink.Close(&ctx)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	path := lib.SinkPath(&ctx, lib.SinkParquet, testlib.YMDHMS(2018, 1, 2))
+
+	// Test cases: hours written in order and expected day file contents after each
+	var testCases = []struct {
+		hour     int
+		ids      []string
+		expected []string
+	}{
+		{hour: 0, ids: []string{"1", "2"}, expected: []string{"1", "2"}},
+		{hour: 1, ids: []string{"3"}, expected: []string{"1", "2", "3"}},
+		{hour: 0, ids: []string{"1", "2", "4"}, expected: []string{"3", "1", "2", "4"}},
+		{hour: 23, ids: []string{}, expected: []string{"3", "1", "2", "4"}},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		writeHour(test.hour, test.ids...)
+		got := rowIDs(readEventRows(t, path))
+		if !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	expected := []string{"2018-01-02.parquet", "2018-01-02.parquet.lock"}
+	if !testlib.CompareStringSlices(names, expected) {
+		t.Errorf("expected files %v, got %v", expected, names)
+	}
+}
@@ -389,6 +389,53 @@ func Structure(ctx *Ctx) {
 		ExecSQLWithErr(c, ctx, "create index comments_dup_user_login_idx on gha_comments(dup_user_login)")
 	}
 
+	// gha_reviews
+	// PR reviews from PullRequestReviewEvent (state: approved, changes_requested, commented, dismissed)
+	// Keys: user_id, pull_request_id, commit_id
+	// variable
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_reviews")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_reviews("+
+					"id bigint not null, "+
+					"event_id bigint not null, "+
+					"pull_request_id bigint not null, "+
+					"user_id bigint not null, "+
+					"commit_id varchar(40), "+
+					"submitted_at {{ts}}, "+
+					"state varchar(20) not null, "+
+					"body text, "+
+					"author_association varchar(40), "+
+					"dup_actor_id bigint not null, "+
+					"dup_actor_login varchar(120) not null, "+
+					"dup_repo_id bigint not null, "+
+					"dup_repo_name varchar(160) not null, "+
+					"dup_type varchar(40) not null, "+
+					"dup_created_at {{ts}} not null, "+
+					"dup_user_login varchar(120) not null, "+
+					"dup_pull_request_number int not null, "+
+					"primary key(id, event_id)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index reviews_event_id_idx on gha_reviews(event_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_pull_request_id_idx on gha_reviews(pull_request_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_user_id_idx on gha_reviews(user_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_submitted_at_idx on gha_reviews(submitted_at)")
+		ExecSQLWithErr(c, ctx, "create index reviews_state_idx on gha_reviews(state)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_actor_id_idx on gha_reviews(dup_actor_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_actor_login_idx on gha_reviews(dup_actor_login)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_repo_id_idx on gha_reviews(dup_repo_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_repo_name_idx on gha_reviews(dup_repo_name)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_created_at_idx on gha_reviews(dup_created_at)")
+		ExecSQLWithErr(c, ctx, "create index reviews_dup_user_login_idx on gha_reviews(dup_user_login)")
+	}
+
 	// gha_issues
 	// Table details and analysis in `analysis/analysis.txt` and `analysis/issue_*.json`
 	// Arrays: assignees, labels
@@ -1184,6 +1231,118 @@ func Structure(ctx *Ctx) {
 	if ctx.Index {
 		ExecSQLWithErr(c, ctx, "create index vars_name_idx on gha_vars(name)")
 	}
+
+	// This table holds gha2db ingestion status of every GHA hour (ingestion ledger)
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_ingest_hours")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_ingest_hours("+
+					"hour {{ts}} not null, "+
+					"status varchar(20) not null, "+
+					"jsons int not null default 0, "+
+					"found int not null default 0, "+
+					"events int not null default 0, "+
+					"checksum varchar(64) not null default '', "+
+					"duration double precision not null default 0, "+
+					"error text not null default '', "+
+					"updated_at {{ts}} not null, "+
+					"attempts int not null default 0, "+
+					"primary key(hour)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index ingest_hours_status_idx on gha_ingest_hours(status)")
+	}
+
+	// This table holds metrics watermarks: date up to which each metric's period was successfully calculated
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_metric_watermarks")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_metric_watermarks("+
+					"metric varchar(160) not null, "+
+					"period varchar(32) not null, "+
+					"dt {{ts}} not null, "+
+					"updated_at {{ts}} not null, "+
+					"primary key(metric, period)"+
+					")",
+			),
+		)
+	}
+
+	// These tables hold time series when Postgres series store is used (GHA2DB_SERIES_STORE=postgres)
+	// All series points are in a single table, series store only inserts and deletes rows (no DDL while syncing)
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_series_points")
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_series")
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_series_tags")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_series_points("+
+					"series text not null, "+
+					"time {{ts}} not null, "+
+					"tags jsonb not null default '{}', "+
+					"fields jsonb not null, "+
+					"primary key(series, time, tags)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_series("+
+					"series text not null, "+
+					"primary key(series)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_series_tags("+
+					"series text not null, "+
+					"key text not null, "+
+					"value text not null, "+
+					"primary key(key, value, series)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index series_tags_series_idx on gha_series_tags(series)")
+	}
+
+	// This table holds all names seen for a given repository ID (renames and transfers between orgs)
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_repo_names")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_repo_names("+
+					"repo_id bigint not null, "+
+					"name varchar(160) not null, "+
+					"first_seen {{ts}} not null, "+
+					"last_seen {{ts}} not null, "+
+					"primary key(repo_id, name)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index repo_names_name_idx on gha_repo_names(name)")
+	}
 	// Foreign keys are not needed - they slow down processing a lot
 
 	// Tools (like views and functions needed for generating metrics)
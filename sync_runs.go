@@ -0,0 +1,198 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SyncRunStep - name of a run record that summarises the whole project sync (gha2db_sync or devstats call)
+const SyncRunStep = "sync"
+
+// SyncRun - structured sync run record, stored in `gha_sync_runs` table in `devstats` database
+// Step is a gha2db_sync step name or SyncRunStep, Status is one of SyncStep* statuses
+// Rows - number of rows written (if known), Points - number of series points written (if known)
+type SyncRun struct {
+	Prog     string
+	Project  string
+	Step     string
+	Start    time.Time
+	End      time.Time
+	Status   string
+	Attempts int
+	Rows     int64
+	Points   int64
+	Error    string
+}
+
+// SyncRunsFromSteps - create run records from sync steps results
+// rows and points are per step counters, missing steps have zero counters
+func SyncRunsFromSteps(prog, project string, results []SyncStepResult, rows, points map[string]int64) []SyncRun {
+	runs := []SyncRun{}
+	for _, result := range results {
+		runs = append(
+			runs,
+			SyncRun{
+				Prog:     prog,
+				Project:  project,
+				Step:     result.Name,
+				Start:    result.Start,
+				End:      result.Start.Add(result.Time),
+				Status:   result.Status,
+				Attempts: result.Attempts,
+				Rows:     rows[result.Name],
+				Points:   points[result.Name],
+				Error:    result.Reason,
+			},
+		)
+	}
+	return runs
+}
+
+// RecordSyncRuns - save run records in `devstats` database
+// It does nothing when GHA2DB_SKIP_SYNC_RUNS is set
+func RecordSyncRuns(ctx *Ctx, runs []SyncRun) (err error) {
+	if ctx.SkipSyncRuns || len(runs) == 0 {
+		return
+	}
+	dctx := *ctx
+	dctx.PgDB = Devstats
+	con := PgConn(&dctx)
+	defer func() {
+		cerr := con.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	for _, run := range runs {
+		_, err = ExecSQL(
+			con,
+			&dctx,
+			"insert into gha_sync_runs(prog, proj, step, started_at, finished_at, status, attempts, rows, points, error) "+NValues(10),
+			run.Prog,
+			run.Project,
+			run.Step,
+			run.Start,
+			run.End,
+			run.Status,
+			run.Attempts,
+			run.Rows,
+			run.Points,
+			TruncToBytes(run.Error, 0xffff),
+		)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ProjectSyncStatus - project sync status: last run, last successful run, data freshness and failing steps
+// LastData - newest GHA event date in project's database (nil if unknown)
+// FailingSteps - steps that failed in their most recent run
+type ProjectSyncStatus struct {
+	Project      string
+	LastRun      *time.Time
+	LastStatus   string
+	LastSuccess  *time.Time
+	LastData     *time.Time
+	FailingSteps []string
+}
+
+// GetProjectSyncStatus - get project sync status from `gha_sync_runs` (con must be connected to `devstats` database)
+func GetProjectSyncStatus(con *sql.DB, ctx *Ctx, project string) (*ProjectSyncStatus, error) {
+	status := ProjectSyncStatus{Project: project, FailingSteps: []string{}}
+	rows, err := QuerySQL(
+		con,
+		ctx,
+		"select distinct on (step) step, status, finished_at from gha_sync_runs "+
+			"where proj = $1 order by step, finished_at desc",
+		project,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var (
+			step     string
+			stStatus string
+			finished time.Time
+		)
+		err = rows.Scan(&step, &stStatus, &finished)
+		if err != nil {
+			return nil, err
+		}
+		if step == SyncRunStep {
+			status.LastRun = &finished
+			status.LastStatus = stStatus
+			continue
+		}
+		if stStatus == SyncStepFailed {
+			status.FailingSteps = append(status.FailingSteps, step)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	err = QueryRowSQL(
+		con,
+		ctx,
+		"select max(finished_at) from gha_sync_runs where proj = $1 and step = $2 and status = $3",
+		project,
+		SyncRunStep,
+		SyncStepOK,
+	).Scan(&status.LastSuccess)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SyncStatusReport - return projects status table (one line per project) and number of projects with problems
+// Project has a problem when its last sync failed, some steps are failing or last success is older than maxAge
+func SyncStatusReport(statuses []ProjectSyncStatus, now time.Time, maxAge time.Duration) (string, int) {
+	sorted := append([]ProjectSyncStatus{}, statuses...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Project < sorted[j].Project })
+	age := func(dt *time.Time) string {
+		if dt == nil {
+			return "-"
+		}
+		return now.Sub(*dt).Truncate(time.Second).String()
+	}
+	problems := 0
+	lines := []string{
+		fmt.Sprintf("%-20s %-8s %-12s %-14s %-12s %s", "project", "status", "last run", "last success", "data age", "failing steps"),
+	}
+	for _, st := range sorted {
+		status := "ok"
+		switch {
+		case st.LastRun == nil:
+			status = "never"
+		case st.LastStatus != SyncStepOK:
+			status = "failed"
+		case len(st.FailingSteps) > 0:
+			status = "failing"
+		case st.LastSuccess == nil || now.Sub(*st.LastSuccess) > maxAge:
+			status = "stale"
+		}
+		if status != "ok" {
+			problems++
+		}
+		failing := "-"
+		if len(st.FailingSteps) > 0 {
+			failing = strings.Join(st.FailingSteps, ",")
+		}
+		lines = append(
+			lines,
+			fmt.Sprintf(
+				"%-20s %-8s %-12s %-14s %-12s %s",
+				st.Project, status, age(st.LastRun), age(st.LastSuccess), age(st.LastData), failing,
+			),
+		)
+	}
+	return strings.Join(lines, "\n") + "\n", problems
+}
@@ -0,0 +1,128 @@
+package devstats
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestSyncRunsFromSteps(t *testing.T) {
+	start := testlib.YMDHMS(2018, 2, 3, 4, 5, 6)
+	results := []lib.SyncStepResult{
+		{Name: "gha2db", Status: lib.SyncStepOK, Attempts: 2, Start: start, Time: time.Minute},
+		{Name: "metrics", Status: lib.SyncStepFailed, Attempts: 1, Start: start.Add(time.Minute), Time: time.Hour, Reason: "2 metrics failed"},
+		{Name: "annotations", Status: lib.SyncStepSkipped, Start: start.Add(time.Hour), Reason: "condition not_daily"},
+	}
+	runs := lib.SyncRunsFromSteps(
+		"gha2db_sync",
+		"kubernetes",
+		results,
+		map[string]int64{"gha2db": 1000},
+		map[string]int64{"metrics": 5000},
+	)
+	expected := []lib.SyncRun{
+		{
+			Prog: "gha2db_sync", Project: "kubernetes", Step: "gha2db", Start: start, End: start.Add(time.Minute),
+			Status: lib.SyncStepOK, Attempts: 2, Rows: 1000,
+		},
+		{
+			Prog: "gha2db_sync", Project: "kubernetes", Step: "metrics", Start: start.Add(time.Minute),
+			End: start.Add(time.Hour + time.Minute), Status: lib.SyncStepFailed, Attempts: 1, Points: 5000, Error: "2 metrics failed",
+		},
+		{
+			Prog: "gha2db_sync", Project: "kubernetes", Step: "annotations", Start: start.Add(time.Hour), End: start.Add(time.Hour),
+			Status: lib.SyncStepSkipped, Error: "condition not_daily",
+		},
+	}
+	if len(runs) != len(expected) {
+		t.Fatalf("expected %d runs, got %d", len(expected), len(runs))
+	}
+	for index := range expected {
+		if runs[index] != expected[index] {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, expected[index], runs[index])
+		}
+	}
+}
+
+func TestSyncStatusReport(t *testing.T) {
+	now := testlib.YMDHMS(2018, 2, 3, 12, 0, 0)
+	ago := func(d time.Duration) *time.Time {
+		dt := now.Add(-d)
+		return &dt
+	}
+	// Test cases
+	var testCases = []struct {
+		status   lib.ProjectSyncStatus
+		expected string
+		problem  bool
+	}{
+		{
+			status: lib.ProjectSyncStatus{
+				Project: "prometheus", LastRun: ago(time.Hour), LastStatus: lib.SyncStepOK,
+				LastSuccess: ago(time.Hour), LastData: ago(90 * time.Minute),
+			},
+			expected: "ok       1h0m0s       1h0m0s         1h30m0s      -",
+		},
+		{
+			status:   lib.ProjectSyncStatus{Project: "cni"},
+			expected: "never    -            -              -            -",
+			problem:  true,
+		},
+		{
+			status: lib.ProjectSyncStatus{
+				Project: "kubernetes", LastRun: ago(time.Hour), LastStatus: lib.SyncStepFailed, LastSuccess: ago(5 * time.Hour),
+				FailingSteps: []string{"ghapi2db", "metrics"},
+			},
+			expected: "failed   1h0m0s       5h0m0s         -            ghapi2db,metrics",
+			problem:  true,
+		},
+		{
+			status: lib.ProjectSyncStatus{
+				Project: "envoy", LastRun: ago(time.Hour), LastStatus: lib.SyncStepOK, LastSuccess: ago(time.Hour),
+				FailingSteps: []string{"annotations"},
+			},
+			expected: "failing  1h0m0s       1h0m0s         -            annotations",
+			problem:  true,
+		},
+		{
+			status: lib.ProjectSyncStatus{
+				Project: "linkerd", LastRun: ago(4 * time.Hour), LastStatus: lib.SyncStepOK, LastSuccess: ago(4 * time.Hour),
+			},
+			expected: "stale    4h0m0s       4h0m0s         -            -",
+			problem:  true,
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		report, problems := lib.SyncStatusReport([]lib.ProjectSyncStatus{test.status}, now, 3*time.Hour)
+		lines := strings.Split(strings.TrimSpace(report), "\n")
+		if len(lines) != 2 {
+			t.Errorf("test number %d, expected header and one line, got:\n%s", index+1, report)
+			continue
+		}
+		if !strings.HasPrefix(lines[0], "project") || !strings.HasPrefix(lines[1], test.status.Project) {
+			t.Errorf("test number %d, unexpected report:\n%s", index+1, report)
+		}
+		got := strings.TrimSpace(lines[1][len(test.status.Project):])
+		if got != test.expected || (problems == 1) != test.problem {
+			t.Errorf("test number %d, expected '%s' (problem %v), got '%s' (%d problems)", index+1, test.expected, test.problem, got, problems)
+		}
+	}
+	// Projects are sorted by name
+	all := []lib.ProjectSyncStatus{}
+	for _, test := range testCases {
+		all = append(all, test.status)
+	}
+	report, problems := lib.SyncStatusReport(all, now, 3*time.Hour)
+	names := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(report), "\n")[1:] {
+		names = append(names, strings.Fields(line)[0])
+	}
+	expectedNames := []string{"cni", "envoy", "kubernetes", "linkerd", "prometheus"}
+	if problems != 4 || !testlib.CompareStringSlices(names, expectedNames) {
+		t.Errorf("expected %v and 4 problems, got %v and %d problems", expectedNames, names, problems)
+	}
+}
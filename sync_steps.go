@@ -0,0 +1,292 @@
+package devstats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sync step results
+const (
+	SyncStepOK      = "ok"
+	SyncStepFailed  = "failed"
+	SyncStepSkipped = "skipped"
+)
+
+// SyncStep - single gha2db_sync step, steps form a DAG using Needs (names of steps that must succeed first)
+// Retries - how many times to retry failed step, Timeout - max step duration (Go duration string, like "30m")
+// commands still running after step's timeout are killed
+// Skip - always skip step, SkipIf - skip step when any of named conditions is true (see RunSyncSteps)
+// Command & Env - external command (and its environment) run by a step that is not built into gha2db_sync
+type SyncStep struct {
+	Name    string               `yaml:"name"`
+	Needs   []string             `yaml:"needs"`
+	Retries int                  `yaml:"retries"`
+	Timeout string               `yaml:"timeout"`
+	Skip    bool                 `yaml:"skip"`
+	SkipIf  []string             `yaml:"skip_if"`
+	Command []string             `yaml:"command"`
+	Env     map[string]string    `yaml:"env"`
+	Run     func(ctx *Ctx) error `yaml:"-"`
+}
+
+// SyncSteps - gha2db_sync steps overrides (from GHA2DB_SYNC_YAML)
+type SyncSteps struct {
+	Steps []SyncStep `yaml:"steps"`
+}
+
+// SyncStepResult - result of a single step: status (ok, failed, skipped), number of attempts,
+// start time, duration and reason (error or why it was skipped)
+type SyncStepResult struct {
+	Name     string
+	Status   string
+	Attempts int
+	Start    time.Time
+	Time     time.Duration
+	Reason   string
+}
+
+// MergeSyncSteps - apply overrides to default steps
+// Overrides are matched by name, only fields that are set are overwritten (needs: [] removes all dependencies)
+// Steps that are not defined in defaults are added at the end, they must have a command
+func MergeSyncSteps(defaults, overrides []SyncStep) ([]SyncStep, error) {
+	steps := append([]SyncStep{}, defaults...)
+	idx := make(map[string]int)
+	for i, step := range steps {
+		idx[step.Name] = i
+	}
+	for _, over := range overrides {
+		i, ok := idx[over.Name]
+		if !ok {
+			if len(over.Command) == 0 {
+				return nil, fmt.Errorf("step '%s' is not defined and has no command", over.Name)
+			}
+			idx[over.Name] = len(steps)
+			steps = append(steps, over)
+			continue
+		}
+		step := &steps[i]
+		if over.Needs != nil {
+			step.Needs = over.Needs
+		}
+		if over.Retries > 0 {
+			step.Retries = over.Retries
+		}
+		if over.Timeout != "" {
+			step.Timeout = over.Timeout
+		}
+		if over.Skip {
+			step.Skip = true
+		}
+		if over.SkipIf != nil {
+			step.SkipIf = over.SkipIf
+		}
+		if len(over.Command) > 0 {
+			step.Command = over.Command
+			step.Run = nil
+		}
+		if over.Env != nil {
+			step.Env = over.Env
+		}
+	}
+	return steps, nil
+}
+
+// SortSyncSteps - return steps in execution order (topological sort of needs)
+// Steps that do not depend on each other are kept in their original order
+// Returns error on unknown dependency, duplicate step name or dependency cycle
+func SortSyncSteps(steps []SyncStep) ([]SyncStep, error) {
+	idx := make(map[string]int)
+	for i, step := range steps {
+		if _, ok := idx[step.Name]; ok {
+			return nil, fmt.Errorf("duplicate step '%s'", step.Name)
+		}
+		idx[step.Name] = i
+	}
+	for _, step := range steps {
+		for _, need := range step.Needs {
+			if _, ok := idx[need]; !ok {
+				return nil, fmt.Errorf("step '%s' needs unknown step '%s'", step.Name, need)
+			}
+		}
+	}
+	done := make(map[string]bool)
+	sorted := []SyncStep{}
+	for len(sorted) < len(steps) {
+		added := false
+		for _, step := range steps {
+			if done[step.Name] {
+				continue
+			}
+			ready := true
+			for _, need := range step.Needs {
+				if !done[need] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[step.Name] = true
+				sorted = append(sorted, step)
+				added = true
+				break
+			}
+		}
+		if !added {
+			left := []string{}
+			for _, step := range steps {
+				if !done[step.Name] {
+					left = append(left, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("steps dependency cycle: %s", strings.Join(left, ", "))
+		}
+	}
+	return sorted, nil
+}
+
+// CommandString - return command with its arguments and environment as a shell command line
+// Environment variables are sorted by name, empty arguments and arguments with special characters are quoted
+func CommandString(cmdAndArgs []string, env map[string]string) string {
+	quote := func(s string) string {
+		if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`;&|<>(){}*?!#~") {
+			return s
+		}
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	names := []string{}
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	args := []string{}
+	for _, name := range names {
+		args = append(args, name+"="+quote(env[name]))
+	}
+	for _, arg := range cmdAndArgs {
+		args = append(args, quote(arg))
+	}
+	return strings.Join(args, " ")
+}
+
+// PlanPrintf - print sync plan line (GHA2DB_SYNC_PLAN)
+// Plan lines are printed with "plan: " prefix and without time, so they can be filtered from logs and compared
+func PlanPrintf(format string, args ...interface{}) {
+	fmt.Printf("plan: "+format, args...)
+}
+
+// runSyncStep - run a single step attempt, commands started after step's deadline are killed
+func runSyncStep(ctx *Ctx, step *SyncStep, deadline time.Time) error {
+	stepCtx := *ctx
+	stepCtx.ExecFatal = false
+	stepCtx.ExecDeadline = deadline
+	if step.Run != nil {
+		return step.Run(&stepCtx)
+	}
+	if len(step.Command) == 0 {
+		return fmt.Errorf("step '%s' has nothing to run", step.Name)
+	}
+	if ctx.SyncPlan {
+		PlanPrintf("%s\n", CommandString(step.Command, step.Env))
+		return nil
+	}
+	_, err := ExecCommand(&stepCtx, step.Command, step.Env)
+	return err
+}
+
+// RunSyncSteps - run steps in dependency order, conditions are named skip conditions (see SyncStep.SkipIf)
+// Step failure doesn't stop other steps, only steps that depend on it (directly or not) are skipped
+// Skipped steps (by Skip or SkipIf) don't block steps that depend on them
+// In plan mode (GHA2DB_SYNC_PLAN) steps only print what they would do, step commands are printed and not executed
+func RunSyncSteps(ctx *Ctx, steps []SyncStep, conditions map[string]bool) ([]SyncStepResult, error) {
+	sorted, err := SortSyncSteps(steps)
+	if err != nil {
+		return nil, err
+	}
+	status := make(map[string]string)
+	results := []SyncStepResult{}
+	for _, step := range sorted {
+		result := SyncStepResult{Name: step.Name, Status: SyncStepSkipped, Start: time.Now()}
+		timeout := time.Duration(0)
+		if step.Timeout != "" {
+			timeout, err = time.ParseDuration(step.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("step '%s': %v", step.Name, err)
+			}
+		}
+		for _, cond := range step.SkipIf {
+			if _, ok := conditions[cond]; !ok {
+				return nil, fmt.Errorf("step '%s': unknown skip condition '%s'", step.Name, cond)
+			}
+		}
+		if step.Skip {
+			result.Reason = "disabled"
+		}
+		for _, cond := range step.SkipIf {
+			if result.Reason == "" && conditions[cond] {
+				result.Reason = "condition " + cond
+			}
+		}
+		for _, need := range step.Needs {
+			if result.Reason == "" && status[need] == SyncStepFailed {
+				result.Reason = "needs " + need
+			}
+		}
+		if result.Reason != "" {
+			Printf("Step %s skipped: %s\n", step.Name, result.Reason)
+			if ctx.SyncPlan {
+				PlanPrintf("step %s: skipped, %s\n", step.Name, result.Reason)
+			}
+			status[step.Name] = SyncStepSkipped
+			if strings.HasPrefix(result.Reason, "needs ") {
+				// Propagate failure to steps that depend on this one
+				status[step.Name] = SyncStepFailed
+			}
+			results = append(results, result)
+			continue
+		}
+		if ctx.SyncPlan {
+			PlanPrintf("step %s\n", step.Name)
+		}
+		for result.Attempts <= step.Retries {
+			result.Attempts++
+			Printf("Step %s: attempt %d/%d\n", step.Name, result.Attempts, step.Retries+1)
+			deadline := time.Time{}
+			if timeout > 0 {
+				deadline = time.Now().Add(timeout)
+			}
+			err = runSyncStep(ctx, &step, deadline)
+			if err == nil {
+				result.Status = SyncStepOK
+				result.Reason = ""
+				break
+			}
+			result.Status = SyncStepFailed
+			result.Reason = err.Error()
+			Printf("Step %s: attempt %d failed: %v\n", step.Name, result.Attempts, err)
+		}
+		result.Time = time.Now().Sub(result.Start)
+		status[step.Name] = result.Status
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// SyncStepsSummary - return steps results report (one line per step) and number of failed steps
+// Steps skipped because their dependency failed are also counted as failed
+func SyncStepsSummary(results []SyncStepResult) (string, int) {
+	failed := 0
+	lines := []string{}
+	for _, result := range results {
+		line := fmt.Sprintf("%-16s %-8s attempts: %d, time: %v", result.Name, result.Status, result.Attempts, result.Time)
+		if result.Reason != "" {
+			line += ", " + result.Reason
+		}
+		if result.Status == SyncStepFailed || strings.HasPrefix(result.Reason, "needs ") {
+			failed++
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n") + "\n", failed
+}
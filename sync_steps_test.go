@@ -0,0 +1,214 @@
+package devstats
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+// syncStepNames - return names of steps
+func syncStepNames(steps []lib.SyncStep) []string {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
+
+func TestSortSyncSteps(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		steps    []lib.SyncStep
+		expected []string
+		err      bool
+	}{
+		{steps: []lib.SyncStep{}, expected: []string{}},
+		{
+			steps:    []lib.SyncStep{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			steps:    []lib.SyncStep{{Name: "a", Needs: []string{"c"}}, {Name: "b"}, {Name: "c"}},
+			expected: []string{"b", "c", "a"},
+		},
+		{
+			steps: []lib.SyncStep{
+				{Name: "metrics", Needs: []string{"structure", "gaps"}},
+				{Name: "gaps"},
+				{Name: "structure", Needs: []string{"gha2db"}},
+				{Name: "gha2db"},
+			},
+			expected: []string{"gaps", "gha2db", "structure", "metrics"},
+		},
+		{steps: []lib.SyncStep{{Name: "a", Needs: []string{"x"}}}, err: true},
+		{steps: []lib.SyncStep{{Name: "a"}, {Name: "a"}}, err: true},
+		{steps: []lib.SyncStep{{Name: "a", Needs: []string{"b"}}, {Name: "b", Needs: []string{"a"}}}, err: true},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		sorted, err := lib.SortSyncSteps(test.steps)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %v", index+1, syncStepNames(sorted))
+			}
+			continue
+		}
+		got := syncStepNames(sorted)
+		if err != nil || !testlib.CompareStringSlices(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v, error %v", index+1, test.expected, got, err)
+		}
+	}
+}
+
+func TestMergeSyncSteps(t *testing.T) {
+	defaults := []lib.SyncStep{
+		{Name: "gha2db", SkipIf: []string{"skip_pdb"}},
+		{Name: "structure", Needs: []string{"gha2db"}, Timeout: "1h"},
+	}
+	merged, err := lib.MergeSyncSteps(
+		defaults,
+		[]lib.SyncStep{
+			{Name: "gha2db", Retries: 3},
+			{Name: "structure", Needs: []string{}, Skip: true},
+			{Name: "custom", Needs: []string{"structure"}, Command: []string{"echo", "1"}},
+		},
+	)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !testlib.CompareStringSlices(syncStepNames(merged), []string{"gha2db", "structure", "custom"}) {
+		t.Errorf("unexpected steps %v", syncStepNames(merged))
+	}
+	if merged[0].Retries != 3 || !testlib.CompareStringSlices(merged[0].SkipIf, []string{"skip_pdb"}) {
+		t.Errorf("unexpected gha2db step %+v", merged[0])
+	}
+	if len(merged[1].Needs) != 0 || !merged[1].Skip || merged[1].Timeout != "1h" {
+		t.Errorf("unexpected structure step %+v", merged[1])
+	}
+	if len(defaults[1].Needs) != 1 || defaults[1].Skip {
+		t.Errorf("defaults should not be modified, got %+v", defaults[1])
+	}
+	_, err = lib.MergeSyncSteps(defaults, []lib.SyncStep{{Name: "unknown", Retries: 1}})
+	if err == nil {
+		t.Errorf("expected error for unknown step without command")
+	}
+}
+
+func TestRunSyncSteps(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.ExecFatal = true
+	ctx.ExecQuiet = true
+	calls := map[string]int{}
+	run := func(name string, failures int) func(*lib.Ctx) error {
+		return func(c *lib.Ctx) error {
+			if c.ExecFatal {
+				return fmt.Errorf("%s: steps should not be fatal", name)
+			}
+			calls[name]++
+			if calls[name] <= failures {
+				return fmt.Errorf("%s failure %d", name, calls[name])
+			}
+			return nil
+		}
+	}
+	steps := []lib.SyncStep{
+		{Name: "gha2db", Retries: 2, Run: run("gha2db", 2)},
+		{Name: "ghapi2db", Needs: []string{"gha2db"}, Run: run("ghapi2db", 10)},
+		{Name: "structure", Needs: []string{"gha2db"}, Run: run("structure", 0)},
+		{Name: "annotations", SkipIf: []string{"not_daily"}, Run: run("annotations", 0)},
+		{Name: "idb_tags", Needs: []string{"annotations"}, Run: run("idb_tags", 0)},
+		{Name: "after_api", Needs: []string{"ghapi2db"}, Run: run("after_api", 0)},
+		{Name: "after_after_api", Needs: []string{"after_api"}, Run: run("after_after_api", 0)},
+		{Name: "disabled", Skip: true, Run: run("disabled", 0)},
+		{Name: "timeout", Timeout: "100ms", Command: []string{"sleep", "5"}},
+	}
+	results, err := lib.RunSyncSteps(&ctx, steps, map[string]bool{"not_daily": true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	// Expected status and attempts
+	expected := map[string][2]interface{}{
+		"gha2db":          {lib.SyncStepOK, 3},
+		"ghapi2db":        {lib.SyncStepFailed, 1},
+		"structure":       {lib.SyncStepOK, 1},
+		"annotations":     {lib.SyncStepSkipped, 0},
+		"idb_tags":        {lib.SyncStepOK, 1},
+		"after_api":       {lib.SyncStepSkipped, 0},
+		"after_after_api": {lib.SyncStepSkipped, 0},
+		"disabled":        {lib.SyncStepSkipped, 0},
+		"timeout":         {lib.SyncStepFailed, 1},
+	}
+	if len(results) != len(expected) {
+		t.Errorf("expected %d results, got %d", len(expected), len(results))
+	}
+	for _, result := range results {
+		exp := expected[result.Name]
+		if result.Status != exp[0] || result.Attempts != exp[1] {
+			t.Errorf("step %s: expected %v, got %+v", result.Name, exp, result)
+		}
+	}
+	summary, failed := lib.SyncStepsSummary(results)
+	if failed != 4 || !strings.Contains(summary, "needs after_api") || !strings.Contains(summary, "deadline") {
+		t.Errorf("unexpected summary (%d failed):\n%s", failed, summary)
+	}
+	_, err = lib.RunSyncSteps(&ctx, []lib.SyncStep{{Name: "a", SkipIf: []string{"unknown"}}}, map[string]bool{})
+	if err == nil {
+		t.Errorf("expected error for unknown skip condition")
+	}
+}
+
+func TestRunSyncStepsPlan(t *testing.T) {
+	var ctx lib.Ctx
+	ctx.ExecQuiet = true
+	ctx.SyncPlan = true
+	planned := false
+	steps := []lib.SyncStep{
+		{Name: "builtin", Run: func(c *lib.Ctx) error { planned = c.SyncPlan; return nil }},
+		{Name: "command", Needs: []string{"builtin"}, Command: []string{"false"}},
+		{Name: "daily", SkipIf: []string{"not_daily"}, Command: []string{"false"}},
+	}
+	results, err := lib.RunSyncSteps(&ctx, steps, map[string]bool{"not_daily": true})
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	if !planned {
+		t.Errorf("built-in step should be run in plan mode")
+	}
+	expected := []string{lib.SyncStepOK, lib.SyncStepOK, lib.SyncStepSkipped}
+	for index, result := range results {
+		if index >= len(expected) || result.Status != expected[index] {
+			t.Errorf("test number %d, expected %v, got %+v", index+1, expected, result)
+		}
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		cmd      []string
+		env      map[string]string
+		expected string
+	}{
+		{cmd: []string{"ghapi2db"}, expected: "ghapi2db"},
+		{
+			cmd:      []string{"./gha2db", "2018-02-03", "4", "2018-02-03", "5", "kubernetes,kubernetes-client", ""},
+			expected: "./gha2db 2018-02-03 4 2018-02-03 5 kubernetes,kubernetes-client ''",
+		},
+		{
+			cmd:      []string{"z2influx", "a_d,b_d", "2018-02-03 04", "2018-02-03 05", "d", "desc,values:value"},
+			env:      map[string]string{"GHA2DB_SKIPTABLE": "1", "GHA2DB_MGETC": "y"},
+			expected: "GHA2DB_MGETC=y GHA2DB_SKIPTABLE=1 z2influx a_d,b_d '2018-02-03 04' '2018-02-03 05' d desc,values:value",
+		},
+		{cmd: []string{"echo", "it's", "$HOME"}, env: map[string]string{"X": ""}, expected: `X='' echo 'it'\''s' '$HOME'`},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.CommandString(test.cmd, test.env)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %s, got %s", index+1, test.expected, got)
+		}
+	}
+}
@@ -33,17 +33,18 @@ func ProgressInfo(i, n int, start time.Time, last *time.Time, period time.Durati
 }
 
 // ComputePeriodAtThisDate - for some longer periods, only recalculate them on specific dates
+// Hours are local hours of the project's time zone (GHA2DB_TMZONE or GHA2DB_TMOFFSET, UTC by default)
+// counted as real hours since local midnight, so on DST change days every hour is used exactly once
 // hourly period is always calculated
 // daily period is always calculated
-// multiple days period are calculaded at hours: 1, 5, 9, 13, 17, 21 (UTC)
+// multiple days period are calculaded at hours: 1, 5, 9, 13, 17, 21
 // annotation ranges are calculated:
 // from last release to now - every 2 hours
 // for past ranges only once (calculation is marked as computed) at 2 AM
 // weekly ranges are calculated at hours: 0, 4, 8, 12, 16, 20
 // monthly, quarterly, yearly ranges are calculated at midnight
 func ComputePeriodAtThisDate(ctx *Ctx, period string, dt time.Time) bool {
-	dt = HourStart(dt)
-	h := (dt.Hour() + ctx.TmOffset) % 24
+	h := LocalDayHour(ctx, dt)
 	periodStart := period[0:1]
 	if periodStart == "h" {
 		return true
@@ -68,6 +69,71 @@ func ComputePeriodAtThisDate(ctx *Ctx, period string, dt time.Time) bool {
 	return false
 }
 
+// TimeZone - return time zone used to decide when to calculate metrics
+// GHA2DB_TMZONE (IANA name) when set, otherwise fixed GHA2DB_TMOFFSET hours offset (UTC by default)
+func TimeZone(ctx *Ctx) *time.Location {
+	if ctx.TmZone != nil {
+		return ctx.TmZone
+	}
+	if ctx.TmOffset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(fmt.Sprintf("UTC%+d", ctx.TmOffset), ctx.TmOffset*3600)
+}
+
+// LocalDayHour - return number of full hours since the local day start (in TimeZone(ctx)) of a given time
+// This is 0-23 on most days, 0-22 when DST starts and 0-24 when DST ends
+func LocalDayHour(ctx *Ctx, dt time.Time) int {
+	dt = HourStart(dt)
+	return int(dt.Sub(InTimeZone(DayStart, TimeZone(ctx))(dt)) / time.Hour)
+}
+
+// InTimeZone - return period start function (like DayStart, NextWeekStart, ...) working on local time in a given time zone
+// Given time is converted to local time, period start is computed on local wall clock and returned in UTC
+// When wall clock time is ambiguous (repeated by DST change), offset of the given time is preferred
+// Wall clock times that do not exist (skipped by DST change) are moved by Go's time normalization
+func InTimeZone(fun func(time.Time) time.Time, loc *time.Location) func(time.Time) time.Time {
+	return func(dt time.Time) time.Time {
+		local := dt.In(loc)
+		wall := fun(
+			time.Date(
+				local.Year(),
+				local.Month(),
+				local.Day(),
+				local.Hour(),
+				local.Minute(),
+				local.Second(),
+				local.Nanosecond(),
+				time.UTC,
+			),
+		)
+		name, offset := local.Zone()
+		res := time.Date(
+			wall.Year(),
+			wall.Month(),
+			wall.Day(),
+			wall.Hour(),
+			wall.Minute(),
+			wall.Second(),
+			wall.Nanosecond(),
+			time.FixedZone(name, offset),
+		)
+		if _, resOffset := res.In(loc).Zone(); resOffset == offset {
+			return res.UTC()
+		}
+		return time.Date(
+			wall.Year(),
+			wall.Month(),
+			wall.Day(),
+			wall.Hour(),
+			wall.Minute(),
+			wall.Second(),
+			wall.Nanosecond(),
+			loc,
+		).UTC()
+	}
+}
+
 // HourStart - return time rounded to current hour start
 func HourStart(dt time.Time) time.Time {
 	return time.Date(
@@ -339,6 +405,19 @@ func AddNIntervals(dt time.Time, n int, nextIntervalStart, prevIntervalStart fun
 	return dt
 }
 
+// GetIntervalFunctionsInZone - like GetIntervalFunctions, but day and longer intervals start at local midnight
+// in a given time zone (see InTimeZone), hours are always UTC hours, nil time zone means UTC
+func GetIntervalFunctionsInZone(intervalAbbr string, allowUnknown bool, loc *time.Location) (interval string, n int, intervalStart, nextIntervalStart, prevIntervalStart func(time.Time) time.Time) {
+	interval, n, intervalStart, nextIntervalStart, prevIntervalStart = GetIntervalFunctions(intervalAbbr, allowUnknown)
+	if intervalStart == nil || interval == "hour" || loc == nil || loc == time.UTC {
+		return
+	}
+	intervalStart = InTimeZone(intervalStart, loc)
+	nextIntervalStart = InTimeZone(nextIntervalStart, loc)
+	prevIntervalStart = InTimeZone(prevIntervalStart, loc)
+	return
+}
+
 // GetIntervalFunctions - return interval name, interval number, interval start, next, prev function from interval abbr: h|d2|w3|m4|q|y
 // w3 = 3 weeks, q2 = 2 quarters, y = year (1), d7 = 7 days (not the same as w), m3 = 3 months (not the same as q)
 func GetIntervalFunctions(intervalAbbr string, allowUnknown bool) (interval string, n int, intervalStart, nextIntervalStart, prevIntervalStart func(time.Time) time.Time) {
@@ -22,6 +22,7 @@ func TestComputePeriodAtThisDate(t *testing.T) {
 	ft := testlib.YMDHMS
 	var testCases = []struct {
 		tmOffset int
+		tmZone   string
 		period   string
 		dt       time.Time
 		expected bool
@@ -143,6 +144,40 @@ func TestComputePeriodAtThisDate(t *testing.T) {
 		{tmOffset: -10, period: "m2", dt: ft(2017, 12, 19, 14), expected: false},
 		{tmOffset: -10, period: "q3", dt: ft(2017, 12, 19, 15), expected: false},
 		{tmOffset: -10, period: "y10", dt: ft(2017, 12, 19, 15), expected: false},
+		{tmOffset: -6, period: "d7", dt: ft(2017, 12, 19, 3), expected: true},
+		{tmOffset: -6, period: "m", dt: ft(2017, 12, 19, 6), expected: true},
+		{tmOffset: -6, period: "m", dt: ft(2017, 12, 19), expected: false},
+		// Time zone overrides time offset
+		{tmOffset: 5, tmZone: "UTC", period: "m", dt: ft(2017, 12, 19), expected: true},
+		{tmZone: "America/New_York", period: "m", dt: ft(2017, 12, 19, 5), expected: true},
+		{tmZone: "America/New_York", period: "m", dt: ft(2017, 7, 19, 4), expected: true},
+		{tmZone: "America/New_York", period: "m", dt: ft(2017, 7, 19, 5), expected: false},
+		// DST starts in New York on 2018-03-11 at 2 AM (7 AM UTC), local hour 2 is skipped
+		// Hours are counted since local midnight (5 AM UTC), so "2 AM" tasks run at 3 AM EDT
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 3, 11, 5), expected: true},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 3, 11, 6), expected: false},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 3, 11, 7, 30), expected: true},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 3, 11, 8), expected: false},
+		{tmZone: "America/New_York", period: "w", dt: ft(2018, 3, 11, 9), expected: true},
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 3, 12, 3), expected: false},
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 3, 12, 4), expected: true},
+		// DST ends in New York on 2018-11-04 at 2 AM (6 AM UTC), local hour 1 is repeated, day has 25 hours
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 11, 4, 4), expected: true},
+		{tmZone: "America/New_York", period: "d7", dt: ft(2018, 11, 4, 5), expected: true},
+		{tmZone: "America/New_York", period: "d7", dt: ft(2018, 11, 4, 6), expected: false},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 11, 4, 5), expected: false},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 11, 4, 6), expected: true},
+		{tmZone: "America/New_York", period: "anno_10_11", dt: ft(2018, 11, 4, 7), expected: false},
+		{tmZone: "America/New_York", period: "w", dt: ft(2018, 11, 5, 4), expected: true},
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 11, 5, 4), expected: false},
+		{tmZone: "America/New_York", period: "m", dt: ft(2018, 11, 5, 5), expected: true},
+		// Europe DST ends on 2018-10-28 at 3 AM (1 AM UTC)
+		{tmZone: "Europe/Warsaw", period: "m", dt: ft(2018, 10, 27, 22), expected: true},
+		{tmZone: "Europe/Warsaw", period: "m", dt: ft(2018, 10, 28, 23), expected: true},
+		{tmZone: "Europe/Warsaw", period: "m", dt: ft(2018, 10, 28, 22), expected: false},
+		// Half hour time zone, local midnight is at 6:30 PM UTC
+		{tmZone: "Asia/Kolkata", period: "m", dt: ft(2017, 12, 19, 18, 45), expected: false},
+		{tmZone: "Asia/Kolkata", period: "m", dt: ft(2017, 12, 19, 19), expected: true},
 	}
 
 	// Environment context parse
@@ -153,11 +188,20 @@ func TestComputePeriodAtThisDate(t *testing.T) {
 	for index, test := range testCases {
 		expected := test.expected
 		ctx.TmOffset = test.tmOffset
+		ctx.TmZone = nil
+		if test.tmZone != "" {
+			loc, err := time.LoadLocation(test.tmZone)
+			if err != nil {
+				t.Errorf("test number %d, cannot load time zone: %v", index+1, err)
+				continue
+			}
+			ctx.TmZone = loc
+		}
 		got := lib.ComputePeriodAtThisDate(&ctx, test.period, test.dt)
 		if got != expected {
 			t.Errorf(
-				"test number %d, expected '%v' from period '%v' for date '%v', got '%v'",
-				index+1, expected, test.period, test.dt, got,
+				"test number %d, expected '%v' from period '%v' for date '%v' (zone '%v'), got '%v'",
+				index+1, expected, test.period, test.dt, lib.TimeZone(&ctx), got,
 			)
 		}
 	}
@@ -646,6 +690,150 @@ func TestPrevYearStart(t *testing.T) {
 	}
 }
 
+func TestInTimeZone(t *testing.T) {
+	// Test cases
+	ft := testlib.YMDHMS
+	var testCases = []struct {
+		zone     string
+		fun      func(time.Time) time.Time
+		time     time.Time
+		expected time.Time
+	}{
+		{zone: "UTC", fun: lib.DayStart, time: ft(2018, 3, 11, 12), expected: ft(2018, 3, 11)},
+		{zone: "America/New_York", fun: lib.HourStart, time: ft(2018, 3, 11, 7, 45), expected: ft(2018, 3, 11, 7)},
+		{zone: "America/New_York", fun: lib.DayStart, time: ft(2018, 3, 11, 12), expected: ft(2018, 3, 11, 5)},
+		{zone: "America/New_York", fun: lib.DayStart, time: ft(2018, 3, 11, 3), expected: ft(2018, 3, 10, 5)},
+		{zone: "America/New_York", fun: lib.NextDayStart, time: ft(2018, 3, 11, 12), expected: ft(2018, 3, 12, 4)},
+		{zone: "America/New_York", fun: lib.PrevDayStart, time: ft(2018, 11, 5, 12), expected: ft(2018, 11, 4, 4)},
+		// Local 1 AM is repeated on 2018-11-04
+		{zone: "America/New_York", fun: lib.HourStart, time: ft(2018, 11, 4, 5, 30), expected: ft(2018, 11, 4, 5)},
+		{zone: "America/New_York", fun: lib.HourStart, time: ft(2018, 11, 4, 6, 30), expected: ft(2018, 11, 4, 6)},
+		{zone: "America/New_York", fun: lib.DayStart, time: ft(2018, 11, 4, 12), expected: ft(2018, 11, 4, 4)},
+		{zone: "America/New_York", fun: lib.WeekStart, time: ft(2018, 3, 14, 12), expected: ft(2018, 3, 12, 4)},
+		{zone: "America/New_York", fun: lib.NextWeekStart, time: ft(2018, 3, 7, 12), expected: ft(2018, 3, 12, 4)},
+		{zone: "America/New_York", fun: lib.MonthStart, time: ft(2018, 11, 15), expected: ft(2018, 11, 1, 4)},
+		{zone: "America/New_York", fun: lib.NextMonthStart, time: ft(2018, 11, 15), expected: ft(2018, 12, 1, 5)},
+		{zone: "America/New_York", fun: lib.QuarterStart, time: ft(2018, 4, 1, 3), expected: ft(2018, 1, 1, 5)},
+		{zone: "America/New_York", fun: lib.YearStart, time: ft(2018, 6, 1), expected: ft(2018, 1, 1, 5)},
+		{zone: "Europe/Warsaw", fun: lib.DayStart, time: ft(2018, 10, 28, 12), expected: ft(2018, 10, 27, 22)},
+		{zone: "Europe/Warsaw", fun: lib.NextDayStart, time: ft(2018, 10, 28, 12), expected: ft(2018, 10, 28, 23)},
+		{zone: "Asia/Kolkata", fun: lib.DayStart, time: ft(2017, 12, 19, 19), expected: ft(2017, 12, 19, 18, 30)},
+		{zone: "Asia/Kolkata", fun: lib.HourStart, time: ft(2017, 12, 19, 19), expected: ft(2017, 12, 19, 18, 30)},
+		{zone: "Asia/Kolkata", fun: lib.HourStart, time: ft(2017, 12, 19, 18, 45), expected: ft(2017, 12, 19, 18, 30)},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		loc, err := time.LoadLocation(test.zone)
+		if err != nil {
+			t.Errorf("test number %d, cannot load time zone: %v", index+1, err)
+			continue
+		}
+		expected := test.expected
+		got := lib.InTimeZone(test.fun, loc)(test.time)
+		if got != expected {
+			t.Errorf(
+				"test number %d, expected %v, got %v",
+				index+1, expected, got,
+			)
+		}
+	}
+}
+
+func TestGetIntervalFunctionsInZone(t *testing.T) {
+	// Test cases
+	ft := testlib.YMDHMS
+	var testCases = []struct {
+		zone         string
+		periodAbbr   string
+		time         time.Time
+		expectedN    int
+		expectedPrev time.Time
+		expected     time.Time
+		expectedNext time.Time
+	}{
+		{periodAbbr: "d", time: ft(2018, 3, 11, 12), expectedN: 1, expectedPrev: ft(2018, 3, 10), expected: ft(2018, 3, 11), expectedNext: ft(2018, 3, 12)},
+		{zone: "UTC", periodAbbr: "w", time: ft(2018, 3, 14, 12), expectedN: 1, expectedPrev: ft(2018, 3, 5), expected: ft(2018, 3, 12), expectedNext: ft(2018, 3, 19)},
+		{zone: "America/New_York", periodAbbr: "h", time: ft(2018, 3, 11, 7, 45), expectedN: 1, expectedPrev: ft(2018, 3, 11, 6), expected: ft(2018, 3, 11, 7), expectedNext: ft(2018, 3, 11, 8)},
+		{zone: "Asia/Kolkata", periodAbbr: "h", time: ft(2017, 12, 19, 18, 45), expectedN: 1, expectedPrev: ft(2017, 12, 19, 17), expected: ft(2017, 12, 19, 18), expectedNext: ft(2017, 12, 19, 19)},
+		{zone: "America/New_York", periodAbbr: "d", time: ft(2018, 3, 11, 12), expectedN: 1, expectedPrev: ft(2018, 3, 10, 5), expected: ft(2018, 3, 11, 5), expectedNext: ft(2018, 3, 12, 4)},
+		{zone: "America/New_York", periodAbbr: "d7", time: ft(2018, 11, 4, 12), expectedN: 7, expectedPrev: ft(2018, 11, 3, 4), expected: ft(2018, 11, 4, 4), expectedNext: ft(2018, 11, 5, 5)},
+		{zone: "America/New_York", periodAbbr: "w", time: ft(2018, 3, 14, 12), expectedN: 1, expectedPrev: ft(2018, 3, 5, 5), expected: ft(2018, 3, 12, 4), expectedNext: ft(2018, 3, 19, 4)},
+		{zone: "Europe/Warsaw", periodAbbr: "m", time: ft(2018, 10, 28, 12), expectedN: 1, expectedPrev: ft(2018, 8, 31, 22), expected: ft(2018, 9, 30, 22), expectedNext: ft(2018, 10, 31, 23)},
+		{zone: "Europe/Warsaw", periodAbbr: "y", time: ft(2018, 12, 31, 23, 30), expectedN: 1, expectedPrev: ft(2017, 12, 31, 23), expected: ft(2018, 12, 31, 23), expectedNext: ft(2019, 12, 31, 23)},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		var loc *time.Location
+		if test.zone != "" {
+			var err error
+			loc, err = time.LoadLocation(test.zone)
+			if err != nil {
+				t.Errorf("test number %d, cannot load time zone: %v", index+1, err)
+				continue
+			}
+		}
+		_, n, start, next, prev := lib.GetIntervalFunctionsInZone(test.periodAbbr, false, loc)
+		got := []time.Time{prev(start(test.time)), start(test.time), next(test.time)}
+		expected := []time.Time{test.expectedPrev, test.expected, test.expectedNext}
+		if n != test.expectedN || !reflect.DeepEqual(got, expected) {
+			t.Errorf(
+				"test number %d, expected %v %v, got %v %v",
+				index+1, test.expectedN, expected, n, got,
+			)
+		}
+	}
+
+	// Annotation ranges have no interval functions
+	_, _, start, _, _ := lib.GetIntervalFunctionsInZone("anno_0_1", true, time.UTC)
+	if start != nil {
+		t.Errorf("expected no interval functions for annotation ranges")
+	}
+}
+
+func TestLocalDayHour(t *testing.T) {
+	// Test cases
+	ft := testlib.YMDHMS
+	var testCases = []struct {
+		tmOffset int
+		tmZone   string
+		time     time.Time
+		expected int
+	}{
+		{time: ft(2018, 3, 11, 7, 30), expected: 7},
+		{tmOffset: -6, time: ft(2018, 3, 11, 3), expected: 21},
+		{tmOffset: 2, time: ft(2018, 3, 11, 23), expected: 1},
+		{tmZone: "America/New_York", time: ft(2018, 3, 11, 4), expected: 23},
+		{tmZone: "America/New_York", time: ft(2018, 3, 11, 5), expected: 0},
+		{tmZone: "America/New_York", time: ft(2018, 3, 11, 7), expected: 2},
+		{tmZone: "America/New_York", time: ft(2018, 3, 12, 3, 59), expected: 22},
+		{tmZone: "America/New_York", time: ft(2018, 11, 4, 6), expected: 2},
+		{tmZone: "America/New_York", time: ft(2018, 11, 5, 4, 59), expected: 24},
+		{tmZone: "Asia/Kolkata", time: ft(2017, 12, 19, 18), expected: 23},
+	}
+	// Execute test cases
+	var ctx lib.Ctx
+	for index, test := range testCases {
+		ctx.TmOffset = test.tmOffset
+		ctx.TmZone = nil
+		if test.tmZone != "" {
+			loc, err := time.LoadLocation(test.tmZone)
+			if err != nil {
+				t.Errorf("test number %d, cannot load time zone: %v", index+1, err)
+				continue
+			}
+			ctx.TmZone = loc
+		}
+		expected := test.expected
+		got := lib.LocalDayHour(&ctx, test.time)
+		if got != expected {
+			t.Errorf(
+				"test number %d, expected %v, got %v",
+				index+1, expected, got,
+			)
+		}
+	}
+}
+
 func TestAddNIntervals(t *testing.T) {
 	// Test cases
 	ft := testlib.YMDHMS
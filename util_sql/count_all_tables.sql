@@ -25,6 +25,7 @@ select 'pull request requested reviewers' as name, count(*) as count_value from
 select 'releases' as name, count(*) as count_value from gha_releases union
 select 'release assets' as name, count(*) as count_value from gha_releases_assets union
 select 'repos' as name, count(*) as count_value from gha_repos union
+select 'reviews' as name, count(*) as count_value from gha_reviews union
 select 'skip commits' as name, count(*) as count_value from gha_skip_commits union
 select 'teams' as name, count(*) as count_value from gha_teams union
 select 'team repositories' as name, count(*) as count_value from gha_teams_repositories union
@@ -0,0 +1,28 @@
+CREATE TABLE gha_sync_runs (
+    id integer NOT NULL,
+    dt timestamp without time zone DEFAULT now(),
+    prog character varying(32) not null,
+    proj character varying(32) not null,
+    step character varying(64) not null,
+    started_at timestamp without time zone not null,
+    finished_at timestamp without time zone not null,
+    status character varying(16) not null,
+    attempts integer not null default 0,
+    rows bigint not null default 0,
+    points bigint not null default 0,
+    error text
+);
+ALTER TABLE gha_sync_runs OWNER TO gha_admin;
+CREATE SEQUENCE gha_sync_runs_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+ALTER TABLE gha_sync_runs_id_seq OWNER TO gha_admin;
+ALTER SEQUENCE gha_sync_runs_id_seq OWNED BY gha_sync_runs.id;
+ALTER TABLE ONLY gha_sync_runs ALTER COLUMN id SET DEFAULT nextval('gha_sync_runs_id_seq'::regclass);
+ALTER TABLE ONLY gha_sync_runs ADD CONSTRAINT gha_sync_runs_pkey PRIMARY KEY (id);
+CREATE INDEX sync_runs_proj_step_finished_at_idx ON gha_sync_runs USING btree (proj, step, finished_at);
+CREATE INDEX sync_runs_status_idx ON gha_sync_runs USING btree (status);
+GRANT SELECT ON TABLE gha_sync_runs TO ro_user;
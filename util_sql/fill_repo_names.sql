@@ -0,0 +1,17 @@
+insert into gha_repo_names(repo_id, name, first_seen, last_seen)
+select
+  repo_id,
+  dup_repo_name,
+  min(created_at),
+  max(created_at)
+from
+  gha_events
+where
+  id < 281474976710656
+group by
+  repo_id,
+  dup_repo_name
+on conflict(repo_id, name) do update set
+  first_seen = least(gha_repo_names.first_seen, excluded.first_seen),
+  last_seen = greatest(gha_repo_names.last_seen, excluded.last_seen)
+;
@@ -0,0 +1 @@
+ALTER TABLE gha_ingest_hours ADD COLUMN IF NOT EXISTS attempts integer DEFAULT 0 NOT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE gha_ingest_hours (
+  hour timestamp without time zone NOT NULL,
+  status character varying(20) NOT NULL,
+  jsons integer DEFAULT 0 NOT NULL,
+  found integer DEFAULT 0 NOT NULL,
+  events integer DEFAULT 0 NOT NULL,
+  checksum character varying(64) DEFAULT ''::character varying NOT NULL,
+  duration double precision DEFAULT 0 NOT NULL,
+  error text DEFAULT ''::text NOT NULL,
+  updated_at timestamp without time zone NOT NULL,
+  attempts integer DEFAULT 0 NOT NULL
+);
+ALTER TABLE gha_ingest_hours OWNER TO gha_admin;
+ALTER TABLE ONLY gha_ingest_hours ADD CONSTRAINT gha_ingest_hours_pkey PRIMARY KEY (hour);
+CREATE INDEX ingest_hours_status_idx ON gha_ingest_hours USING btree (status);
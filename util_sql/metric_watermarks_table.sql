@@ -0,0 +1,8 @@
+CREATE TABLE gha_metric_watermarks (
+  metric character varying(160) NOT NULL,
+  period character varying(32) NOT NULL,
+  dt timestamp without time zone NOT NULL,
+  updated_at timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_metric_watermarks OWNER TO gha_admin;
+ALTER TABLE ONLY gha_metric_watermarks ADD CONSTRAINT gha_metric_watermarks_pkey PRIMARY KEY (metric, period);
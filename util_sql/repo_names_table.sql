@@ -0,0 +1,9 @@
+CREATE TABLE gha_repo_names (
+  repo_id bigint NOT NULL,
+  name character varying(160) NOT NULL,
+  first_seen timestamp without time zone NOT NULL,
+  last_seen timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_repo_names OWNER TO gha_admin;
+ALTER TABLE ONLY gha_repo_names ADD CONSTRAINT gha_repo_names_pkey PRIMARY KEY (repo_id, name);
+CREATE INDEX repo_names_name_idx ON gha_repo_names USING btree (name);
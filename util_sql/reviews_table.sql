@@ -0,0 +1,32 @@
+CREATE TABLE gha_reviews (
+  id bigint NOT NULL,
+  event_id bigint NOT NULL,
+  pull_request_id bigint NOT NULL,
+  user_id bigint NOT NULL,
+  commit_id character varying(40),
+  submitted_at timestamp without time zone,
+  state character varying(20) NOT NULL,
+  body text,
+  author_association character varying(40),
+  dup_actor_id bigint NOT NULL,
+  dup_actor_login character varying(120) NOT NULL,
+  dup_repo_id bigint NOT NULL,
+  dup_repo_name character varying(160) NOT NULL,
+  dup_type character varying(40) NOT NULL,
+  dup_created_at timestamp without time zone NOT NULL,
+  dup_user_login character varying(120) NOT NULL,
+  dup_pull_request_number integer NOT NULL
+);
+ALTER TABLE gha_reviews OWNER TO gha_admin;
+ALTER TABLE ONLY gha_reviews ADD CONSTRAINT gha_reviews_pkey PRIMARY KEY (id, event_id);
+CREATE INDEX reviews_event_id_idx ON gha_reviews USING btree (event_id);
+CREATE INDEX reviews_pull_request_id_idx ON gha_reviews USING btree (pull_request_id);
+CREATE INDEX reviews_user_id_idx ON gha_reviews USING btree (user_id);
+CREATE INDEX reviews_submitted_at_idx ON gha_reviews USING btree (submitted_at);
+CREATE INDEX reviews_state_idx ON gha_reviews USING btree (state);
+CREATE INDEX reviews_dup_actor_id_idx ON gha_reviews USING btree (dup_actor_id);
+CREATE INDEX reviews_dup_actor_login_idx ON gha_reviews USING btree (dup_actor_login);
+CREATE INDEX reviews_dup_repo_id_idx ON gha_reviews USING btree (dup_repo_id);
+CREATE INDEX reviews_dup_repo_name_idx ON gha_reviews USING btree (dup_repo_name);
+CREATE INDEX reviews_dup_created_at_idx ON gha_reviews USING btree (dup_created_at);
+CREATE INDEX reviews_dup_user_login_idx ON gha_reviews USING btree (dup_user_login);
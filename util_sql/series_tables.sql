@@ -0,0 +1,21 @@
+CREATE TABLE gha_series_points (
+  series text NOT NULL,
+  "time" timestamp without time zone NOT NULL,
+  tags jsonb DEFAULT '{}'::jsonb NOT NULL,
+  fields jsonb NOT NULL,
+  CONSTRAINT gha_series_points_pkey PRIMARY KEY (series, "time", tags)
+);
+ALTER TABLE gha_series_points OWNER TO gha_admin;
+CREATE TABLE gha_series (
+  series text NOT NULL
+);
+ALTER TABLE gha_series OWNER TO gha_admin;
+ALTER TABLE ONLY gha_series ADD CONSTRAINT gha_series_pkey PRIMARY KEY (series);
+CREATE TABLE gha_series_tags (
+  series text NOT NULL,
+  key text NOT NULL,
+  value text NOT NULL
+);
+ALTER TABLE gha_series_tags OWNER TO gha_admin;
+ALTER TABLE ONLY gha_series_tags ADD CONSTRAINT gha_series_tags_pkey PRIMARY KEY (key, value, series);
+CREATE INDEX series_tags_series_idx ON gha_series_tags USING btree (series);
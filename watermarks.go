@@ -0,0 +1,86 @@
+package devstats
+
+import (
+	"database/sql"
+	"time"
+)
+
+// MetricWatermark - metrics watermark key: metric name (from metrics.yaml) and period with aggregate suffix (like "d7", "w2")
+type MetricWatermark struct {
+	Metric string
+	Period string
+}
+
+// MetricsWatermarks - metrics watermarks, watermark is the date up to which metric's period was successfully calculated
+// Marks are read from `gha_metric_watermarks` table, Advanced are watermarks moved by the current sync (to be saved)
+type MetricsWatermarks struct {
+	Marks    map[MetricWatermark]time.Time
+	Advanced map[MetricWatermark]time.Time
+}
+
+// From - return date from which a given metric's period should be calculated
+// It is metric's own watermark, or a given default date when metric has no watermark yet
+func (mw *MetricsWatermarks) From(key MetricWatermark, from time.Time) time.Time {
+	if dt, ok := mw.Marks[key]; ok {
+		return dt
+	}
+	return from
+}
+
+// Advance - mark metric's period as successfully calculated up to a given date
+func (mw *MetricsWatermarks) Advance(key MetricWatermark, to time.Time) {
+	if mw.Marks == nil {
+		mw.Marks = make(map[MetricWatermark]time.Time)
+	}
+	if mw.Advanced == nil {
+		mw.Advanced = make(map[MetricWatermark]time.Time)
+	}
+	mw.Marks[key] = to
+	mw.Advanced[key] = to
+}
+
+// GetMetricsWatermarks - read all metrics watermarks from project's `gha_metric_watermarks` table
+func GetMetricsWatermarks(con *sql.DB, ctx *Ctx) (*MetricsWatermarks, error) {
+	mw := MetricsWatermarks{Marks: make(map[MetricWatermark]time.Time), Advanced: make(map[MetricWatermark]time.Time)}
+	rows, err := QuerySQL(con, ctx, "select metric, period, dt from gha_metric_watermarks")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var (
+			key MetricWatermark
+			dt  time.Time
+		)
+		err = rows.Scan(&key.Metric, &key.Period, &dt)
+		if err != nil {
+			return nil, err
+		}
+		mw.Marks[key] = dt
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return &mw, nil
+}
+
+// SaveMetricsWatermarks - save watermarks advanced by the current sync in project's `gha_metric_watermarks` table
+func SaveMetricsWatermarks(con *sql.DB, ctx *Ctx, mw *MetricsWatermarks) error {
+	for key, dt := range mw.Advanced {
+		_, err := ExecSQL(
+			con,
+			ctx,
+			"insert into gha_metric_watermarks(metric, period, dt, updated_at) "+NValues(4)+
+				" on conflict(metric, period) do update set dt = excluded.dt, updated_at = excluded.updated_at",
+			key.Metric,
+			key.Period,
+			dt,
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package devstats
+
+import (
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestMetricsWatermarks(t *testing.T) {
+	from := testlib.YMDHMS(2018, 2, 3, 4)
+	to := testlib.YMDHMS(2018, 2, 3, 6)
+	var mw lib.MetricsWatermarks
+	prsD := lib.MetricWatermark{Metric: "prs_opened", Period: "d"}
+	prsW2 := lib.MetricWatermark{Metric: "prs_opened", Period: "w2"}
+	events := lib.MetricWatermark{Metric: "events", Period: "h"}
+
+	// No watermarks yet, default date is used
+	if got := mw.From(prsD, from); got != from {
+		t.Errorf("expected %v, got %v", from, got)
+	}
+
+	// Metric that failed or was skipped earlier resumes from its own (older) watermark
+	mw.Marks = map[lib.MetricWatermark]time.Time{prsD: testlib.YMDHMS(2018, 2, 1), events: from}
+	mw.Advanced = map[lib.MetricWatermark]time.Time{}
+	// Test cases
+	var testCases = []struct {
+		key      lib.MetricWatermark
+		expected time.Time
+	}{
+		{key: prsD, expected: testlib.YMDHMS(2018, 2, 1)},
+		{key: prsW2, expected: from},
+		{key: events, expected: from},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := mw.From(test.key, from)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+
+	// Only successfully calculated metrics are advanced (and saved)
+	mw.Advance(events, to)
+	mw.Advance(prsW2, to)
+	if mw.From(events, from) != to || mw.From(prsW2, from) != to || mw.From(prsD, from) != testlib.YMDHMS(2018, 2, 1) {
+		t.Errorf("unexpected watermarks %+v", mw.Marks)
+	}
+	if len(mw.Advanced) != 2 || mw.Advanced[events] != to || mw.Advanced[prsW2] != to {
+		t.Errorf("unexpected advanced watermarks %+v", mw.Advanced)
+	}
+
+	// Advancing works on empty watermarks too
+	var empty lib.MetricsWatermarks
+	empty.Advance(prsD, to)
+	if empty.From(prsD, from) != to || len(empty.Advanced) != 1 {
+		t.Errorf("unexpected watermarks %+v, advanced %+v", empty.Marks, empty.Advanced)
+	}
+}